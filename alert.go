@@ -0,0 +1,279 @@
+package ottscanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Alert is the payload sent to notifiers when a monitored stream starts
+// failing, is still failing after the re-alert interval or recovers.
+type Alert struct {
+	Stream string      `json:"stream"`
+	URL    string      `json:"url"`
+	State  HealthState `json:"state"`
+	From   HealthState `json:"from"`
+	At     time.Time   `json:"at"`
+	// FirstSeen is when the stream started failing.
+	FirstSeen time.Time `json:"first_seen"`
+	// Repeat is true for a re-alert of a stream that is still failing.
+	Repeat              bool            `json:"repeat"`
+	ConsecutiveFailures int             `json:"consecutive_failures"`
+	Error               string          `json:"error,omitempty"`
+	FailingSegments     []SegmentResult `json:"failing_segments,omitempty"`
+	// Categories counts the failing segments by the category of their error.
+	Categories map[string]int `json:"categories,omitempty"`
+}
+
+// Summary returns a single line description of the alert.
+func (a Alert) Summary() string {
+	switch {
+	case a.State != HealthFailing:
+		return fmt.Sprintf("%s is %s after failing since %s", a.Stream, a.State, a.FirstSeen.Format(time.RFC3339))
+	case a.Error != "":
+		return fmt.Sprintf("%s is failing: %s", a.Stream, a.Error)
+	default:
+		return fmt.Sprintf("%s is failing: %d segments failed", a.Stream, len(a.FailingSegments))
+	}
+}
+
+// resultCategory returns the failure category of a failed segment
+// request, or other for results recorded without one
+func resultCategory(result SegmentResult) string {
+	if result.Category != "" {
+		return result.Category
+	}
+	return FailureOther.String()
+}
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Webhook is a notifier that POSTs alerts to a url. The body is the alert
+// as JSON unless a Body template is set.
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+	// Body renders the request body from the Alert. The template has a
+	// json function to quote values, as in {"text": {{json .Summary}}}.
+	Body *template.Template
+	// Client sends the requests. Defaults to a client with a 10 second timeout.
+	Client *http.Client
+}
+
+// NewWebhook returns a webhook for the url with the body template, or the
+// alert as JSON when body is empty.
+func NewWebhook(url, body string) (*Webhook, error) {
+	webhook := &Webhook{URL: url}
+	if body != "" {
+		tmpl, err := ParseAlertTemplate(body)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Body = tmpl
+	}
+	return webhook, nil
+}
+
+// ParseAlertTemplate parses a webhook body template.
+func ParseAlertTemplate(body string) (*template.Template, error) {
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(body)
+	if err != nil {
+		return nil, newScannerError(err, "error parsing webhook template")
+	}
+	return tmpl, nil
+}
+
+// Notify posts the alert to the webhook. A response other than 2xx is an error.
+func (w *Webhook) Notify(ctx context.Context, alert Alert) error {
+	var body bytes.Buffer
+	if w.Body != nil {
+		if err := w.Body.Execute(&body, alert); err != nil {
+			return newScannerError(err, "error rendering webhook body")
+		}
+	} else if err := json.NewEncoder(&body).Encode(alert); err != nil {
+		return newScannerError(err, "error encoding alert")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, &body)
+	if err != nil {
+		return newScannerError(err, w.URL)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return newScannerError(err, fmt.Sprintf("error sending alert to %s", w.URL))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := &HTTPError{Method: http.MethodPost, URL: w.URL, Status: resp.Status, StatusCode: resp.StatusCode}
+		return newScannerError(err, "error sending alert")
+	}
+	return nil
+}
+
+// AlertOptions configures an Alerter.
+type AlertOptions struct {
+	Notifiers []Notifier
+	// RealertInterval repeats the alert of a stream that is still failing
+	// after the interval. There are no repeats by default.
+	RealertInterval time.Duration
+	// OnError is called when a notifier fails. Errors are logged to
+	// Logger by default.
+	OnError func(alert Alert, err error)
+	Logger  *slog.Logger
+	// Context cancels notifications in flight, usually the context the
+	// monitor runs with. Defaults to context.Background().
+	Context context.Context
+}
+
+// Alerter turns the health of monitored streams into alerts. Plug its
+// OnScan and OnTransition methods into the MonitorOptions of the same
+// name. A stream is alerted once when it starts failing and once when it
+// recovers no matter how many scans see the same state.
+type Alerter struct {
+	options AlertOptions
+	// alerted is the last alert sent per stream
+	alerted map[string]Alert
+	mutex   sync.Mutex
+}
+
+// NewAlerter returns an alerter that sends alerts to the notifiers.
+func NewAlerter(options AlertOptions) *Alerter {
+	return &Alerter{
+		options: options,
+		alerted: make(map[string]Alert),
+	}
+}
+
+// OnTransition alerts when a stream starts failing or recovers.
+func (a *Alerter) OnTransition(transition Transition) {
+	if transition.To != HealthFailing && transition.To != HealthRecovered {
+		return
+	}
+	a.mutex.Lock()
+	last, ok := a.alerted[transition.Stream]
+	if ok && last.State == transition.To {
+		a.mutex.Unlock()
+		return
+	}
+	if transition.To == HealthRecovered && (!ok || last.State != HealthFailing) {
+		// nothing was alerted so there is nothing to recover from
+		a.mutex.Unlock()
+		return
+	}
+	alert := newAlert(transition.Health, transition.At)
+	alert.From = transition.From
+	if transition.To == HealthRecovered {
+		alert.FirstSeen = last.FirstSeen
+	}
+	a.alerted[transition.Stream] = alert
+	a.mutex.Unlock()
+	a.send(alert)
+}
+
+// OnScan repeats the alert of a stream that is still failing once the
+// re-alert interval has passed.
+func (a *Alerter) OnScan(health StreamHealth, report *Report, err error) {
+	if a.options.RealertInterval <= 0 || health.State != HealthFailing {
+		return
+	}
+	a.mutex.Lock()
+	last, ok := a.alerted[health.Name]
+	if !ok || last.State != HealthFailing || health.LastScan.Sub(last.At) < a.options.RealertInterval {
+		a.mutex.Unlock()
+		return
+	}
+	alert := newAlert(health, health.LastScan)
+	alert.From = HealthFailing
+	alert.FirstSeen = last.FirstSeen
+	alert.Repeat = true
+	a.alerted[health.Name] = alert
+	a.mutex.Unlock()
+	a.send(alert)
+}
+
+func newAlert(health StreamHealth, at time.Time) Alert {
+	alert := Alert{
+		Stream:              health.Name,
+		URL:                 health.URL,
+		State:               health.State,
+		At:                  at,
+		FirstSeen:           health.Since,
+		ConsecutiveFailures: health.ConsecutiveFailures,
+	}
+	var last ScanOutcome
+	if len(health.History) > 0 {
+		last = health.History[len(health.History)-1]
+		alert.Error = last.Error
+	}
+	// the stream failed since the first of the failed scans in a row
+	for i := len(health.History) - 1; i >= 0 && !health.History[i].OK; i-- {
+		alert.FirstSeen = health.History[i].Started
+	}
+	// the report is of an earlier scan when the last one failed before
+	// scanning any segment
+	stale := last.Error != "" && last.Segments == 0
+	if health.State == HealthFailing && health.Report != nil && !stale {
+		for _, result := range health.Report.Results() {
+			if result.OK {
+				continue
+			}
+			if alert.Categories == nil {
+				alert.Categories = make(map[string]int)
+			}
+			alert.FailingSegments = append(alert.FailingSegments, result)
+			alert.Categories[resultCategory(result)]++
+		}
+	}
+	if alert.Error != "" {
+		if alert.Categories == nil {
+			alert.Categories = make(map[string]int)
+		}
+		category := last.Category
+		if category == "" {
+			category = FailureOther.String()
+		}
+		alert.Categories[category]++
+	}
+	return alert
+}
+
+// send delivers the alert to every notifier
+func (a *Alerter) send(alert Alert) {
+	ctx := a.options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, notifier := range a.options.Notifiers {
+		if err := notifier.Notify(ctx, alert); err != nil {
+			if a.options.OnError != nil {
+				a.options.OnError(alert, err)
+			} else {
+				orDiscard(a.options.Logger).Error("error alerting", "stream", alert.Stream, "state", alert.State.String(), "error", err)
+			}
+		}
+	}
+}
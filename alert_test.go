@@ -0,0 +1,189 @@
+package ottscanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestReceiver records the bodies posted to it
+func newTestReceiver(t *testing.T) (*httptest.Server, func() []string) {
+	var mutex sync.Mutex
+	var bodies []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(body))
+		mutex.Unlock()
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func testHealth(state HealthState, at time.Time, outcomes ...bool) StreamHealth {
+	health := StreamHealth{Name: "news", URL: "http://origin/news.m3u8", State: state, Since: at, LastScan: at}
+	for i, ok := range outcomes {
+		outcome := ScanOutcome{Started: at.Add(time.Duration(i-len(outcomes)+1) * time.Minute), OK: ok}
+		if !ok {
+			health.ConsecutiveFailures++
+		} else {
+			health.ConsecutiveFailures = 0
+		}
+		health.History = append(health.History, outcome)
+	}
+	if state == HealthFailing {
+		health.Report = &Report{Streams: []StreamReport{{Name: "high", Segments: []SegmentResult{
+			{Name: "1.ts", OK: true},
+			{Name: "2.ts", Error: "HEAD http://origin/2.ts: 404 Not Found", Category: FailureClient.String()},
+			{Name: "3.ts", Error: "HEAD http://origin/3.ts: 503 Service Unavailable", Category: FailureServer.String()},
+		}}}}
+	}
+	return health
+}
+
+func TestAlerter(t *testing.T) {
+	receiver, received := newTestReceiver(t)
+	webhook, err := NewWebhook(receiver.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerter := NewAlerter(AlertOptions{Notifiers: []Notifier{webhook}, RealertInterval: 10 * time.Minute})
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	failing := testHealth(HealthFailing, start, true, false, false)
+	alerter.OnTransition(Transition{Stream: "news", From: HealthHealthy, To: HealthFailing, At: start, Health: failing})
+	// the same state again is deduplicated
+	alerter.OnTransition(Transition{Stream: "news", From: HealthHealthy, To: HealthFailing, At: start, Health: failing})
+	// scans before the re-alert interval do not alert
+	failing.LastScan = start.Add(5 * time.Minute)
+	alerter.OnScan(failing, nil, nil)
+	failing.LastScan = start.Add(10 * time.Minute)
+	alerter.OnScan(failing, nil, nil)
+	recovered := testHealth(HealthRecovered, start.Add(11*time.Minute), false, true)
+	alerter.OnTransition(Transition{Stream: "news", From: HealthFailing, To: HealthRecovered, At: recovered.LastScan, Health: recovered})
+	alerter.OnTransition(Transition{Stream: "news", From: HealthRecovered, To: HealthHealthy, At: recovered.LastScan, Health: recovered})
+
+	bodies := received()
+	if len(bodies) != 3 {
+		t.Fatalf("expected failing, repeat and recovered alerts, got: %q", bodies)
+	}
+	var alerts []Alert
+	for _, body := range bodies {
+		var alert Alert
+		if err := json.Unmarshal([]byte(body), &alert); err != nil {
+			t.Fatal(err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	firstSeen := start.Add(-time.Minute)
+	if alerts[0].State != HealthFailing || alerts[0].Repeat || len(alerts[0].FailingSegments) != 2 || !alerts[0].FirstSeen.Equal(firstSeen) {
+		t.Errorf("unexpected failing alert: %+v", alerts[0])
+	}
+	if alerts[0].Categories["http_4xx"] != 1 || alerts[0].Categories["http_5xx"] != 1 {
+		t.Errorf("unexpected categories: %v", alerts[0].Categories)
+	}
+	if !alerts[1].Repeat || !alerts[1].FirstSeen.Equal(firstSeen) {
+		t.Errorf("unexpected repeat alert: %+v", alerts[1])
+	}
+	if alerts[2].State != HealthRecovered || alerts[2].Repeat || !alerts[2].FirstSeen.Equal(firstSeen) || len(alerts[2].FailingSegments) != 0 {
+		t.Errorf("unexpected recovered alert: %+v", alerts[2])
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	receiver, received := newTestReceiver(t)
+	webhook, err := NewWebhook(receiver.URL, `{"text": {{json .Summary}}, "failed": {{len .FailingSegments}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	alerter := NewAlerter(AlertOptions{Notifiers: []Notifier{webhook}})
+	alerter.OnTransition(Transition{Stream: "news", To: HealthFailing, At: at, Health: testHealth(HealthFailing, at, false)})
+
+	expected := `{"text": "news is failing: 2 segments failed", "failed": 2}`
+	if bodies := received(); len(bodies) != 1 || bodies[0] != expected {
+		t.Errorf("expected: %s, got: %q", expected, bodies)
+	}
+
+	if _, err := NewWebhook(receiver.URL, "{{.Stream"); err == nil {
+		t.Error("expected an error for a bad template")
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	var errs []error
+	alerter := NewAlerter(AlertOptions{
+		Notifiers: []Notifier{&Webhook{URL: receiver.URL}},
+		OnError: func(alert Alert, err error) {
+			errs = append(errs, err)
+		},
+	})
+	at := time.Now()
+	alerter.OnTransition(Transition{Stream: "news", To: HealthFailing, At: at, Health: testHealth(HealthFailing, at, false)})
+	if len(errs) != 1 {
+		t.Fatalf("expected an error for a 502 response, got: %v", errs)
+	}
+}
+
+func TestAlerter_ScanError(t *testing.T) {
+	receiver, received := newTestReceiver(t)
+	alerter := NewAlerter(AlertOptions{Notifiers: []Notifier{&Webhook{URL: receiver.URL}}})
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	// the last scan timed out before scanning segments so the failing
+	// segments of the report of the scan before are left out
+	health := testHealth(HealthFailing, at, false)
+	health.History[0].Error = "GET http://origin/news.m3u8: context deadline exceeded"
+	health.History[0].Category = FailureTimeout.String()
+	alerter.OnTransition(Transition{Stream: "news", To: HealthFailing, At: at, Health: health})
+
+	bodies := received()
+	if len(bodies) != 1 {
+		t.Fatalf("expected an alert, got: %q", bodies)
+	}
+	var alert Alert
+	if err := json.Unmarshal([]byte(bodies[0]), &alert); err != nil {
+		t.Fatal(err)
+	}
+	if len(alert.FailingSegments) != 0 || len(alert.Categories) != 1 || alert.Categories["timeout"] != 1 {
+		t.Errorf("expected only the category of the scan error, got: %+v", alert)
+	}
+}
+
+func TestAlerter_Context(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer receiver.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var errs []error
+	alerter := NewAlerter(AlertOptions{
+		Notifiers: []Notifier{&Webhook{URL: receiver.URL}},
+		Context:   ctx,
+		OnError: func(alert Alert, err error) {
+			errs = append(errs, err)
+		},
+	})
+	at := time.Now()
+	alerter.OnTransition(Transition{Stream: "news", To: HealthFailing, At: at, Health: testHealth(HealthFailing, at, false)})
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Fatalf("expected the alert to be cancelled, got: %v", errs)
+	}
+}
@@ -0,0 +1,454 @@
+package ottscanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/semaphore"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Channel is a stream to scan in a batch.
+type Channel struct {
+	Name  string   `json:"name"`
+	URL   string   `json:"url"`
+	Group string   `json:"group,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	// Attributes are the extra columns of a csv channel list or the
+	// attributes of an extended M3U entry such as tvg-id and tvg-logo.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// LoadChannels reads a channel list from a file. See ReadChannels.
+func LoadChannels(filePath string) ([]Channel, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, newScannerError(err, fmt.Sprintf("error opening channel list: %s", filePath))
+	}
+	defer file.Close()
+	channels, err := ReadChannels(file)
+	if err != nil {
+		return nil, newScannerError(err, filePath)
+	}
+	return channels, nil
+}
+
+// ReadChannels reads a channel list. The format is detected from the
+// content: an extended M3U channel playlist starting with #EXTM3U, a
+// csv file with a header row that has a url column, or a text file with
+// a url per line. Blank lines and lines starting with # are ignored in
+// text files.
+func ReadChannels(reader io.Reader) ([]Channel, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, newScannerError(err, "error reading channel list")
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var channels []Channel
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	firstLine = strings.TrimSpace(firstLine)
+	switch {
+	case strings.HasPrefix(firstLine, "#EXTM3U"):
+		channels, err = readM3UChannels(data)
+	case strings.Contains(firstLine, ",") && hasColumn(firstLine, "url"):
+		channels, err = readCSVChannels(data)
+	default:
+		channels, err = readTextChannels(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, newScannerError(errors.New("no channels found"), "channel list")
+	}
+	return channels, nil
+}
+
+func hasColumn(header, column string) bool {
+	for _, name := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return true
+		}
+	}
+	return false
+}
+
+func readTextChannels(data []byte) ([]Channel, error) {
+	var channels []Channel
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		channels = append(channels, Channel{Name: line, URL: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, newScannerError(err, "error reading channel list")
+	}
+	return channels, nil
+}
+
+func readCSVChannels(data []byte) ([]Channel, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, newScannerError(err, "error parsing csv channel list")
+	}
+	header := records[0]
+	var channels []Channel
+	for line, record := range records[1:] {
+		var channel Channel
+		for i, value := range record {
+			switch column := strings.ToLower(strings.TrimSpace(header[i])); column {
+			case "url":
+				channel.URL = value
+			case "name":
+				channel.Name = value
+			case "group":
+				channel.Group = value
+			default:
+				if value == "" {
+					continue
+				}
+				if channel.Attributes == nil {
+					channel.Attributes = make(map[string]string)
+				}
+				channel.Attributes[column] = value
+			}
+		}
+		if channel.URL == "" {
+			return nil, newScannerError(errors.New("missing url"), fmt.Sprintf("csv channel list line %d", line+2))
+		}
+		if channel.Name == "" {
+			channel.Name = channel.URL
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+// m3uAttribute matches key="value" attributes of an EXTINF line
+var m3uAttribute = regexp.MustCompile(`([A-Za-z0-9_-]+)="([^"]*)"`)
+
+// readM3UChannels reads an IPTV channel playlist such as
+//
+//	#EXTINF:-1 tvg-id="news.us" tvg-name="News" group-title="News",News HD
+//	http://origin/news/master.m3u8
+func readM3UChannels(data []byte) ([]Channel, error) {
+	var channels []Channel
+	var channel *Channel
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info := strings.TrimPrefix(line, "#EXTINF:")
+			// the title follows the first comma that is not inside an attribute value
+			var attributes, title string
+			quoted := false
+			for i, r := range info {
+				if r == '"' {
+					quoted = !quoted
+				}
+				if r == ',' && !quoted {
+					attributes, title = info[:i], info[i+1:]
+					break
+				}
+			}
+			if attributes == "" && title == "" {
+				return nil, newScannerError(errors.New("EXTINF without a title"), fmt.Sprintf("m3u channel list line %d", lineNumber))
+			}
+			channel = &Channel{Name: strings.TrimSpace(title)}
+			for _, match := range m3uAttribute.FindAllStringSubmatch(attributes, -1) {
+				switch match[1] {
+				case "tvg-name":
+					if match[2] != "" {
+						channel.Name = match[2]
+					}
+				case "group-title":
+					channel.Group = match[2]
+				default:
+					if channel.Attributes == nil {
+						channel.Attributes = make(map[string]string)
+					}
+					channel.Attributes[match[1]] = match[2]
+				}
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			if channel == nil {
+				channel = &Channel{}
+			}
+			channel.URL = line
+			if channel.Name == "" {
+				channel.Name = line
+			}
+			channels = append(channels, *channel)
+			channel = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, newScannerError(err, "error reading m3u channel list")
+	}
+	return channels, nil
+}
+
+// BatchOptions configures ScanBatch.
+type BatchOptions struct {
+	// MaxConcurrency is the limit of segment requests in flight across
+	// all channels, and of channels being scanned at the same time.
+	MaxConcurrency int64
+	// Sample scans a sample of the segments of each channel with Random
+	// instead of every segment with Scan.
+	Sample *Sample
+	// ChannelSample returns the sample of a single channel, or nil to
+	// scan every segment. It is used instead of Sample when set.
+	ChannelSample func(channel Channel) *Sample
+	// Options are applied to the scanner of every channel.
+	Options []Option
+	// ChannelOptions returns options for the scanner of a single channel
+	// that are applied after Options. A channel whose options fail is
+	// reported with the error and not scanned.
+	ChannelOptions func(channel Channel) ([]Option, error)
+	// Logger is the logger of the batch and the default logger of the
+	// scanner of every channel.
+	Logger *slog.Logger
+	// Context cancels the batch and the requests of every channel. It
+	// defaults to context.Background().
+	Context context.Context
+}
+
+// ChannelReport is the result of scanning one channel of a batch.
+type ChannelReport struct {
+	Channel Channel `json:"channel"`
+	Error   string  `json:"error,omitempty"`
+	Report  *Report `json:"report,omitempty"`
+}
+
+// OK returns true when the channel was scanned and no segment failed.
+func (c *ChannelReport) OK() bool {
+	return c.Error == "" && c.Report != nil && c.Report.Failures() == 0
+}
+
+// BatchReport is the combined report of a batch keyed by channel name.
+type BatchReport struct {
+	Started  time.Time                 `json:"started"`
+	Finished time.Time                 `json:"finished"`
+	Channels map[string]*ChannelReport `json:"channels"`
+}
+
+// ScanBatch scans every channel and returns one report keyed by channel
+// name. Channels that cannot be scanned are reported with their error
+// rather than stopping the batch. Channels with the same name are keyed
+// with a #2, #3... suffix.
+func ScanBatch(channels []Channel, options BatchOptions) (*BatchReport, error) {
+	report := &BatchReport{
+		Started:  time.Now(),
+		Channels: make(map[string]*ChannelReport),
+	}
+	if len(channels) == 0 {
+		return report, newScannerError(errors.New("no channels to scan"), "batch")
+	}
+	if options.MaxConcurrency < 1 {
+		options.MaxConcurrency = 1
+	}
+
+	keys := make([]string, len(channels))
+	seen := make(map[string]int)
+	for i, channel := range channels {
+		key := channel.Name
+		if key == "" {
+			key = channel.URL
+		}
+		seen[key]++
+		if seen[key] > 1 {
+			key = fmt.Sprintf("%s #%d", key, seen[key])
+		}
+		keys[i] = key
+	}
+
+	// requests draw from the budget while channels are limited separately
+	// so playlist fetches of waiting channels do not starve segment requests
+	budget := semaphore.NewWeighted(options.MaxConcurrency)
+	sem := semaphore.NewWeighted(options.MaxConcurrency)
+	if options.Context == nil {
+		options.Context = context.Background()
+	}
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for i, channel := range channels {
+		if err := sem.Acquire(options.Context, 1); err != nil {
+			wg.Wait()
+			report.Finished = time.Now()
+			return report, newScannerError(err, "could not acquire semaphore while scanning channels")
+		}
+		wg.Add(1)
+		go func(key string, channel Channel) {
+			defer wg.Done()
+			defer sem.Release(1)
+			result := scanChannel(key, channel, options, budget)
+			mutex.Lock()
+			report.Channels[key] = result
+			mutex.Unlock()
+		}(keys[i], channel)
+	}
+	wg.Wait()
+	report.Finished = time.Now()
+	return report, nil
+}
+
+// scanChannel scans a channel of a batch that is reported under key
+func scanChannel(key string, channel Channel, options BatchOptions, budget *semaphore.Weighted) *ChannelReport {
+	result := &ChannelReport{Channel: channel}
+	scannerOptions := append([]Option{WithLogger(options.Logger), WithContext(options.Context), WithChannel(key)}, options.Options...)
+	scannerOptions = append(scannerOptions, WithBudget(budget))
+	if options.ChannelOptions != nil {
+		channelOptions, err := options.ChannelOptions(channel)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		scannerOptions = append(scannerOptions, channelOptions...)
+	}
+	scanner, err := New(channel.URL, options.MaxConcurrency, scannerOptions...)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	sample := options.Sample
+	if options.ChannelSample != nil {
+		sample = options.ChannelSample(channel)
+	}
+	if sample != nil {
+		_, err = scanner.Random(*sample)
+	} else {
+		_, err = scanner.Scan()
+	}
+	if err != nil {
+		orDiscard(options.Logger).Warn("error scanning channel", "channel", channel.Name, "url", channel.URL, "error", err)
+		result.Error = err.Error()
+	}
+	result.Report = scanner.Report()
+	return result
+}
+
+// failed returns a result for a channel that could not be scanned, so
+// the channel has a row in reports of segments, or nil
+func (c *ChannelReport) failed() *SegmentResult {
+	if c.Error == "" || (c.Report != nil && len(c.Report.Streams) > 0) {
+		return nil
+	}
+	return &SegmentResult{Name: c.Channel.URL, URL: c.Channel.URL, Error: c.Error}
+}
+
+// results returns the segment results of a channel, or the result of a
+// channel that could not be scanned
+func (c *ChannelReport) results() []SegmentResult {
+	if result := c.failed(); result != nil {
+		return []SegmentResult{*result}
+	}
+	if c.Report == nil {
+		return nil
+	}
+	return c.Report.Results()
+}
+
+// Keys returns the channel keys of the report in sorted order.
+func (b *BatchReport) Keys() []string {
+	keys := make([]string, 0, len(b.Channels))
+	for key := range b.Channels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Failures returns the number of channels that could not be scanned or
+// have failing segments.
+func (b *BatchReport) Failures() int {
+	var failures int
+	for _, channel := range b.Channels {
+		if !channel.OK() {
+			failures++
+		}
+	}
+	return failures
+}
+
+// Write renders the batch report in the given format. The csv and
+// ndjson formats have a row per segment with a channel column and junit
+// has a test suite per channel and stream. Channels that could not be
+// scanned are a single failing row, line or test case with the url of
+// the channel and its error.
+func (b *BatchReport) Write(w io.Writer, format ReportFormat) error {
+	switch format {
+	case ReportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(b)
+	case ReportNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, key := range b.Keys() {
+			for _, result := range b.Channels[key].results() {
+				line := struct {
+					Channel string `json:"channel"`
+					SegmentResult
+				}{key, result}
+				if err := encoder.Encode(line); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case ReportCSV:
+		prefix := [][]string{{"channel"}}
+		var results []SegmentResult
+		for _, key := range b.Keys() {
+			for _, result := range b.Channels[key].results() {
+				prefix = append(prefix, []string{key})
+				results = append(results, result)
+			}
+		}
+		return writeCSV(w, prefix, results)
+	case ReportJUnit:
+		var streams []StreamReport
+		for _, key := range b.Keys() {
+			channel := b.Channels[key]
+			if result := channel.failed(); result != nil {
+				streams = append(streams, StreamReport{Name: key, Segments: []SegmentResult{*result}})
+				continue
+			}
+			if channel.Report == nil {
+				continue
+			}
+			for _, stream := range channel.Report.Streams {
+				stream.Name = fmt.Sprintf("%s/%s", key, stream.Name)
+				streams = append(streams, stream)
+			}
+		}
+		return writeJUnit(w, "batch", b.Started, streams)
+	case ReportHTML:
+		return newScannerError(errors.New("html reports are only available for a single channel"), "batch")
+	default:
+		return newScannerError(errors.New("unknown report format"), format.String())
+	}
+}
@@ -0,0 +1,161 @@
+package ottscanner
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     string
+		expected []Channel
+	}{
+		{
+			name: "text",
+			list: "# channels\nhttp://origin/a.m3u8\n\nhttp://origin/b.mpd\n",
+			expected: []Channel{
+				{Name: "http://origin/a.m3u8", URL: "http://origin/a.m3u8"},
+				{Name: "http://origin/b.mpd", URL: "http://origin/b.mpd"},
+			},
+		},
+		{
+			name: "csv",
+			list: "name,url,group,region\nNews,http://origin/news.m3u8,Info,us\n",
+			expected: []Channel{
+				{Name: "News", URL: "http://origin/news.m3u8", Group: "Info", Attributes: map[string]string{"region": "us"}},
+			},
+		},
+		{
+			name: "m3u",
+			list: "#EXTM3U\n" +
+				"#EXTINF:-1 tvg-id=\"news.us\" tvg-name=\"News\" group-title=\"Info, Local\",News HD\n" +
+				"http://origin/news.m3u8\n" +
+				"#EXTINF:-1,Sports\n" +
+				"http://origin/sports.m3u8\n",
+			expected: []Channel{
+				{Name: "News", URL: "http://origin/news.m3u8", Group: "Info, Local", Attributes: map[string]string{"tvg-id": "news.us"}},
+				{Name: "Sports", URL: "http://origin/sports.m3u8"},
+			},
+		},
+	}
+	for _, test := range tests {
+		channels, err := ReadChannels(strings.NewReader(test.list))
+		if err != nil {
+			t.Fatal(test.name, err)
+		}
+		if !reflect.DeepEqual(test.expected, channels) {
+			t.Fatalf("%s expected: %+v, got: %+v", test.name, test.expected, channels)
+		}
+	}
+
+	if _, err := ReadChannels(strings.NewReader("name,url\nNews,\n")); err == nil {
+		t.Fatal("expected error for csv channel without url")
+	}
+}
+
+func TestScanBatch(t *testing.T) {
+	origin := newTestOrigin(t)
+	channels := []Channel{
+		{Name: "origin", URL: origin.URL + "/master.m3u8"},
+		{Name: "origin", URL: origin.URL + "/master.m3u8"},
+		{Name: "unknown", URL: origin.URL + "/channel"},
+	}
+	report, err := ScanBatch(channels, BatchOptions{MaxConcurrency: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"origin", "origin #2", "unknown"}
+	if !reflect.DeepEqual(expected, report.Keys()) {
+		t.Fatalf("expected: %v, got: %v", expected, report.Keys())
+	}
+	if !report.Channels["origin #2"].OK() || report.Channels["unknown"].OK() {
+		t.Fatalf("unexpected channel results: %+v", report.Channels)
+	}
+	if report.Failures() != 1 {
+		t.Fatalf("expected: 1 failure, got: %d", report.Failures())
+	}
+
+	var out bytes.Buffer
+	if err := report.Write(&out, ReportJUnit); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `testsuite name="origin #2/high.m3u8"`) || !strings.Contains(out.String(), `testsuite name="unknown"`) {
+		t.Fatalf("unexpected junit report: %s", out.String())
+	}
+
+	// the channel that could not be scanned has a line and a row
+	out.Reset()
+	if err := report.Write(&out, ReportNDJSON); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4*testOriginSegments+1 || !strings.Contains(lines[len(lines)-1], `"channel":"unknown"`) ||
+		!strings.Contains(lines[len(lines)-1], `"error":"`) {
+		t.Fatalf("expected a line of the unknown channel with its error, got: %s", lines[len(lines)-1])
+	}
+	out.Reset()
+	if err := report.Write(&out, ReportCSV); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(rows) != 4*testOriginSegments+2 || !strings.HasPrefix(rows[len(rows)-1], "unknown,") ||
+		!strings.Contains(rows[len(rows)-1], report.Channels["unknown"].Error) {
+		t.Fatalf("expected a row of the unknown channel with its error, got: %s", rows[len(rows)-1])
+	}
+}
+
+func TestScanBatch_ChannelSample(t *testing.T) {
+	origin := newTestOrigin(t)
+	channels := []Channel{
+		{Name: "sampled", URL: origin.URL + "/master.m3u8"},
+		{Name: "scanned", URL: origin.URL + "/master.m3u8"},
+	}
+	report, err := ScanBatch(channels, BatchOptions{
+		MaxConcurrency: 4,
+		Sample:         &Sample{Strategy: SampleUniform, Count: 3},
+		ChannelSample: func(channel Channel) *Sample {
+			if channel.Name == "sampled" {
+				return &Sample{Strategy: SampleUniform, Count: 1, Seed: 1}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := report.Channels["sampled"].Report.Results(); len(results) != 1 {
+		t.Errorf("expected 1 sampled segment, got: %d", len(results))
+	}
+	if results := report.Channels["scanned"].Report.Results(); len(results) != 2*testOriginSegments {
+		t.Errorf("expected every segment to be scanned, got: %d", len(results))
+	}
+}
+
+func TestScanBatch_Context(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	channels := []Channel{{Name: "stuck", URL: server.URL + "/master.m3u8"}, {Name: "waiting", URL: server.URL + "/master.m3u8"}}
+	started := time.Now()
+	report, err := ScanBatch(channels, BatchOptions{MaxConcurrency: 1, Context: ctx})
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("expected the batch to be cancelled, took: %v", elapsed)
+	}
+	if err == nil && report.Failures() != len(channels) {
+		t.Errorf("expected every channel to fail, got: %+v", report.Channels)
+	}
+	if channel := report.Channels["stuck"]; channel == nil || !strings.Contains(channel.Error, "context deadline exceeded") {
+		t.Errorf("expected the scan to be cancelled, got: %+v", channel)
+	}
+}
@@ -0,0 +1,851 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jkittell/ottscanner"
+	"github.com/jkittell/toolbox"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// exit codes of the non-interactive commands
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitError  = 2
+)
+
+const usage = `usage: ottscanner <command> [flags] <url>
+       ottscanner <command> -config <file> [flags] <stream name>
+       ottscanner batch [flags] <channel list>
+       ottscanner monitor [flags] <channel list>
+       ottscanner batch|monitor -config <file> [flags]
+       ottscanner serve [flags]
+       ottscanner history -history <file> [flags] [channel]
+       ottscanner diff [flags] <before report> <after report>
+
+commands:
+  streams   print the ABR streams
+  segments  print the segments of every stream
+  scan      check every segment responds
+  download  download every segment
+  random    check a sample of the segments
+  emulate   emulate playback, or a load test with -viewers
+  batch     scan every channel of a text, csv or m3u channel list
+  monitor   keep scanning the channels of a channel list on a schedule
+  serve     run a REST API to submit and query scan jobs
+  history   print the trend, availability and failing streams of a channel
+  diff      compare two json scan reports, such as before and after a change
+
+streams, headers, auth, timeouts, checks and thresholds can be kept in a
+yaml or json config file. Flags that are set win over the config.
+
+exit codes: 0 ok, 1 segments failed, 2 the command could not run
+
+run "ottscanner <command> -h" for the flags of a command
+`
+
+// headerFlags collects repeated -H "Name: value" flags
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	var headers []string
+	for k, v := range h {
+		headers = append(headers, fmt.Sprintf("%s: %s", k, v))
+	}
+	sort.Strings(headers)
+	return strings.Join(headers, ", ")
+}
+
+func (h headerFlags) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header must look like \"Name: value\": %s", value)
+	}
+	h[strings.TrimSpace(name)] = strings.TrimSpace(v)
+	return nil
+}
+
+// listFlags collects a repeated flag
+type listFlags []string
+
+func (l *listFlags) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlags) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type options struct {
+	config       *ottscanner.Config
+	configFile   string
+	tags         string
+	stream       ottscanner.StreamConfig
+	configSample *ottscanner.Sample
+	concurrency  int64
+	directory    string
+	headers      headerFlags
+	format       string
+	retries      int
+	backoff      time.Duration
+	rate         float64
+	burst        int
+	propagate    bool
+	limiter      *ottscanner.RateLimiter
+	proxy        string
+	proxyURL     *url.URL
+	tls          ottscanner.TLSOptions
+	tlsConfig    *tls.Config
+	resolve      listFlags
+	resolves     []ottscanner.Resolve
+	edges        bool
+	deep         bool
+	streamFormat string
+	logLevel     string
+	logger       *slog.Logger
+
+	strategy string
+	count    int
+	percent  float64
+	seed     int64
+
+	profile  string
+	segments int
+	startup  int
+	simulate bool
+	viewers  int
+	jitter   time.Duration
+
+	schedule  string
+	threshold int
+	webhooks  listFlags
+	realert   time.Duration
+	metrics   string
+
+	address string
+	workers int
+	queue   int
+	store   string
+
+	historyFile string
+	history     *ottscanner.History
+	since       time.Duration
+	step        time.Duration
+
+	after            string
+	latencyThreshold float64
+	minIncrease      time.Duration
+}
+
+func (o *options) flags(command string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Int64Var(&o.concurrency, "concurrency", 10, "maximum number of requests in flight")
+	fs.Var(o.headers, "H", "header sent with every request, \"Name: value\" (repeatable)")
+	fs.StringVar(&o.configFile, "config", "", "yaml or json config file")
+	if command != "history" && command != "diff" {
+		fs.IntVar(&o.retries, "retries", 0, "retries of requests that failed with a connection error, a timeout or a 408, 429 or 5xx status")
+		fs.DurationVar(&o.backoff, "retry-backoff", 200*time.Millisecond, "delay before the first retry, doubled with every retry")
+		fs.Float64Var(&o.rate, "rate", 0, "maximum requests per second to each host across every stream (default no limit)")
+		fs.IntVar(&o.burst, "burst", 1, "largest burst of requests to a host under -rate")
+		fs.BoolVar(&o.propagate, "propagate-query", false, "add the query parameters of the url, such as a token, to variant and segment requests")
+		fs.StringVar(&o.proxy, "proxy", "", "http, https or socks5 proxy url for every request (default the HTTP_PROXY and HTTPS_PROXY environment)")
+		fs.StringVar(&o.tls.CAFile, "ca-file", "", "PEM file of CA certificates trusted in addition to the system roots")
+		fs.StringVar(&o.tls.CertFile, "cert", "", "PEM client certificate for origins that require mutual TLS")
+		fs.StringVar(&o.tls.KeyFile, "key", "", "PEM key of the -cert client certificate")
+		fs.BoolVar(&o.tls.Insecure, "insecure", false, "skip verification of origin certificates, for staging origins only")
+		fs.StringVar(&o.streamFormat, "stream-format", "", "hls or dash instead of detecting the format of the url")
+		fs.Var(&o.resolve, "resolve", "send requests for host:port to ip instead of resolving the host, as host:port:ip (repeatable)")
+		fs.StringVar(&o.logLevel, "log-level", "", "log requests and errors to stderr at debug, info, warn or error level (default no logs)")
+	}
+	if command == "batch" || command == "monitor" {
+		fs.StringVar(&o.tags, "tag", "", "only the config streams with one of these comma separated tags")
+	}
+	switch command {
+	case "scan", "random", "emulate", "batch":
+		fs.StringVar(&o.format, "format", "text", "output format: text, json, ndjson, csv, junit or html")
+	case "history", "diff":
+		fs.StringVar(&o.format, "format", "text", "output format: text or json")
+	}
+	switch command {
+	case "scan", "random", "batch", "monitor":
+		fs.BoolVar(&o.deep, "deep", false, "download every checked segment and validate its length and MPEG-TS or fMP4 structure")
+	}
+	if command == "scan" || command == "random" {
+		fs.BoolVar(&o.edges, "edges", false, "scan once through every address the host resolves to and report each edge")
+	}
+	switch command {
+	case "download":
+		fs.StringVar(&o.directory, "dir", "", "directory to download into (default a temporary directory)")
+	case "random":
+		fs.StringVar(&o.strategy, "strategy", "percent", "sample strategy: uniform, per-stream, first-middle-last or percent")
+		fs.IntVar(&o.count, "count", 1, "segments to sample for uniform and per-stream")
+		fs.Float64Var(&o.percent, "percent", 5, "percent of segments to sample")
+		fs.Int64Var(&o.seed, "seed", time.Now().UnixNano(), "seed for reproducible samples")
+	case "emulate":
+		fs.StringVar(&o.profile, "profile", "", "network profile name (3g, 4g, wifi-flaky) or bandwidth trace file")
+		fs.IntVar(&o.segments, "segments", 10, "number of segments to play")
+		fs.IntVar(&o.startup, "startup", 2, "segments buffered before playback starts")
+		fs.BoolVar(&o.simulate, "simulate", false, "account for the network profile on a virtual clock instead of throttling downloads")
+		fs.IntVar(&o.viewers, "viewers", 1, "number of concurrent viewers for a load test")
+		fs.DurationVar(&o.jitter, "jitter", 0, "longest random delay before a viewer starts")
+		fs.Int64Var(&o.seed, "seed", 1, "seed for reproducible load tests")
+	case "monitor":
+		fs.StringVar(&o.schedule, "schedule", "5m", "interval or cron expression, overridden by a schedule column of the channel list")
+		fs.IntVar(&o.threshold, "threshold", 1, "failed scans in a row before a channel is failing")
+		fs.Var(&o.webhooks, "webhook", "url to post alerts to when a channel fails or recovers (repeatable)")
+		fs.DurationVar(&o.realert, "realert", 0, "repeat alerts of channels still failing after this interval")
+		fs.StringVar(&o.metrics, "metrics", "", "address to serve prometheus metrics on at /metrics, such as :9090")
+		fs.Float64Var(&o.percent, "percent", 0, "percent of segments to sample per scan (default every segment)")
+		fs.Int64Var(&o.seed, "seed", time.Now().UnixNano(), "seed for reproducible samples")
+	case "serve":
+		fs.StringVar(&o.address, "addr", ":8080", "address to listen on")
+		fs.IntVar(&o.workers, "workers", 2, "number of jobs run at the same time")
+		fs.IntVar(&o.queue, "queue", 100, "number of jobs that may wait for a worker")
+		fs.StringVar(&o.store, "store", "", "directory to keep jobs in (default in memory)")
+		fs.StringVar(&o.directory, "dir", "", "directory for the segments of download jobs (default a temporary directory)")
+	case "batch":
+		fs.Float64Var(&o.percent, "percent", 0, "percent of segments to sample per channel (default every segment)")
+		fs.Int64Var(&o.seed, "seed", time.Now().UnixNano(), "seed for reproducible samples")
+	case "history":
+		fs.DurationVar(&o.since, "since", 24*time.Hour, "how far back to summarize")
+		fs.DurationVar(&o.step, "step", time.Hour, "step of the trend")
+	case "diff":
+		fs.Float64Var(&o.latencyThreshold, "threshold", 20, "percent increase of the p50 or p90 latency of a stream that is a regression")
+		fs.DurationVar(&o.minIncrease, "min-increase", 10*time.Millisecond, "smallest latency increase that is a regression")
+	}
+	switch command {
+	case "scan", "random", "batch", "monitor", "serve", "history":
+		fs.StringVar(&o.historyFile, "history", "", "scan history database file")
+	}
+	return fs
+}
+
+// parse reads the flags and the url. Flags are accepted before
+// and after the url. With a config the url may be the name of a
+// stream of the config, and batch and monitor may leave out the
+// channel list to use the streams of the config. diff takes a before
+// and an after report.
+func (o *options) parse(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	var inputs []string
+	for fs.NArg() > 0 {
+		inputs = append(inputs, fs.Arg(0))
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return "", err
+		}
+	}
+	max := 1
+	if fs.Name() == "diff" {
+		max = 2
+	}
+	if len(inputs) > max {
+		return "", fmt.Errorf("unexpected arguments: %s", strings.Join(inputs[max:], " "))
+	}
+	var input string
+	if len(inputs) > 0 {
+		input = inputs[0]
+	}
+	if err := o.loadConfig(fs); err != nil {
+		return "", err
+	}
+	list := fs.Name() == "batch" || fs.Name() == "monitor"
+	switch {
+	case fs.Name() == "diff":
+		if len(inputs) != 2 {
+			return "", errors.New("diff needs a before and an after report")
+		}
+		o.after = inputs[1]
+	case fs.Name() == "history":
+		if o.historyFile == "" {
+			return "", errors.New("missing -history database")
+		}
+		if o.step <= 0 {
+			return "", errors.New("-step must be positive")
+		}
+	case fs.Name() == "serve":
+		if input != "" {
+			return "", fmt.Errorf("unexpected arguments: %s", input)
+		}
+	case input == "" && list && o.config != nil:
+	case input == "" && list:
+		return "", errors.New("missing channel list")
+	case input == "":
+		return "", errors.New("missing url")
+	case !list:
+		o.stream = ottscanner.StreamConfig{URL: input}
+		if o.config != nil {
+			if stream, ok := o.config.Stream(input); ok {
+				o.stream = stream
+				input = stream.URL
+			}
+			o.loadSample(fs)
+		}
+		if _, err := url.ParseRequestURI(input); err != nil {
+			return "", err
+		}
+	}
+	if o.logLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(o.logLevel)); err != nil {
+			return "", fmt.Errorf("unknown log level: %s", o.logLevel)
+		}
+	}
+	if o.proxy != "" {
+		proxy, err := ottscanner.ParseProxy(o.proxy)
+		if err != nil {
+			return "", err
+		}
+		o.proxyURL = proxy
+	}
+	if o.streamFormat != "" {
+		if _, err := ottscanner.ParseContentFormat(o.streamFormat); err != nil {
+			return "", err
+		}
+	}
+	for _, value := range o.resolve {
+		resolve, err := ottscanner.ParseResolve(value)
+		if err != nil {
+			return "", err
+		}
+		o.resolves = append(o.resolves, resolve)
+	}
+	if o.format != "" && o.format != "text" && fs.Name() != "history" && fs.Name() != "diff" {
+		format, err := ottscanner.ParseReportFormat(o.format)
+		if err != nil {
+			return "", err
+		}
+		if format == ottscanner.ReportHTML && (fs.Name() == "batch" || o.edges) {
+			return "", errors.New("html reports are only available for a single channel")
+		}
+	}
+	return input, nil
+}
+
+// run executes a command and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+	command := args[0]
+	switch command {
+	case "streams", "segments", "scan", "download", "random", "emulate", "batch", "monitor", "serve", "history", "diff":
+	default:
+		fmt.Fprintf(stderr, "unknown command: %s\n\n%s", command, usage)
+		return exitError
+	}
+
+	o := &options{headers: headerFlags{}}
+	fs := o.flags(command, stderr)
+	input, err := o.parse(fs, args[1:])
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(stderr, err)
+		}
+		return exitError
+	}
+
+	if o.logLevel != "" {
+		var level slog.Level
+		level.UnmarshalText([]byte(o.logLevel))
+		o.logger = slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+	}
+	if o.rate > 0 {
+		o.limiter = ottscanner.NewRateLimiter(o.rate, o.burst)
+	} else if o.config != nil {
+		o.limiter = o.config.RateLimiter()
+	}
+	if o.tls != (ottscanner.TLSOptions{}) {
+		if o.tlsConfig, err = o.tls.Config(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+	}
+	if o.historyFile != "" {
+		if o.history, err = ottscanner.OpenHistory(o.historyFile); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		o.history.Logger = o.logger
+		defer o.history.Close()
+	}
+	if command == "history" {
+		return runHistory(input, o, stdout, stderr)
+	}
+	if command == "diff" {
+		return runDiff(input, o, stdout, stderr)
+	}
+	if command == "batch" {
+		return runBatch(input, o, stdout, stderr)
+	}
+	if command == "monitor" {
+		return runMonitor(input, o, stdout, stderr)
+	}
+	if command == "serve" {
+		return runServe(o, stdout, stderr)
+	}
+
+	if o.edges {
+		return runEdges(command, input, o, stdout, stderr)
+	}
+
+	options, err := o.scannerOptions(o.stream)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if o.history != nil {
+		// recorded under the name of the config stream like batch and monitor scans
+		if o.stream.Name != "" {
+			options = append(options, ottscanner.WithChannel(o.stream.Name))
+		}
+		options = append(options, ottscanner.WithHistory(o.history))
+	}
+	scanner, err := ottscanner.New(input, o.concurrency, options...)
+	if err != nil {
+		fmt.Fprintln(stderr, "could not start the scanner... ", err)
+		return exitError
+	}
+
+	switch command {
+	case "streams":
+		return runStreams(scanner, stdout, stderr)
+	case "segments":
+		return runSegments(scanner, stdout, stderr)
+	case "scan":
+		var results map[ottscanner.Segment]bool
+		if o.configSample != nil {
+			results, err = scanner.Random(*o.configSample)
+		} else {
+			results, err = scanner.Scan()
+		}
+		if err != nil || o.format == "text" {
+			return printScan(results, err, stdout, stderr)
+		}
+		return writeReport(scanner.Report(), o.format, stdout, stderr)
+	case "random":
+		sample, err := o.sample()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		results, err := scanner.Random(sample)
+		if err != nil || o.format == "text" {
+			return printScan(results, err, stdout, stderr)
+		}
+		return writeReport(scanner.Report(), o.format, stdout, stderr)
+	case "download":
+		return runDownload(scanner, o, stdout, stderr)
+	default:
+		return runEmulate(scanner, o, stdout, stderr)
+	}
+}
+
+// loadConfig reads the -config file and uses its concurrency and
+// thresholds for the flags that were not set.
+func (o *options) loadConfig(fs *flag.FlagSet) error {
+	if o.configFile == "" {
+		return nil
+	}
+	config, err := ottscanner.LoadConfig(o.configFile)
+	if err != nil {
+		return err
+	}
+	o.config = config
+	set := setFlags(fs)
+	if !set["concurrency"] && config.Concurrency > 0 {
+		o.concurrency = config.Concurrency
+	}
+	if !set["threshold"] && config.Thresholds.ConsecutiveFailures > 0 {
+		o.threshold = config.Thresholds.ConsecutiveFailures
+	}
+	if set["schedule"] {
+		// the flag wins over the schedules of the config
+		config.Schedule = o.schedule
+		for i := range config.Streams {
+			config.Streams[i].Schedule = ""
+		}
+	}
+	return nil
+}
+
+// loadSample uses the sample of the config stream when its check is
+// sample. scan samples instead of checking every segment, and random
+// uses it for the sample flags that were not set.
+func (o *options) loadSample(fs *flag.FlagSet) {
+	o.configSample = o.config.StreamSample(o.stream)
+	set := setFlags(fs)
+	if o.configSample == nil || set["strategy"] || set["count"] || set["percent"] {
+		return
+	}
+	o.strategy = o.configSample.Strategy.String()
+	o.count, o.percent, o.seed = o.configSample.Count, o.configSample.Percent, o.configSample.Seed
+}
+
+// setFlags returns the names of the flags set on the command line
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// scannerOptions returns the options of the config for the stream with
+// the -H headers, -retries, -proxy and TLS flags last so they win.
+func (o *options) scannerOptions(stream ottscanner.StreamConfig) ([]ottscanner.Option, error) {
+	options := []ottscanner.Option{ottscanner.WithLogger(o.logger)}
+	if o.config != nil {
+		streamOptions, err := o.config.ScannerOptions(stream)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, streamOptions...)
+	}
+	options = append(options, ottscanner.WithHeaders(o.headers))
+	if o.propagate {
+		options = append(options, ottscanner.WithQueryPropagation())
+	}
+	if o.proxyURL != nil {
+		options = append(options, ottscanner.WithProxy(o.proxyURL))
+	}
+	if o.tlsConfig != nil {
+		options = append(options, ottscanner.WithTLSConfig(o.tlsConfig))
+	}
+	if len(o.resolves) > 0 {
+		options = append(options, ottscanner.WithResolve(o.resolves...))
+	}
+	if o.deep {
+		options = append(options, ottscanner.WithDeepValidation())
+	}
+	if o.streamFormat != "" {
+		format, _ := ottscanner.ParseContentFormat(o.streamFormat)
+		options = append(options, ottscanner.WithFormat(format))
+	}
+	if o.limiter != nil {
+		// one limiter is shared by the scanners of every stream
+		options = append(options, ottscanner.WithRateLimiter(o.limiter))
+	}
+	if o.retries > 0 {
+		options = append(options, ottscanner.WithRetry(ottscanner.RetryPolicy{MaxAttempts: o.retries + 1, Backoff: o.backoff, Jitter: 0.5}))
+	}
+	return options, nil
+}
+
+func (o *options) sample() (ottscanner.Sample, error) {
+	sample := ottscanner.Sample{Count: o.count, Percent: o.percent, Seed: o.seed}
+	strategy, err := ottscanner.ParseSampleStrategy(o.strategy)
+	sample.Strategy = strategy
+	return sample, err
+}
+
+func runStreams(scanner *ottscanner.Scanner, stdout, stderr io.Writer) int {
+	streams, err := scanner.Streams()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	for _, s := range streams {
+		fmt.Fprintln(stdout, s.Name())
+	}
+	return exitOK
+}
+
+func runSegments(scanner *ottscanner.Scanner, stdout, stderr io.Writer) int {
+	segments, err := scanner.Segments()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	for _, s := range segments {
+		fmt.Fprintln(stdout, s.URL())
+	}
+	return exitOK
+}
+
+// printScan prints the scanned segments ordered by stream and url and
+// returns exitFailed when any segment failed.
+func printScan(results map[ottscanner.Segment]bool, err error, stdout, stderr io.Writer) int {
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	segments := make([]ottscanner.Segment, 0, len(results))
+	for segment := range results {
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].Stream() != segments[j].Stream() {
+			return segments[i].Stream() < segments[j].Stream()
+		}
+		return segments[i].URL() < segments[j].URL()
+	})
+
+	code := exitOK
+	for _, segment := range segments {
+		if results[segment] {
+			fmt.Fprintln(stdout, segment.URL(), "...", color.GreenString("OK"))
+		} else {
+			fmt.Fprintln(stdout, segment.URL(), "...", color.RedString("ERR"))
+			code = exitFailed
+		}
+	}
+	return code
+}
+
+// writeReport renders a report in a machine-readable format and returns
+// exitFailed when any segment failed.
+func writeReport(report *ottscanner.Report, name string, stdout, stderr io.Writer) int {
+	format, err := ottscanner.ParseReportFormat(name)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if err := report.Write(stdout, format); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if report.Failures() > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+func runDownload(scanner *ottscanner.Scanner, o *options, stdout, stderr io.Writer) int {
+	directory := o.directory
+	if directory == "" {
+		directory = toolbox.TempDir()
+	}
+	if err := scanner.Download(directory, o.concurrency); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	code := exitOK
+	for _, downloads := range scanner.Files() {
+		for _, download := range downloads {
+			if err := download.Error(); err != nil {
+				fmt.Fprintln(stdout, err, "...", color.RedString("ERR"))
+				code = exitFailed
+			}
+		}
+	}
+	fmt.Fprintln(stdout, "segments download to ", directory)
+	return code
+}
+
+func runEmulate(scanner *ottscanner.Scanner, o *options, stdout, stderr io.Writer) int {
+	playback := ottscanner.PlaybackOptions{
+		Simulated:       o.simulate,
+		Segments:        o.segments,
+		StartupSegments: o.startup,
+	}
+	if o.profile != "" {
+		profile, err := ottscanner.NetworkProfileByName(o.profile)
+		if err != nil {
+			profile, err = ottscanner.LoadNetworkProfile(o.profile)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		playback.Profile = profile
+	}
+
+	if o.viewers > 1 {
+		report, err := scanner.LoadTest(ottscanner.LoadTestOptions{
+			Viewers:  o.viewers,
+			Jitter:   o.jitter,
+			Seed:     o.seed,
+			Playback: playback,
+		})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		code := exitOK
+		if report.Errors > 0 || report.FailedViewers > 0 {
+			code = exitFailed
+		}
+		switch o.format {
+		case "text":
+		case "json":
+			encoder := json.NewEncoder(stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				fmt.Fprintln(stderr, err)
+				return exitError
+			}
+			return code
+		default:
+			fmt.Fprintf(stderr, "load tests only support text and json output: %s\n", o.format)
+			return exitError
+		}
+		fmt.Fprintf(stdout, "viewers: %d (%d failed, %d rebuffered)\n", report.Viewers, report.FailedViewers, report.ViewersRebuffered)
+		fmt.Fprintf(stdout, "requests: %d (%.1f/s)\n", report.Requests, report.RequestRate)
+		fmt.Fprintf(stdout, "errors: %d (%.2f%%)\n", report.Errors, report.ErrorRate*100)
+		fmt.Fprintf(stdout, "latency: p50 %v p90 %v p99 %v max %v\n", report.Latency.P50, report.Latency.P90, report.Latency.P99, report.Latency.Max)
+		fmt.Fprintf(stdout, "rebuffers: %d (%v)\n", report.Rebuffers, report.RebufferTime)
+		return code
+	}
+
+	report, err := scanner.EmulatePlayback(playback)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if o.format != "text" {
+		return writeReport(report.ToReport(), o.format, stdout, stderr)
+	}
+	code := exitOK
+	for _, segment := range report.Segments {
+		status := color.GreenString("OK")
+		if segment.Error != "" {
+			status = color.RedString("ERR")
+			code = exitFailed
+		}
+		fmt.Fprintf(stdout, "%s ... %s %v buffer %v\n", segment.URL, status, segment.DownloadTime, segment.Buffer)
+	}
+	fmt.Fprintf(stdout, "startup: %v rebuffers: %d (%v) switches: %d\n", report.StartupTime, report.Rebuffers, report.RebufferTime, report.Switches)
+	return code
+}
+
+// channels returns the channels of the channel list, or the streams of
+// the config with one of the -tag tags when there is no list.
+func (o *options) channels(channelList string) ([]ottscanner.Channel, error) {
+	if channelList != "" {
+		return ottscanner.LoadChannels(channelList)
+	}
+	var tags []string
+	if o.tags != "" {
+		tags = strings.Split(o.tags, ",")
+	}
+	channels := o.config.Channels(tags...)
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("no streams of the config are tagged %s", o.tags)
+	}
+	return channels, nil
+}
+
+// streamConfig returns the config of the stream of a channel, which only has
+// the url when the channel is not in the config
+func (o *options) streamConfig(channel ottscanner.Channel) ottscanner.StreamConfig {
+	if o.config != nil {
+		if stream, ok := o.config.Stream(channel.Name); ok && stream.URL == channel.URL {
+			return stream
+		}
+	}
+	return ottscanner.StreamConfig{URL: channel.URL}
+}
+
+func runBatch(channelList string, o *options, stdout, stderr io.Writer) int {
+	channels, err := o.channels(channelList)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	batch := ottscanner.BatchOptions{
+		MaxConcurrency: o.concurrency,
+		Logger:         o.logger,
+		ChannelOptions: func(channel ottscanner.Channel) ([]ottscanner.Option, error) {
+			return o.scannerOptions(o.streamConfig(channel))
+		},
+	}
+	if o.percent > 0 {
+		// the flag wins over the samples of the config
+		batch.Sample = &ottscanner.Sample{Strategy: ottscanner.SamplePercent, Percent: o.percent, Seed: o.seed}
+	} else if o.config != nil {
+		batch.ChannelSample = func(channel ottscanner.Channel) *ottscanner.Sample {
+			return o.config.StreamSample(o.streamConfig(channel))
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	batch.Context = ctx
+	report, err := ottscanner.ScanBatch(channels, batch)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	if o.history != nil {
+		if err := o.history.RecordBatch(report); err != nil {
+			fmt.Fprintln(stderr, err)
+		}
+	}
+	return printBatch(report, o, stdout, stderr)
+}
+
+// runEdges scans the url through every address of its host, or a
+// sample of the segments with random or a config stream that samples
+func runEdges(command, input string, o *options, stdout, stderr io.Writer) int {
+	options, err := o.scannerOptions(o.stream)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	batch := ottscanner.BatchOptions{MaxConcurrency: o.concurrency, Logger: o.logger, Options: options}
+	if command == "random" {
+		sample, err := o.sample()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		batch.Sample = &sample
+	} else {
+		batch.Sample = o.configSample
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := ottscanner.ScanEdges(ctx, input, nil, batch)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return printBatch(report, o, stdout, stderr)
+}
+
+// printBatch prints a line per channel of a batch, or the report in the
+// -format, and returns exitFailed when any channel failed.
+func printBatch(report *ottscanner.BatchReport, o *options, stdout, stderr io.Writer) int {
+	code := exitOK
+	if report.Failures() > 0 {
+		code = exitFailed
+	}
+	if o.format != "text" {
+		format, _ := ottscanner.ParseReportFormat(o.format)
+		if err := report.Write(stdout, format); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return code
+	}
+	for _, key := range report.Keys() {
+		channel := report.Channels[key]
+		switch {
+		case channel.Error != "":
+			fmt.Fprintln(stdout, key, "...", color.RedString("ERR"), channel.Error)
+		case channel.OK():
+			fmt.Fprintln(stdout, key, "...", color.GreenString("OK"))
+		default:
+			fmt.Fprintln(stdout, key, "...", color.RedString("ERR"), fmt.Sprintf("%d segments failed", channel.Report.Failures()))
+		}
+	}
+	return code
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jkittell/ottscanner"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+check: sample
+sample:
+  strategy: percent
+  percent: 10
+streams:
+  - name: news
+    url: http://origin/news/master.m3u8
+    sample:
+      strategy: uniform
+      count: 2
+  - name: movies
+    url: http://origin/movies/master.m3u8
+    schedule: "0 * * * *"
+`
+
+// writeConfig writes the config into a temporary file and returns its path
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configFile, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+// parseArgs parses the arguments of a command like run does
+func parseArgs(t *testing.T, args ...string) *options {
+	t.Helper()
+	o := &options{headers: headerFlags{}}
+	fs := o.flags(args[0], io.Discard)
+	if _, err := o.parse(fs, args[1:]); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestParse_StreamSample(t *testing.T) {
+	configFile := writeConfig(t, testConfig)
+
+	o := parseArgs(t, "random", "-config", configFile, "news")
+	if o.strategy != "uniform" || o.count != 2 {
+		t.Fatalf("expected the sample of the stream, got: %s %d", o.strategy, o.count)
+	}
+	o = parseArgs(t, "random", "-config", configFile, "movies")
+	if o.strategy != "percent" || o.percent != 10 {
+		t.Fatalf("expected the sample of the config, got: %s %v", o.strategy, o.percent)
+	}
+	o = parseArgs(t, "random", "-config", configFile, "-percent", "50", "news")
+	if o.strategy != "percent" || o.percent != 50 {
+		t.Fatalf("expected the sample flags, got: %s %v", o.strategy, o.percent)
+	}
+	o = parseArgs(t, "scan", "-config", configFile, "news")
+	if o.configSample == nil || o.configSample.Strategy != ottscanner.SampleUniform || o.configSample.Count != 2 {
+		t.Fatalf("expected scan to sample like the stream, got: %+v", o.configSample)
+	}
+}
+
+func TestMonitorTargets(t *testing.T) {
+	configFile := writeConfig(t, "schedule: 1m\n"+testConfig)
+	channelList := filepath.Join(t.TempDir(), "channels.csv")
+	if err := os.WriteFile(channelList, []byte("name,url,schedule\nnews,http://origin/news/master.m3u8,30s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	targets := func(channelList string, args ...string) []ottscanner.MonitorTarget {
+		t.Helper()
+		o := parseArgs(t, append([]string{"monitor", "-config", configFile}, args...)...)
+		channels, err := o.channels(channelList)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets, err := monitorTargets(channels, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return targets
+	}
+
+	config := targets("")
+	if next := config[0].Schedule.Next(from); !next.Equal(from.Add(time.Minute)) {
+		t.Errorf("news should be scanned on the schedule of the config: %v", next)
+	}
+	if next := config[1].Schedule.Next(from); !next.Equal(time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("movies should be scanned on the hour: %v", next)
+	}
+	if sample := config[0].Sample; sample == nil || sample.Strategy != ottscanner.SampleUniform || sample.Count != 2 {
+		t.Errorf("news should be sampled like the stream: %+v", sample)
+	}
+	if sample := config[1].Sample; sample == nil || sample.Strategy != ottscanner.SamplePercent || sample.Percent != 10 {
+		t.Errorf("movies should be sampled like the config: %+v", sample)
+	}
+
+	list := targets(channelList)
+	if next := list[0].Schedule.Next(from); !next.Equal(from.Add(30 * time.Second)) {
+		t.Errorf("the schedule column should win over the config: %v", next)
+	}
+	if sample := list[0].Sample; sample == nil || sample.Strategy != ottscanner.SampleUniform {
+		t.Errorf("a listed stream of the config should be sampled like the stream: %+v", sample)
+	}
+
+	flags := targets("", "-schedule", "10m", "-percent", "50")
+	for _, target := range flags {
+		if next := target.Schedule.Next(from); !next.Equal(from.Add(10 * time.Minute)) {
+			t.Errorf("the -schedule flag should win over the config for %s: %v", target.Channel.Name, next)
+		}
+		if sample := target.Sample; sample == nil || sample.Strategy != ottscanner.SamplePercent || sample.Percent != 50 {
+			t.Errorf("the -percent flag should win over the config for %s: %+v", target.Channel.Name, sample)
+		}
+	}
+}
+
+// testSegments is the number of segments of the test origin
+const testSegments = 4
+
+// newTestOrigin serves a master playlist with one variant whose segments
+// need an X-Token: good header
+func newTestOrigin(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/master.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\nlow.m3u8\n")
+		case r.URL.Path == "/low.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n")
+			for i := 0; i < testSegments; i++ {
+				fmt.Fprintf(w, "#EXTINF:6.0,\nlow_%d.ts\n", i)
+			}
+			fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+		case strings.HasSuffix(r.URL.Path, ".ts") && r.Header.Get("X-Token") == "good":
+			w.Write([]byte("segment"))
+		case strings.HasSuffix(r.URL.Path, ".ts"):
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRun(t *testing.T) {
+	origin := newTestOrigin(t)
+	url := origin.URL + "/master.m3u8"
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string
+	}{
+		{name: "pass", args: []string{"scan", "-H", "X-Token: good", url}, code: exitOK, stdout: "low_0.ts ... OK"},
+		{name: "segment failure", args: []string{"scan", url}, code: exitFailed, stdout: "low_0.ts ... ERR"},
+		{name: "missing playlist", args: []string{"scan", origin.URL + "/missing.m3u8"}, code: exitError},
+		{name: "missing url", args: []string{"scan"}, code: exitError},
+		{name: "unknown flag", args: []string{"scan", "-bogus", url}, code: exitError},
+		{name: "unknown command", args: []string{"bogus", url}, code: exitError},
+		{name: "no command", code: exitError},
+	}
+	for _, test := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(test.args, &stdout, &stderr); code != test.code {
+			t.Errorf("%s expected: %d, got: %d %s", test.name, test.code, code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), test.stdout) {
+			t.Errorf("%s expected %q in: %s", test.name, test.stdout, stdout.String())
+		}
+	}
+}
+
+func TestRun_ConfigPrecedence(t *testing.T) {
+	origin := newTestOrigin(t)
+	configFile := writeConfig(t, fmt.Sprintf(`
+headers:
+  X-Token: bad
+sample:
+  strategy: uniform
+  count: 1
+streams:
+  - name: origin
+    url: %s/master.m3u8
+    check: sample
+    sample:
+      strategy: uniform
+      count: 2
+`, origin.URL))
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"scan", "-config", configFile, "origin"}, &stdout, &stderr); code != exitFailed {
+		t.Errorf("expected the header of the config to fail the segments, got: %d %s", code, stderr.String())
+	}
+	stdout.Reset()
+	if code := run([]string{"scan", "-config", configFile, "-H", "X-Token: good", "origin"}, &stdout, &stderr); code != exitOK {
+		t.Errorf("expected the -H flag to win over the config, got: %d %s", code, stderr.String())
+	}
+	if lines := strings.Count(stdout.String(), "\n"); lines != 2 {
+		t.Errorf("expected the 2 segments of the stream sample, got: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"batch", "-config", configFile, "-H", "X-Token: good", "-format", "ndjson"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected the batch to pass, got: %d %s", code, stderr.String())
+	}
+	if lines := strings.Count(stdout.String(), "\n"); lines != 2 {
+		t.Errorf("expected the batch to sample like the stream, got: %s", stdout.String())
+	}
+	stdout.Reset()
+	if code := run([]string{"batch", "-config", configFile, "-H", "X-Token: good", "-percent", "100", "-format", "ndjson"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected the batch to pass, got: %d %s", code, stderr.String())
+	}
+	if lines := strings.Count(stdout.String(), "\n"); lines != testSegments {
+		t.Errorf("expected the -percent flag to win over the config, got: %s", stdout.String())
+	}
+}
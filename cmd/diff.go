@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jkittell/ottscanner"
+	"io"
+	"os"
+)
+
+// runDiff compares the before and after json reports and returns
+// exitFailed when the after report regressed.
+func runDiff(before string, o *options, stdout, stderr io.Writer) int {
+	var reports []*ottscanner.Report
+	for _, path := range []string{before, o.after} {
+		report, err := readReportFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		reports = append(reports, report)
+	}
+	diff := ottscanner.DiffReports(reports[0], reports[1], ottscanner.DiffOptions{
+		LatencyThreshold:   o.latencyThreshold / 100,
+		MinLatencyIncrease: o.minIncrease,
+	})
+	code := exitOK
+	if diff.Regressed() {
+		code = exitFailed
+	}
+
+	switch o.format {
+	case "text":
+	case "json":
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return code
+	default:
+		fmt.Fprintf(stderr, "diff only supports text and json output: %s\n", o.format)
+		return exitError
+	}
+
+	for _, name := range diff.AddedStreams {
+		fmt.Fprintln(stdout, name, "...", color.GreenString("ADDED"))
+	}
+	for _, name := range diff.RemovedStreams {
+		fmt.Fprintln(stdout, name, "...", color.RedString("REMOVED"))
+	}
+	for _, stream := range diff.Streams {
+		for _, change := range stream.Changes {
+			fmt.Fprintf(stdout, "%s ... %s %s -> %s\n", stream.Name, change.Attribute, change.Before, change.After)
+		}
+		if stream.SegmentsBefore != stream.SegmentsAfter {
+			fmt.Fprintf(stdout, "%s ... segments %d -> %d\n", stream.Name, stream.SegmentsBefore, stream.SegmentsAfter)
+		}
+		if stream.FailuresBefore != stream.FailuresAfter {
+			fmt.Fprintf(stdout, "%s ... failures %d -> %d\n", stream.Name, stream.FailuresBefore, stream.FailuresAfter)
+		}
+		if stream.LatencyRegressed {
+			fmt.Fprintf(stdout, "%s ... %s latency p50 %v -> %v p90 %v -> %v\n", stream.Name, color.RedString("SLOWER"),
+				stream.LatencyBefore.P50, stream.LatencyAfter.P50, stream.LatencyBefore.P90, stream.LatencyAfter.P90)
+		}
+	}
+	for _, segment := range diff.NewlyFailing {
+		fmt.Fprintln(stdout, segment.URL, "...", color.RedString("ERR"), segment.Error)
+	}
+	for _, segment := range diff.Fixed {
+		fmt.Fprintln(stdout, segment.URL, "...", color.GreenString("FIXED"))
+	}
+	if !diff.Changed() {
+		fmt.Fprintln(stdout, "no differences")
+	}
+	return code
+}
+
+func readReportFile(path string) (*ottscanner.Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ottscanner.ReadReport(file)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"io"
+	"time"
+)
+
+// runHistory prints the channels of the history, or the summary of a
+// channel over the -since window with a trend in -step steps. It returns
+// exitFailed when the channel has failing streams.
+func runHistory(channel string, o *options, stdout, stderr io.Writer) int {
+	if channel == "" {
+		channels, err := o.history.Channels()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		for _, channel := range channels {
+			fmt.Fprintln(stdout, channel)
+		}
+		return exitOK
+	}
+
+	now := time.Now()
+	summary, err := o.history.Summary(channel, now.Add(-o.since), now, o.step)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	code := exitOK
+	if len(summary.Failing) > 0 {
+		code = exitFailed
+	}
+	switch o.format {
+	case "text":
+	case "json":
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(summary); err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		return code
+	default:
+		fmt.Fprintf(stderr, "history only supports text and json output: %s\n", o.format)
+		return exitError
+	}
+
+	if summary.Scans == 0 {
+		fmt.Fprintf(stdout, "no scans of %s in the last %v\n", channel, o.since)
+		return code
+	}
+	fmt.Fprintf(stdout, "scans: %d availability: %.2f%% failure rate: %.2f%%\n", summary.Scans, summary.Availability*100, summary.FailureRate*100)
+	for _, point := range summary.Trend {
+		fmt.Fprintf(stdout, "%s  scans %d failed %d  segments %d failed %d (%.2f%%)\n",
+			point.Start.Format(time.RFC3339), point.Scans, point.FailedScans, point.Segments, point.Failures, point.FailureRate*100)
+	}
+	for _, failing := range summary.Failing {
+		status := "no response"
+		if failing.Status != 0 {
+			status = fmt.Sprint(failing.Status)
+		}
+		fmt.Fprintf(stdout, "%s ... %s %s since %s\n", failing.Stream, color.RedString("ERR"), status, failing.Since.Format(time.RFC3339))
+	}
+	return code
+}
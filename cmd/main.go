@@ -4,11 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/fatih/color"
+	"github.com/jkittell/ottscanner"
 	"github.com/jkittell/toolbox"
 	"github.com/nexidian/gocliselect"
 	"net/url"
 	"os"
-	"ottscanner"
 	"runtime"
 	"strings"
 )
@@ -113,5 +113,10 @@ func menu() {
 }
 
 func main() {
-	menu()
+	// without a command fall back to the interactive menu
+	if len(os.Args) < 2 {
+		menu()
+		return
+	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
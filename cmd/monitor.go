@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/jkittell/ottscanner"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// runMonitor scans the channels of the channel list on their schedules
+// until interrupted, printing every scan and state change.
+func runMonitor(channelList string, o *options, stdout, stderr io.Writer) int {
+	channels, err := o.channels(channelList)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	targets, err := monitorTargets(channels, o)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	alerter, err := o.alerter(ctx, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	var metrics *ottscanner.Metrics
+	if o.metrics != "" {
+		metrics = ottscanner.NewMetrics()
+		metrics.Logger = o.logger
+		listener, err := net.Listen("tcp", o.metrics)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		server := &http.Server{Handler: mux}
+		defer server.Close()
+		go server.Serve(listener)
+		fmt.Fprintf(stdout, "serving metrics on http://%s/metrics\n", listener.Addr())
+	}
+
+	// scans finish concurrently so the output is serialized
+	var mutex sync.Mutex
+	var maxFailureRate float64
+	if o.config != nil {
+		maxFailureRate = o.config.Thresholds.FailureRate
+	}
+	monitor, err := ottscanner.NewMonitor(targets, ottscanner.MonitorOptions{
+		MaxConcurrency:   o.concurrency,
+		FailureThreshold: o.threshold,
+		MaxFailureRate:   maxFailureRate,
+		Logger:           o.logger,
+		OnScan: func(health ottscanner.StreamHealth, report *ottscanner.Report, err error) {
+			if alerter != nil {
+				alerter.OnScan(health, report, err)
+			}
+			if metrics != nil {
+				metrics.OnScan(health, report, err)
+			}
+			if o.history != nil {
+				o.history.OnScan(health, report, err)
+			}
+			outcome := health.History[len(health.History)-1]
+			mutex.Lock()
+			defer mutex.Unlock()
+			if outcome.OK {
+				fmt.Fprintf(stdout, "%s %s ... %s %d segments in %v\n", timestamp(), health.Name, color.GreenString("OK"), outcome.Segments, outcome.Duration)
+			} else if outcome.Error != "" {
+				fmt.Fprintf(stdout, "%s %s ... %s %s\n", timestamp(), health.Name, color.RedString("ERR"), outcome.Error)
+			} else {
+				fmt.Fprintf(stdout, "%s %s ... %s %d of %d segments failed\n", timestamp(), health.Name, color.RedString("ERR"), outcome.Failures, outcome.Segments)
+			}
+		},
+		OnTransition: func(transition ottscanner.Transition) {
+			mutex.Lock()
+			fmt.Fprintf(stdout, "%s %s changed from %s to %s\n", timestamp(), transition.Stream, transition.From, transition.To)
+			mutex.Unlock()
+			if alerter != nil {
+				alerter.OnTransition(transition)
+			}
+		},
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	monitor.Run(ctx)
+	return exitOK
+}
+
+// monitorTargets schedules each channel with its schedule column, or
+// interval or cron column, or the schedule of the config, falling back
+// to the -schedule flag.
+func monitorTargets(channels []ottscanner.Channel, o *options) ([]ottscanner.MonitorTarget, error) {
+	var targets []ottscanner.MonitorTarget
+	for _, channel := range channels {
+		stream := o.streamConfig(channel)
+		value := o.schedule
+		if o.config != nil && stream.Schedule != "" {
+			value = stream.Schedule
+		} else if o.config != nil && o.config.Schedule != "" {
+			value = o.config.Schedule
+		}
+		for _, column := range []string{"schedule", "interval", "cron"} {
+			if v, ok := channel.Attributes[column]; ok {
+				value = v
+				break
+			}
+		}
+		schedule, err := ottscanner.ParseSchedule(value)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", channel.Name, err)
+		}
+		options, err := o.scannerOptions(stream)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", channel.Name, err)
+		}
+		target := ottscanner.MonitorTarget{
+			Channel:  channel,
+			Schedule: schedule,
+			Options:  options,
+		}
+		if o.config != nil {
+			target.Sample = o.config.StreamSample(stream)
+		}
+		if o.percent > 0 {
+			target.Sample = &ottscanner.Sample{Strategy: ottscanner.SamplePercent, Percent: o.percent, Seed: o.seed}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// alerter returns an alerter for the -webhook flags and the alerts of
+// the config, or nil when there are none. The -realert flag wins over
+// the config. Alerts in flight are cancelled when ctx is done.
+func (o *options) alerter(ctx context.Context, stderr io.Writer) (*ottscanner.Alerter, error) {
+	var options ottscanner.AlertOptions
+	if o.config != nil {
+		var err error
+		if options, err = o.config.AlertOptions(); err != nil {
+			return nil, err
+		}
+	}
+	for _, url := range o.webhooks {
+		notifier, err := ottscanner.NewWebhook(url, "")
+		if err != nil {
+			return nil, err
+		}
+		options.Notifiers = append(options.Notifiers, notifier)
+	}
+	if len(options.Notifiers) == 0 {
+		return nil, nil
+	}
+	if o.realert > 0 {
+		options.RealertInterval = o.realert
+	}
+	options.Logger = o.logger
+	options.Context = ctx
+	options.OnError = func(alert ottscanner.Alert, err error) {
+		fmt.Fprintf(stderr, "%s %v\n", timestamp(), err)
+	}
+	return ottscanner.NewAlerter(options), nil
+}
+
+func timestamp() string {
+	return time.Now().Format(time.RFC3339)
+}
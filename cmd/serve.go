@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jkittell/ottscanner"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runServe serves the job API until interrupted. The headers, auth and
+// timeout of the config apply to every job.
+func runServe(o *options, stdout, stderr io.Writer) int {
+	options, err := o.scannerOptions(ottscanner.StreamConfig{})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	serverOptions := ottscanner.ServerOptions{
+		Workers:           o.workers,
+		QueueSize:         o.queue,
+		MaxConcurrency:    o.concurrency,
+		DownloadDirectory: o.directory,
+		Options:           options,
+		History:           o.history,
+		Logger:            o.logger,
+	}
+	if o.store != "" {
+		store, err := ottscanner.NewFileJobStore(o.store)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		serverOptions.Store = store
+	}
+	server, err := ottscanner.NewServer(serverOptions)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", o.address)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	httpServer := &http.Server{Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdown)
+	}()
+
+	fmt.Fprintf(stdout, "serving jobs on http://%s/jobs\n", listener.Addr())
+	if o.history != nil {
+		fmt.Fprintf(stdout, "serving history on http://%s/history\n", listener.Addr())
+	}
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,763 @@
+package ottscanner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config describes the streams to scan and how to scan them. It is read
+// from a YAML or JSON file such as
+//
+//	concurrency: 20
+//	timeout: 10s
+//	retry:
+//	  attempts: 3
+//	  backoff: 500ms
+//	rate_limit:
+//	  requests_per_second: 50
+//	  burst: 10
+//	headers:
+//	  User-Agent: ottscanner
+//	auth:
+//	  type: bearer
+//	  token: ${ORIGIN_TOKEN}
+//	propagate_query: true
+//	proxy: socks5://proxy:1080
+//	resolve:
+//	  - cdn.example.com:443:192.0.2.10
+//	tls:
+//	  ca_file: /etc/ottscanner/ca.pem
+//	signing:
+//	  type: akamai
+//	  key: ${EDGE_AUTH_KEY}
+//	  acl: /live/*
+//	check: sample
+//	deep: true
+//	sample:
+//	  strategy: percent
+//	  percent: 10
+//	schedule: 5m
+//	thresholds:
+//	  consecutive_failures: 3
+//	  failure_rate: 0.05
+//	alerts:
+//	  realert: 1h
+//	  webhooks:
+//	    - url: https://hooks.example.com/ottscanner
+//	      body: '{"text": {{json .Summary}}}'
+//	streams:
+//	  - name: news
+//	    url: https://origin/news/master.m3u8
+//	    tags: [live, news]
+//	  - name: movies
+//	    url: https://origin/movies/manifest.mpd
+//	    format: dash
+//	    check: scan
+//	    schedule: "0 * * * *"
+//
+// Settings of a stream override the top level settings and headers are
+// merged. Values of headers and auth may refer to environment variables
+// as $NAME or ${NAME} so secrets can be kept out of the file.
+type Config struct {
+	Concurrency int64        `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	Timeout     string       `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retry       *RetryConfig `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// RateLimit limits the requests to each host across every stream.
+	RateLimit *RateLimitConfig  `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Auth      *AuthConfig       `json:"auth,omitempty" yaml:"auth,omitempty"`
+	// PropagateQuery adds the query parameters of the stream url, such
+	// as a token, to its variant and segment requests.
+	PropagateQuery bool           `json:"propagate_query,omitempty" yaml:"propagate_query,omitempty"`
+	Signing        *SigningConfig `json:"signing,omitempty" yaml:"signing,omitempty"`
+	// Proxy is the url of an http, https or socks5 proxy.
+	Proxy string     `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	TLS   *TLSConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// Resolve are host:port:ip overrides of the address of a host.
+	Resolve []string `json:"resolve,omitempty" yaml:"resolve,omitempty"`
+	// Check is scan to request every segment or sample to request a
+	// sample of the segments. Defaults to scan.
+	Check string `json:"check,omitempty" yaml:"check,omitempty"`
+	// Deep downloads and validates the segments that are checked. See
+	// WithDeepValidation.
+	Deep       bool             `json:"deep,omitempty" yaml:"deep,omitempty"`
+	Sample     *SampleConfig    `json:"sample,omitempty" yaml:"sample,omitempty"`
+	Schedule   string           `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Thresholds ThresholdsConfig `json:"thresholds,omitempty" yaml:"thresholds,omitempty"`
+	Alerts     *AlertsConfig    `json:"alerts,omitempty" yaml:"alerts,omitempty"`
+	Streams    []StreamConfig   `json:"streams" yaml:"streams"`
+}
+
+// StreamConfig is a stream of a config.
+type StreamConfig struct {
+	Name string `json:"name" yaml:"name"`
+	URL  string `json:"url" yaml:"url"`
+	// Format is hls or dash to skip detecting the format of the url.
+	Format  string            `json:"format,omitempty" yaml:"format,omitempty"`
+	Tags    []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Timeout string            `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retry   *RetryConfig      `json:"retry,omitempty" yaml:"retry,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Auth    *AuthConfig       `json:"auth,omitempty" yaml:"auth,omitempty"`
+	// PropagateQuery turns on query propagation for the stream when it
+	// is off at the top level.
+	PropagateQuery bool           `json:"propagate_query,omitempty" yaml:"propagate_query,omitempty"`
+	Signing        *SigningConfig `json:"signing,omitempty" yaml:"signing,omitempty"`
+	Proxy          string         `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	TLS            *TLSConfig     `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Resolve        []string       `json:"resolve,omitempty" yaml:"resolve,omitempty"`
+	Check          string         `json:"check,omitempty" yaml:"check,omitempty"`
+	Deep           bool           `json:"deep,omitempty" yaml:"deep,omitempty"`
+	Sample         *SampleConfig  `json:"sample,omitempty" yaml:"sample,omitempty"`
+	Schedule       string         `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+}
+
+// AuthConfig is the authorization sent with every request, basic with
+// a username and password or bearer with a token.
+type AuthConfig struct {
+	Type     string `json:"type" yaml:"type"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"`
+}
+
+// RetryConfig is the retry policy of failed requests. See RetryPolicy.
+type RetryConfig struct {
+	Attempts   int     `json:"attempts" yaml:"attempts"`
+	Backoff    string  `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	MaxBackoff string  `json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`
+	Jitter     float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	Statuses   []int   `json:"statuses,omitempty" yaml:"statuses,omitempty"`
+}
+
+// RateLimitConfig is the rate limit of the requests to each host. See
+// RateLimiter.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `json:"requests_per_second" yaml:"requests_per_second"`
+	Burst             int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+// SigningConfig signs every request of a stream. Type is hmac or akamai
+// with a Key, or cloudfront with a KeyPairID and the PEM private key in
+// Key or KeyFile. Key may refer to environment variables. See
+// HMACSigner, AkamaiSigner and CloudFrontSigner.
+type SigningConfig struct {
+	Type      string `json:"type" yaml:"type"`
+	Key       string `json:"key,omitempty" yaml:"key,omitempty"`
+	KeyFile   string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	KeyPairID string `json:"key_pair_id,omitempty" yaml:"key_pair_id,omitempty"`
+	Expires   string `json:"expires,omitempty" yaml:"expires,omitempty"`
+	// Cookies sends the signature as cookies instead of in the query.
+	Cookies bool `json:"cookies,omitempty" yaml:"cookies,omitempty"`
+	// ACL is the path pattern of an akamai token, or the resource url
+	// pattern of cloudfront cookies.
+	ACL       string `json:"acl,omitempty" yaml:"acl,omitempty"`
+	TokenName string `json:"token_name,omitempty" yaml:"token_name,omitempty"`
+}
+
+// TLSConfig is the TLS of the requests of a stream. See TLSOptions.
+type TLSConfig struct {
+	CAFile   string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	Insecure bool   `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+}
+
+// SampleConfig is the sample of the sample check. See Sample.
+type SampleConfig struct {
+	Strategy string  `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	Count    int     `json:"count,omitempty" yaml:"count,omitempty"`
+	Percent  float64 `json:"percent,omitempty" yaml:"percent,omitempty"`
+	Seed     int64   `json:"seed,omitempty" yaml:"seed,omitempty"`
+}
+
+// ThresholdsConfig decides when a monitored stream is failing.
+type ThresholdsConfig struct {
+	// ConsecutiveFailures is the number of failed scans in a row before
+	// a stream is failing.
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty" yaml:"consecutive_failures,omitempty"`
+	// FailureRate is the fraction of segments from 0 to 1 that may fail
+	// before a scan counts as failed.
+	FailureRate float64 `json:"failure_rate,omitempty" yaml:"failure_rate,omitempty"`
+}
+
+// AlertsConfig sends alerts of monitored streams to webhooks.
+type AlertsConfig struct {
+	// Realert is the interval to repeat the alert of a stream that is
+	// still failing.
+	Realert  string          `json:"realert,omitempty" yaml:"realert,omitempty"`
+	Webhooks []WebhookConfig `json:"webhooks" yaml:"webhooks"`
+}
+
+// WebhookConfig is a webhook notifier. Body is a template of the request
+// body, see Webhook.
+type WebhookConfig struct {
+	URL     string            `json:"url" yaml:"url"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    string            `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// ConfigError lists every problem found in a config with the path of
+// the entry, such as streams[2].url.
+type ConfigError struct {
+	Problems []string
+}
+
+func (ce *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config: %s", strings.Join(ce.Problems, "; "))
+}
+
+func (ce *ConfigError) add(path, format string, args ...any) {
+	ce.Problems = append(ce.Problems, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+// LoadConfig reads and validates a config file. See ParseConfig.
+func LoadConfig(filePath string) (*Config, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, newScannerError(err, fmt.Sprintf("error reading config: %s", filePath))
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, newScannerError(err, filePath)
+	}
+	return config, nil
+}
+
+// ParseConfig decodes and validates a config. Data starting with { is
+// decoded as JSON and anything else as YAML. Unknown fields are errors
+// so a misspelled setting is not silently ignored.
+func ParseConfig(data []byte) (*Config, error) {
+	config := new(Config)
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(config); err != nil {
+			return nil, newScannerError(err, "error decoding json config")
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, newScannerError(err, "error decoding yaml config")
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks every setting of the config and returns a *ConfigError
+// with all the problems found.
+func (c *Config) Validate() error {
+	problems := new(ConfigError)
+	if c.Concurrency < 0 {
+		problems.add("concurrency", "must not be negative")
+	}
+	validateSettings(problems, "", c.Timeout, c.Headers, c.Auth, c.Check, c.Sample, c.Schedule)
+	validateRetry(problems, "", c.Retry)
+	validateSigning(problems, "", c.Signing)
+	validateTransport(problems, "", c.Proxy, c.TLS, c.Resolve)
+	if c.RateLimit != nil {
+		if c.RateLimit.RequestsPerSecond <= 0 {
+			problems.add("rate_limit.requests_per_second", "must be positive")
+		}
+		if c.RateLimit.Burst < 0 {
+			problems.add("rate_limit.burst", "must not be negative")
+		}
+	}
+	if c.Thresholds.ConsecutiveFailures < 0 {
+		problems.add("thresholds.consecutive_failures", "must not be negative")
+	}
+	if c.Thresholds.FailureRate < 0 || c.Thresholds.FailureRate > 1 {
+		problems.add("thresholds.failure_rate", "must be between 0 and 1")
+	}
+	if c.Alerts != nil {
+		if c.Alerts.Realert != "" {
+			if d, err := time.ParseDuration(c.Alerts.Realert); err != nil || d < 0 {
+				problems.add("alerts.realert", "not a duration: %s", c.Alerts.Realert)
+			}
+		}
+		for i, webhook := range c.Alerts.Webhooks {
+			path := fmt.Sprintf("alerts.webhooks[%d]", i)
+			if u, err := url.ParseRequestURI(webhook.URL); err != nil || u.Host == "" {
+				problems.add(path+".url", "not an absolute url: %s", webhook.URL)
+			}
+			if _, err := ParseAlertTemplate(webhook.Body); err != nil {
+				problems.add(path+".body", "%v", err)
+			}
+		}
+	}
+
+	if len(c.Streams) == 0 {
+		problems.add("streams", "at least one stream is required")
+	}
+	names := make(map[string]int)
+	for i, stream := range c.Streams {
+		path := fmt.Sprintf("streams[%d]", i)
+		if stream.URL == "" {
+			problems.add(path+".url", "is required")
+		} else if u, err := url.ParseRequestURI(stream.URL); err != nil || u.Host == "" {
+			problems.add(path+".url", "not an absolute url: %s", stream.URL)
+		}
+		if stream.Format != "" {
+			if _, err := ParseContentFormat(stream.Format); err != nil {
+				problems.add(path+".format", "must be hls or dash: %q", stream.Format)
+			}
+		}
+		name := stream.name()
+		if name != "" {
+			if first, ok := names[name]; ok {
+				problems.add(path+".name", "%s is already the name of streams[%d]", name, first)
+			} else {
+				names[name] = i
+			}
+		}
+		validateSettings(problems, path+".", stream.Timeout, stream.Headers, stream.Auth, stream.Check, stream.Sample, stream.Schedule)
+		validateRetry(problems, path+".", stream.Retry)
+		validateSigning(problems, path+".", stream.Signing)
+		validateTransport(problems, path+".", stream.Proxy, stream.TLS, stream.Resolve)
+		if stream.Check == "sample" && stream.Sample == nil && c.Sample == nil {
+			problems.add(path+".sample", "is required by the sample check")
+		}
+	}
+	if c.Check == "sample" && c.Sample == nil {
+		problems.add("sample", "is required by the sample check")
+	}
+	if len(problems.Problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// validateSettings checks the settings shared by the config and its streams
+func validateSettings(problems *ConfigError, prefix, timeout string, headers map[string]string, auth *AuthConfig, check string, sample *SampleConfig, schedule string) {
+	if timeout != "" {
+		if d, err := time.ParseDuration(timeout); err != nil || d < 0 {
+			problems.add(prefix+"timeout", "not a duration: %s", timeout)
+		}
+	}
+	for name := range headers {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, ": \t") {
+			problems.add(prefix+"headers", "invalid header name: %q", name)
+		}
+	}
+	if auth != nil {
+		switch auth.Type {
+		case "basic":
+			if auth.Username == "" {
+				problems.add(prefix+"auth.username", "is required for basic auth")
+			}
+		case "bearer":
+			if auth.Token == "" {
+				problems.add(prefix+"auth.token", "is required for bearer auth")
+			}
+		default:
+			problems.add(prefix+"auth.type", "must be basic or bearer: %q", auth.Type)
+		}
+	}
+	switch check {
+	case "", "scan", "sample":
+	default:
+		problems.add(prefix+"check", "must be scan or sample: %q", check)
+	}
+	if sample != nil {
+		if _, err := ParseSampleStrategy(sample.strategy()); err != nil {
+			problems.add(prefix+"sample.strategy", "unknown strategy: %s", sample.Strategy)
+		}
+		if sample.Count < 0 {
+			problems.add(prefix+"sample.count", "must not be negative")
+		}
+		if sample.Percent < 0 || sample.Percent > 100 {
+			problems.add(prefix+"sample.percent", "must be between 0 and 100")
+		}
+	}
+	if schedule != "" {
+		if _, err := ParseSchedule(schedule); err != nil {
+			problems.add(prefix+"schedule", "not an interval or cron expression: %s", schedule)
+		}
+	}
+}
+
+// validateRetry checks the retry policy of the config or a stream
+func validateRetry(problems *ConfigError, prefix string, retry *RetryConfig) {
+	if retry == nil {
+		return
+	}
+	if retry.Attempts < 1 {
+		problems.add(prefix+"retry.attempts", "must be at least 1")
+	}
+	if retry.Backoff != "" {
+		if d, err := time.ParseDuration(retry.Backoff); err != nil || d < 0 {
+			problems.add(prefix+"retry.backoff", "not a duration: %s", retry.Backoff)
+		}
+	}
+	if retry.MaxBackoff != "" {
+		if d, err := time.ParseDuration(retry.MaxBackoff); err != nil || d < 0 {
+			problems.add(prefix+"retry.max_backoff", "not a duration: %s", retry.MaxBackoff)
+		}
+	}
+	if retry.Jitter < 0 || retry.Jitter > 1 {
+		problems.add(prefix+"retry.jitter", "must be between 0 and 1")
+	}
+	for _, status := range retry.Statuses {
+		if status < 100 || status > 599 {
+			problems.add(prefix+"retry.statuses", "not a status code: %d", status)
+		}
+	}
+}
+
+// validateSigning checks the signing of the config or a stream
+func validateSigning(problems *ConfigError, prefix string, signing *SigningConfig) {
+	if signing == nil {
+		return
+	}
+	if signing.Expires != "" {
+		if d, err := time.ParseDuration(signing.Expires); err != nil || d <= 0 {
+			problems.add(prefix+"signing.expires", "not a duration: %s", signing.Expires)
+		}
+	}
+	switch signing.Type {
+	case "hmac", "akamai":
+		if signing.Key == "" {
+			problems.add(prefix+"signing.key", "is required for %s signing", signing.Type)
+		}
+	case "cloudfront":
+		if signing.KeyPairID == "" {
+			problems.add(prefix+"signing.key_pair_id", "is required for cloudfront signing")
+		}
+		if (signing.Key == "") == (signing.KeyFile == "") {
+			problems.add(prefix+"signing.key", "one of key or key_file is required for cloudfront signing")
+			return
+		}
+	default:
+		problems.add(prefix+"signing.type", "must be hmac, cloudfront or akamai: %q", signing.Type)
+		return
+	}
+	if _, err := signing.signer(); err != nil {
+		problems.add(prefix+"signing", "%v", err)
+	}
+}
+
+// validateTransport checks the proxy, the TLS files and the resolve
+// overrides of the config or a stream
+func validateTransport(problems *ConfigError, prefix, proxy string, tls *TLSConfig, resolves []string) {
+	if proxy != "" {
+		if _, err := ParseProxy(proxy); err != nil {
+			problems.add(prefix+"proxy", "%v", err)
+		}
+	}
+	if tls != nil {
+		if _, err := tls.options().Config(); err != nil {
+			problems.add(prefix+"tls", "%v", err)
+		}
+	}
+	for _, resolve := range resolves {
+		if _, err := ParseResolve(resolve); err != nil {
+			problems.add(prefix+"resolve", "%v", err)
+		}
+	}
+}
+
+func (tc *TLSConfig) options() TLSOptions {
+	return TLSOptions{CAFile: tc.CAFile, CertFile: tc.CertFile, KeyFile: tc.KeyFile, Insecure: tc.Insecure}
+}
+
+// signer returns the signer of the config
+func (sc *SigningConfig) signer() (URLSigner, error) {
+	expires, _ := time.ParseDuration(sc.Expires)
+	key := os.ExpandEnv(sc.Key)
+	if sc.Key != "" && key == "" {
+		return nil, fmt.Errorf("signing key %s is empty", sc.Key)
+	}
+	switch sc.Type {
+	case "hmac":
+		return &HMACSigner{Key: []byte(key), Expires: expires}, nil
+	case "akamai":
+		if _, err := hex.DecodeString(key); err != nil {
+			return nil, errors.New("akamai key must be hex encoded")
+		}
+		return &AkamaiSigner{Key: key, TokenName: sc.TokenName, Window: expires, ACL: sc.ACL, Cookie: sc.Cookies}, nil
+	case "cloudfront":
+		privateKey := []byte(key)
+		if sc.KeyFile != "" {
+			data, err := os.ReadFile(sc.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			privateKey = data
+		}
+		signer, err := NewCloudFrontSigner(sc.KeyPairID, privateKey, expires)
+		if err != nil {
+			return nil, err
+		}
+		signer.Cookies = sc.Cookies
+		signer.Resource = sc.ACL
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unknown signing type: %s", sc.Type)
+	}
+}
+
+// policy returns the retry policy of the config
+func (rc *RetryConfig) policy() RetryPolicy {
+	backoff, _ := time.ParseDuration(rc.Backoff)
+	maxBackoff, _ := time.ParseDuration(rc.MaxBackoff)
+	return RetryPolicy{MaxAttempts: rc.Attempts, Backoff: backoff, MaxBackoff: maxBackoff, Jitter: rc.Jitter, Statuses: rc.Statuses}
+}
+
+func (sc *StreamConfig) name() string {
+	if sc.Name == "" {
+		return sc.URL
+	}
+	return sc.Name
+}
+
+func (sc *SampleConfig) strategy() string {
+	if sc.Strategy == "" {
+		return SamplePercent.String()
+	}
+	return sc.Strategy
+}
+
+func (sc *SampleConfig) sample() Sample {
+	strategy, _ := ParseSampleStrategy(sc.strategy())
+	return Sample{Strategy: strategy, Count: sc.Count, Percent: sc.Percent, Seed: sc.Seed}
+}
+
+// header returns the Authorization header value
+func (ac *AuthConfig) header() string {
+	if ac.Type == "basic" {
+		credentials := os.ExpandEnv(ac.Username) + ":" + os.ExpandEnv(ac.Password)
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+	return "Bearer " + os.ExpandEnv(ac.Token)
+}
+
+// Stream returns the stream with the given name.
+func (c *Config) Stream(name string) (StreamConfig, bool) {
+	for _, stream := range c.Streams {
+		if stream.name() == name {
+			return stream, true
+		}
+	}
+	return StreamConfig{}, false
+}
+
+// Channels returns the streams of the config as channels. With tags only
+// the streams that have at least one of the tags are returned.
+func (c *Config) Channels(tags ...string) []Channel {
+	var channels []Channel
+	for _, stream := range c.Streams {
+		if len(tags) > 0 && !hasTag(stream.Tags, tags) {
+			continue
+		}
+		channels = append(channels, Channel{Name: stream.name(), URL: stream.URL, Tags: stream.Tags})
+	}
+	return channels
+}
+
+func hasTag(tags, wanted []string) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if tag == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ScannerOptions returns the options for the scanner of a stream with
+// the headers, auth and timeout of the config and the stream. It returns
+// an error when the signing key, TLS files or proxy of the stream can no
+// longer be loaded, so the stream is not scanned without them.
+func (c *Config) ScannerOptions(stream StreamConfig) ([]Option, error) {
+	headers := make(map[string]string)
+	for k, v := range c.Headers {
+		headers[k] = os.ExpandEnv(v)
+	}
+	for k, v := range stream.Headers {
+		headers[k] = os.ExpandEnv(v)
+	}
+	auth := c.Auth
+	if stream.Auth != nil {
+		auth = stream.Auth
+	}
+	if auth != nil {
+		headers["Authorization"] = auth.header()
+	}
+
+	var options []Option
+	if len(headers) > 0 {
+		options = append(options, WithHeaders(headers))
+	}
+	timeout := c.Timeout
+	if stream.Timeout != "" {
+		timeout = stream.Timeout
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, newScannerError(err, fmt.Sprintf("timeout of %s", stream.name()))
+		}
+		if d > 0 {
+			options = append(options, WithTimeout(d))
+		}
+	}
+	retry := c.Retry
+	if stream.Retry != nil {
+		retry = stream.Retry
+	}
+	if retry != nil {
+		options = append(options, WithRetry(retry.policy()))
+	}
+	if c.PropagateQuery || stream.PropagateQuery {
+		options = append(options, WithQueryPropagation())
+	}
+	signing := c.Signing
+	if stream.Signing != nil {
+		signing = stream.Signing
+	}
+	if signing != nil {
+		signer, err := signing.signer()
+		if err != nil {
+			return nil, newScannerError(err, fmt.Sprintf("signing of %s", stream.name()))
+		}
+		options = append(options, WithURLSigner(signer))
+	}
+	proxy := c.Proxy
+	if stream.Proxy != "" {
+		proxy = stream.Proxy
+	}
+	if proxy != "" {
+		u, err := ParseProxy(proxy)
+		if err != nil {
+			return nil, newScannerError(err, fmt.Sprintf("proxy of %s", stream.name()))
+		}
+		options = append(options, WithProxy(u))
+	}
+	tls := c.TLS
+	if stream.TLS != nil {
+		tls = stream.TLS
+	}
+	if tls != nil {
+		config, err := tls.options().Config()
+		if err != nil {
+			return nil, newScannerError(err, fmt.Sprintf("tls of %s", stream.name()))
+		}
+		options = append(options, WithTLSConfig(config))
+	}
+	if stream.Format != "" {
+		format, err := ParseContentFormat(stream.Format)
+		if err != nil {
+			return nil, newScannerError(err, fmt.Sprintf("format of %s", stream.name()))
+		}
+		options = append(options, WithFormat(format))
+	}
+	if c.Deep || stream.Deep {
+		options = append(options, WithDeepValidation())
+	}
+	// overrides of the stream come first so they win
+	var resolves []Resolve
+	for _, value := range append(append([]string(nil), stream.Resolve...), c.Resolve...) {
+		resolve, err := ParseResolve(value)
+		if err != nil {
+			return nil, newScannerError(err, fmt.Sprintf("resolve of %s", stream.name()))
+		}
+		resolves = append(resolves, resolve)
+	}
+	if len(resolves) > 0 {
+		options = append(options, WithResolve(resolves...))
+	}
+	return options, nil
+}
+
+// StreamSample returns the sample of a stream or nil when the stream is scanned.
+func (c *Config) StreamSample(stream StreamConfig) *Sample {
+	check := c.Check
+	if stream.Check != "" {
+		check = stream.Check
+	}
+	if check != "sample" {
+		return nil
+	}
+	config := c.Sample
+	if stream.Sample != nil {
+		config = stream.Sample
+	}
+	sample := config.sample()
+	return &sample
+}
+
+// RateLimiter returns a new limiter of the rate limit of the config, or
+// nil when there is none. ScannerOptions leaves it out so one limiter
+// can be shared by the scanners of every stream.
+func (c *Config) RateLimiter() *RateLimiter {
+	if c.RateLimit == nil {
+		return nil
+	}
+	return NewRateLimiter(c.RateLimit.RequestsPerSecond, c.RateLimit.Burst)
+}
+
+// BatchOptions returns the options to scan the streams of the config
+// with ScanBatch, each stream with its own options and sample.
+func (c *Config) BatchOptions() BatchOptions {
+	options := BatchOptions{
+		MaxConcurrency: c.Concurrency,
+		ChannelOptions: func(channel Channel) ([]Option, error) {
+			stream, _ := c.Stream(channel.Name)
+			return c.ScannerOptions(stream)
+		},
+		ChannelSample: func(channel Channel) *Sample {
+			stream, _ := c.Stream(channel.Name)
+			return c.StreamSample(stream)
+		},
+	}
+	if limiter := c.RateLimiter(); limiter != nil {
+		options.Options = []Option{WithRateLimiter(limiter)}
+	}
+	return options
+}
+
+// AlertOptions returns the webhooks and re-alert interval of the alerts
+// of the config.
+func (c *Config) AlertOptions() (AlertOptions, error) {
+	var options AlertOptions
+	if c.Alerts == nil {
+		return options, nil
+	}
+	if c.Alerts.Realert != "" {
+		realert, err := time.ParseDuration(c.Alerts.Realert)
+		if err != nil {
+			return options, newScannerError(err, "alerts.realert")
+		}
+		options.RealertInterval = realert
+	}
+	for _, config := range c.Alerts.Webhooks {
+		webhook, err := NewWebhook(config.URL, config.Body)
+		if err != nil {
+			return options, err
+		}
+		if len(config.Headers) > 0 {
+			webhook.Headers = make(map[string]string, len(config.Headers))
+			for k, v := range config.Headers {
+				webhook.Headers[k] = os.ExpandEnv(v)
+			}
+		}
+		options.Notifiers = append(options.Notifiers, webhook)
+	}
+	return options, nil
+}
@@ -0,0 +1,237 @@
+package ottscanner
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testConfig = `
+concurrency: 4
+timeout: 5s
+headers:
+  User-Agent: ottscanner
+auth:
+  type: bearer
+  token: ${OTTSCANNER_TEST_TOKEN}
+check: sample
+sample:
+  strategy: first-middle-last
+schedule: 1m
+thresholds:
+  consecutive_failures: 3
+  failure_rate: 0.25
+streams:
+  - name: news
+    url: http://origin/news/master.m3u8
+    tags: [live, news]
+  - name: movies
+    url: http://origin/movies/manifest.mpd
+    check: scan
+    schedule: "0 * * * *"
+    auth:
+      type: basic
+      username: user
+      password: secret
+`
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Concurrency != 4 || len(config.Streams) != 2 || config.Thresholds.FailureRate != 0.25 {
+		t.Errorf("unexpected config: %+v", config)
+	}
+
+	channels := config.Channels("live")
+	if len(channels) != 1 || channels[0].Name != "news" || len(channels[0].Tags) != 2 {
+		t.Errorf("unexpected tagged channels: %+v", channels)
+	}
+
+	news, _ := config.Stream("news")
+	if sample := config.StreamSample(news); sample == nil || sample.Strategy != SampleFirstMiddleLast {
+		t.Errorf("news should be sampled first, middle and last: %+v", sample)
+	}
+	movies, _ := config.Stream("movies")
+	if sample := config.StreamSample(movies); sample != nil {
+		t.Errorf("movies should be scanned: %+v", sample)
+	}
+
+	batch := config.BatchOptions()
+	if sample := batch.ChannelSample(channels[0]); sample == nil || sample.Strategy != SampleFirstMiddleLast {
+		t.Errorf("news should be sampled first, middle and last in a batch: %+v", sample)
+	}
+	if sample := batch.ChannelSample(Channel{Name: "movies"}); sample != nil {
+		t.Errorf("movies should be scanned in a batch: %+v", sample)
+	}
+}
+
+func TestParseConfigJSON(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"streams": [{"url": "http://origin/a.m3u8"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream, ok := config.Stream("http://origin/a.m3u8"); !ok || stream.URL != "http://origin/a.m3u8" {
+		t.Errorf("a stream without a name should be named by its url: %+v", config.Streams)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		problems []string
+	}{
+		{
+			name:     "no streams",
+			config:   "concurrency: 1\n",
+			problems: []string{"streams: at least one stream is required"},
+		},
+		{
+			name: "bad entries",
+			config: "timeout: soon\n" +
+				"thresholds:\n  failure_rate: 2\n" +
+				"streams:\n" +
+				"  - name: a\n    url: http://origin/a.m3u8\n" +
+				"  - name: a\n    url: http://origin/b.m3u8\n" +
+				"  - name: c\n    url: origin/c.m3u8\n    check: all\n    schedule: sometimes\n" +
+				"  - name: d\n    url: http://origin/d.m3u8\n    auth:\n      type: digest\n",
+			problems: []string{
+				"timeout: not a duration: soon",
+				"thresholds.failure_rate: must be between 0 and 1",
+				"streams[1].name: a is already the name of streams[0]",
+				"streams[2].url: not an absolute url: origin/c.m3u8",
+				"streams[2].check: must be scan or sample: \"all\"",
+				"streams[2].schedule: not an interval or cron expression: sometimes",
+				"streams[3].auth.type: must be basic or bearer: \"digest\"",
+			},
+		},
+		{
+			name:   "bad retry",
+			config: "retry:\n  attempts: 0\n  backoff: later\n  jitter: 2\n  statuses: [503, 42]\nstreams:\n  - url: http://origin/a.m3u8\n",
+			problems: []string{
+				"retry.attempts: must be at least 1",
+				"retry.backoff: not a duration: later",
+				"retry.jitter: must be between 0 and 1",
+				"retry.statuses: not a status code: 42",
+			},
+		},
+		{
+			name: "bad signing",
+			config: "signing:\n  type: cloudfront\n  expires: never\nstreams:\n" +
+				"  - url: http://origin/a.m3u8\n    signing:\n      type: akamai\n      key: xyz\n" +
+				"  - url: http://origin/b.m3u8\n    signing:\n      type: jwt\n",
+			problems: []string{
+				"signing.expires: not a duration: never",
+				"signing.key_pair_id: is required for cloudfront signing",
+				"signing.key: one of key or key_file is required for cloudfront signing",
+				"streams[0].signing: akamai key must be hex encoded",
+				"streams[1].signing.type: must be hmac, cloudfront or akamai: \"jwt\"",
+			},
+		},
+		{
+			name: "bad transport",
+			config: "proxy: ftp://proxy\nstreams:\n" +
+				"  - url: http://origin/a.m3u8\n    tls:\n      cert_file: client.pem\n    resolve: [\"cdn:443\"]\n",
+			problems: []string{
+				"proxy: proxy must be an http, https or socks5 url: ftp://proxy",
+				"streams[0].tls: a client certificate needs both a cert and a key file",
+				"streams[0].resolve: resolve must look like host:port:ip: cdn:443",
+			},
+		},
+		{
+			name:     "bad format",
+			config:   "streams:\n  - url: http://origin/live\n    format: smooth\n",
+			problems: []string{"streams[0].format: must be hls or dash: \"smooth\""},
+		},
+		{
+			name:     "sample without settings",
+			config:   "streams:\n  - url: http://origin/a.m3u8\n    check: sample\n",
+			problems: []string{"streams[0].sample: is required by the sample check"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(test.config))
+			configError, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("expected a config error: %v", err)
+			}
+			if strings.Join(configError.Problems, "\n") != strings.Join(test.problems, "\n") {
+				t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(test.problems, "\n"), strings.Join(configError.Problems, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseConfigUnknownField(t *testing.T) {
+	if _, err := ParseConfig([]byte("streams:\n  - url: http://origin/a.m3u8\n    urls: typo\n")); err == nil {
+		t.Error("expected an error for an unknown yaml field")
+	}
+	if _, err := ParseConfig([]byte(`{"stream": []}`)); err == nil {
+		t.Error("expected an error for an unknown json field")
+	}
+}
+
+func TestConfigScannerOptions(t *testing.T) {
+	t.Setenv("OTTSCANNER_TEST_TOKEN", "token")
+	config, err := ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var authorization []string
+	var mutex sync.Mutex
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		header := r.Header.Get("Authorization") + " " + r.Header.Get("User-Agent")
+		if len(authorization) == 0 || authorization[len(authorization)-1] != header {
+			authorization = append(authorization, header)
+		}
+		w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nv.m3u8\n"))
+	}))
+	defer origin.Close()
+
+	for _, stream := range config.Streams {
+		options, err := config.ScannerOptions(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner, err := New(origin.URL+"/master.m3u8", 1, options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := scanner.Streams(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	expected := []string{"Bearer token ottscanner", basic + " ottscanner"}
+	if strings.Join(authorization, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected headers %q, got %q", expected, authorization)
+	}
+
+	// a key removed after the config was loaded fails the stream instead
+	// of scanning it unsigned
+	stream := StreamConfig{URL: origin.URL + "/master.m3u8", Signing: &SigningConfig{Type: "hmac", Key: "${OTTSCANNER_TEST_MISSING_KEY}"}}
+	if _, err := config.ScannerOptions(stream); err == nil {
+		t.Error("expected an error without the signing key")
+	}
+	cloudFront := StreamConfig{Signing: &SigningConfig{Type: "cloudfront", KeyPairID: "K", KeyFile: filepath.Join(t.TempDir(), "missing.pem")}}
+	if _, err := config.ScannerOptions(cloudFront); err == nil {
+		t.Error("expected an error without the key file")
+	}
+	report, err := ScanBatch([]Channel{{Name: "unsigned", URL: stream.URL}}, BatchOptions{
+		MaxConcurrency: 1,
+		ChannelOptions: func(Channel) ([]Option, error) { return config.ScannerOptions(stream) },
+	})
+	if err != nil || report.Channels["unsigned"].OK() || report.Channels["unsigned"].Report != nil {
+		t.Errorf("expected the channel to fail without being scanned, got: %+v %v", report, err)
+	}
+}
@@ -2,10 +2,13 @@ package ottscanner
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jkittell/toolbox"
 	"github.com/unki2aut/go-mpd"
+	"log/slog"
 	"regexp"
+	"time"
 )
 
 /*
@@ -23,35 +26,31 @@ import (
 */
 
 // calculateDashSegmentTimestamp is used to calculate the timestamp values for the segment in the dash segment timeline
-func calculateDashSegmentTimestamp(timestampOfFirstSegment *uint64, segmentDuration uint64, segmentRepeat *int64) []uint64 {
-	logger.Debug("calculate dash segment timeline timestamp values")
-	logger.Debug("timestamp of first segment", *timestampOfFirstSegment)
-	logger.Debug("segment duration", segmentDuration)
-	logger.Debug("segment repeat", *segmentRepeat)
+// which is the segment of an S entry followed by segmentRepeat more
+func (s *Scanner) calculateDashSegmentTimestamp(timestampOfFirstSegment, segmentDuration uint64, segmentRepeat int64) []uint64 {
+	s.logger.Debug("calculate dash segment timeline timestamp values", "first_timestamp", timestampOfFirstSegment,
+		"segment_duration", segmentDuration, "segment_repeat", segmentRepeat)
 	var timestamps []uint64
 	var timestamp uint64
 
 	var i int64
 
-	// Loop the number of times indicated by the segment repeat value
-	for i = 0; i < *segmentRepeat; i++ {
+	// Loop once more than the segment repeat value
+	for i = 0; i <= segmentRepeat; i++ {
 		// If it's the first loop use the timestamp of the first segment
 		// otherwise increment the timestamp by the segment duration
 		if i > 0 {
 			timestamp = timestamp + segmentDuration
 		} else {
-			timestamp = *timestampOfFirstSegment
+			timestamp = timestampOfFirstSegment
 		}
-		logger.Debug("dash segment timestamp", timestamp)
 		timestamps = append(timestamps, timestamp)
 	}
 	return timestamps
 }
 
-func getSegmentsFromSegmentTimeline(dashSegmentTimestamps []uint64, baseURL, representationId, media string) Segments {
-	logger.Debug("base url", baseURL)
-	logger.Debug("representation id", representationId)
-	logger.Debug("media", media)
+func (s *Scanner) getSegmentsFromSegmentTimeline(dashSegmentTimestamps []uint64, segmentDuration, timescale uint64, baseURL, representationId, media string) Segments {
+	s.logger.Debug("dash segment timeline", "base_url", baseURL, "representation", representationId, "media", media)
 
 	var segments Segments
 	for _, timestamp := range dashSegmentTimestamps {
@@ -65,26 +64,33 @@ func getSegmentsFromSegmentTimeline(dashSegmentTimestamps []uint64, baseURL, rep
 		var n = regexp.MustCompile(timeRegex)
 		segmentName = n.ReplaceAllString(segmentName, fmt.Sprint(timestamp))
 
-		logger.Debug("dash segment name", segmentName)
 		url := fmt.Sprintf("%s/%s", baseURL, segmentName)
-		logger.Debug("dash segment url", url)
+		s.logger.Debug("dash segment", "segment", segmentName, "url", url)
 		seg := Segment{
 			name:           segmentName,
 			url:            url,
 			byteRangeStart: -1,
 			byteRangeSize:  -1,
+			duration:       dashDuration(segmentDuration, timescale),
 		}
 		segments = append(segments, seg)
 	}
 	return segments
 }
 
-func getSegmentsFromSegmentTemplate(segmentDuration, timescale, startNumber, manifestDuration uint64, baseURL, representationId, media string) Segments {
+// dashDuration converts a duration in timescale units to a time.Duration
+func dashDuration(duration, timescale uint64) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+}
+
+func (s *Scanner) getSegmentsFromSegmentTemplate(segmentDuration, timescale, startNumber, manifestDuration uint64, baseURL, representationId, media string) Segments {
 	// get the segment size
 	// duration="900000" / timescale="90000"
 	// so 10 second segments
 	segmentSize := segmentDuration / timescale
-	logger.Debug("segment size ", segmentSize)
 
 	// the media presentation duration is the size of the sliding window
 	// mediaPresentationDuration="PT0H15M10S"
@@ -92,13 +98,12 @@ func getSegmentsFromSegmentTemplate(segmentDuration, timescale, startNumber, man
 	// divide the media presentation duration / segment size
 	// to get the number of segments
 	numberOfSegments := manifestDuration / segmentSize
-	logger.Debug("number of segments", numberOfSegments)
 
 	// start number - N where N is number of segments to get the last
 	// segment in the window then increment N times
 	N := startNumber + numberOfSegments
-	logger.Debug("start number ", startNumber)
-	logger.Debug("end number ", N)
+	s.logger.Debug("dash segment template", "base_url", baseURL, "representation", representationId, "media", media,
+		"segment_size", segmentSize, "segments", numberOfSegments, "start_number", startNumber, "end_number", N)
 
 	var segments Segments
 	for i := startNumber; i < N; i++ {
@@ -113,31 +118,31 @@ func getSegmentsFromSegmentTemplate(segmentDuration, timescale, startNumber, man
 		var n = regexp.MustCompile(numberRegex)
 		segmentName = n.ReplaceAllString(segmentName, segmentNumber)
 
-		logger.Debug("dash segment name", segmentName)
 		url := fmt.Sprintf("%s/%s", baseURL, segmentName)
-		logger.Debug("dash segment url", url)
+		s.logger.Debug("dash segment", "segment", segmentName, "url", url)
 		seg := Segment{
 			name:           segmentName,
 			url:            url,
 			byteRangeStart: -1,
 			byteRangeSize:  -1,
+			duration:       dashDuration(segmentDuration, timescale),
 		}
 		segments = append(segments, seg)
 	}
 	return segments
 }
 
-func parseDASH(url string) (Streams, error) {
+func (s *Scanner) parseDASH(url string) (Streams, error) {
 	var representations Streams
 
-	manifestFile, err := toolbox.SendRequest(toolbox.GET, url, "", nil)
+	manifestFile, err := s.requestPlaylist(url)
 	if err != nil {
-		panic(err)
+		return representations, newScannerError(err, fmt.Sprintf("unable to download dash manifest url %s", url))
 	}
 	dashManifest := new(mpd.MPD)
 	err = dashManifest.Decode(manifestFile)
 	if err != nil {
-		panic(err)
+		return representations, &ParseError{URL: url, Err: err}
 	}
 
 	var segmentDuration uint64
@@ -152,9 +157,6 @@ func parseDASH(url string) (Streams, error) {
 	//mpdStr := mpd.MediaPresentationDuration.String()
 	//fmt.Println(mpdStr)
 	//d, err := duration.ParseISO8601(mpdStr)
-	if err != nil {
-		panic(err)
-	}
 
 	//x := d.M * 60
 	//y := d.TS
@@ -162,56 +164,88 @@ func parseDASH(url string) (Streams, error) {
 
 	//fmt.Println("duration", xy)
 	manifestDuration = uint64(900)
-	if err != nil {
-		panic(err)
-	}
 
 	for _, period := range dashManifest.Period {
-		mpdMetadata, err := json.Marshal(dashManifest)
-		if err != nil {
-			panic(err)
+		if s.logger.Enabled(s.ctx, slog.LevelDebug) {
+			mpdMetadata, _ := json.Marshal(dashManifest)
+			s.logger.Debug("dash period", "url", url, "period", period.ID, "mpd", string(mpdMetadata))
 		}
-		logger.Debug(string(mpdMetadata))
-
-		logger.Debug("period: ", *period.ID)
 		for _, set := range period.AdaptationSets {
 			for _, rep := range set.Representations {
 				var representation Stream
 
+				if rep.ID == nil || rep.SegmentTemplate == nil || rep.SegmentTemplate.Timescale == nil || rep.SegmentTemplate.Media == nil {
+					return representations, &ParseError{URL: url, Err: errors.New("representation needs an id and a segment template with a timescale and media")}
+				}
 				representationId = *rep.ID
-				logger.Debug("id: ", representationId)
 
 				representation.name = representationId
 				representation.masterPlaylistURL = url
+				if rep.Bandwidth != nil {
+					representation.bandwidth = int(*rep.Bandwidth)
+				}
+				if rep.Width != nil && rep.Height != nil {
+					representation.resolution = fmt.Sprintf("%dx%d", *rep.Width, *rep.Height)
+				}
+				if rep.Codecs != nil {
+					representation.codecs = *rep.Codecs
+				} else if set.Codecs != nil {
+					representation.codecs = *set.Codecs
+				}
 
 				timescale = *rep.SegmentTemplate.Timescale
-				logger.Debug("timescale", timescale)
 
 				media = *rep.SegmentTemplate.Media
 
 				if rep.SegmentTemplate.StartNumber != nil {
+					if rep.SegmentTemplate.Duration == nil || *rep.SegmentTemplate.Duration < timescale {
+						return representations, &ParseError{URL: url, Text: representationId, Err: errors.New("segment template needs a duration of at least a second")}
+					}
 					startNumber = *rep.SegmentTemplate.StartNumber
-					logger.Debug("start number: ", startNumber)
-
-					logger.Debug("presentation time offset ", *rep.SegmentTemplate.PresentationTimeOffset)
-
 					segmentDuration = *rep.SegmentTemplate.Duration
-					logger.Debug("segment duration ", segmentDuration)
+					s.logger.Debug("dash representation", "representation", representationId, "timescale", timescale,
+						"start_number", startNumber, "presentation_time_offset", rep.SegmentTemplate.PresentationTimeOffset,
+						"segment_duration", segmentDuration)
 
 					// get segments for this representation
-					segments := getSegmentsFromSegmentTemplate(segmentDuration, timescale, startNumber, manifestDuration, baseURL, representationId, media)
+					segments := s.getSegmentsFromSegmentTemplate(segmentDuration, timescale, startNumber, manifestDuration, baseURL, representationId, media)
 					representation.segments = segments
 
 					representations = append(representations, representation)
 				} else {
-					logger.Debug("parsing segment timeline")
-					var dashSegmentTimestamps []uint64
-
-					for _, timeline := range rep.SegmentTemplate.SegmentTimeline.S {
-						timestamps := calculateDashSegmentTimestamp(timeline.T, timeline.D, timeline.R)
-						dashSegmentTimestamps = append(dashSegmentTimestamps, timestamps...)
+					if rep.SegmentTemplate.SegmentTimeline == nil {
+						return representations, &ParseError{URL: url, Text: representationId, Err: errors.New("segment template needs a start number or a segment timeline")}
+					}
+					s.logger.Debug("parsing segment timeline", "representation", representationId, "timescale", timescale)
+					var segments Segments
+
+					// t defaults to the end of the previous S entry and r to no repeats
+					var next uint64
+					entries := rep.SegmentTemplate.SegmentTimeline.S
+					for i, timeline := range entries {
+						if timeline.D == 0 {
+							return representations, &ParseError{URL: url, Text: representationId, Err: errors.New("segment timeline needs a duration")}
+						}
+						start := next
+						if timeline.T != nil {
+							start = *timeline.T
+						}
+						var repeat int64
+						if timeline.R != nil {
+							repeat = *timeline.R
+						}
+						if repeat < 0 {
+							// repeat until the time of the next entry, or once
+							// without one as the end of the period is unknown
+							repeat = 0
+							if i+1 < len(entries) && entries[i+1].T != nil && *entries[i+1].T > start {
+								repeat = int64((*entries[i+1].T-start)/timeline.D) - 1
+							}
+						}
+						timestamps := s.calculateDashSegmentTimestamp(start, timeline.D, repeat)
+						segments = append(segments, s.getSegmentsFromSegmentTimeline(timestamps, timeline.D, timescale, baseURL, representationId, media)...)
+						next = start + uint64(repeat+1)*timeline.D
 					}
-					segments := getSegmentsFromSegmentTimeline(dashSegmentTimestamps, baseURL, representationId, media)
 					representation.segments = segments
 					representations = append(representations, representation)
 				}
@@ -0,0 +1,47 @@
+package ottscanner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestScanner_DashSegmentTimeline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="dynamic">
+  <Period id="1">
+    <AdaptationSet>
+      <Representation id="video" bandwidth="1000">
+        <SegmentTemplate timescale="1" media="$RepresentationID$_$Time$.m4s">
+          <SegmentTimeline>
+            <S t="0" d="2" r="1"/>
+            <S d="2"/>
+            <S d="3" r="-1"/>
+            <S t="12" d="2"/>
+          </SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`))
+	}))
+	defer server.Close()
+
+	scanner, _ := New(server.URL+"/manifest.mpd", 1)
+	streams, err := scanner.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, segment := range streams[0].segments {
+		names = append(names, segment.name)
+	}
+	// t defaults to the end of the previous entry, r to 0 and r="-1"
+	// repeats until the next entry
+	expected := []string{"video_0.m4s", "video_2.m4s", "video_4.m4s", "video_6.m4s", "video_9.m4s", "video_12.m4s"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected: %v, got: %v", expected, names)
+	}
+}
@@ -0,0 +1,219 @@
+package ottscanner
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DiffOptions tunes what DiffReports counts as a latency regression.
+type DiffOptions struct {
+	// LatencyThreshold is the relative increase of the p50 or p90
+	// segment latency of a stream that is a regression. Defaults to 0.2.
+	LatencyThreshold float64
+	// MinLatencyIncrease ignores increases smaller than this so fast
+	// streams do not regress on noise. Defaults to 10ms.
+	MinLatencyIncrease time.Duration
+}
+
+// AttributeChange is a ladder attribute of a stream that changed.
+type AttributeChange struct {
+	Attribute string `json:"attribute"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+}
+
+// SegmentChange is a segment that started or stopped failing.
+type SegmentChange struct {
+	Stream string `json:"stream"`
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// StreamDiff compares a stream that is in both reports.
+type StreamDiff struct {
+	Name           string            `json:"name"`
+	Changes        []AttributeChange `json:"changes,omitempty"`
+	SegmentsBefore int               `json:"segments_before"`
+	SegmentsAfter  int               `json:"segments_after"`
+	FailuresBefore int               `json:"failures_before"`
+	FailuresAfter  int               `json:"failures_after"`
+	LatencyBefore  LatencySummary    `json:"latency_before"`
+	LatencyAfter   LatencySummary    `json:"latency_after"`
+	// LatencyRegressed is true when the p50 or p90 latency increased
+	// past the threshold of the DiffOptions.
+	LatencyRegressed bool `json:"latency_regressed"`
+}
+
+// Changed returns true when anything but latency changes under the
+// threshold differ.
+func (d *StreamDiff) Changed() bool {
+	return len(d.Changes) > 0 || d.SegmentsBefore != d.SegmentsAfter ||
+		d.FailuresBefore != d.FailuresAfter || d.LatencyRegressed
+}
+
+// ReportDiff is the difference between two reports of the same channel,
+// such as before and after an encoder or packager change. Segments are
+// matched by stream and name.
+type ReportDiff struct {
+	Before         string       `json:"before"`
+	After          string       `json:"after"`
+	AddedStreams   []string     `json:"added_streams,omitempty"`
+	RemovedStreams []string     `json:"removed_streams,omitempty"`
+	Streams        []StreamDiff `json:"streams"`
+	// NewlyFailing are the segments that were ok before and fail after.
+	NewlyFailing []SegmentChange `json:"newly_failing,omitempty"`
+	// Fixed are the segments that failed before and are ok after.
+	Fixed []SegmentChange `json:"fixed,omitempty"`
+}
+
+// Regressed returns true when a stream was removed, a segment started
+// failing, a stream has more failures or its latency regressed.
+func (d *ReportDiff) Regressed() bool {
+	if len(d.RemovedStreams) > 0 || len(d.NewlyFailing) > 0 {
+		return true
+	}
+	for _, stream := range d.Streams {
+		if stream.FailuresAfter > stream.FailuresBefore || stream.LatencyRegressed {
+			return true
+		}
+	}
+	return false
+}
+
+// Changed returns true when the reports differ in anything but latency
+// changes under the threshold.
+func (d *ReportDiff) Changed() bool {
+	if len(d.AddedStreams) > 0 || len(d.RemovedStreams) > 0 || len(d.NewlyFailing) > 0 || len(d.Fixed) > 0 {
+		return true
+	}
+	for _, stream := range d.Streams {
+		if stream.Changed() {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffReports compares the streams and segments of two reports.
+func DiffReports(before, after *Report, options DiffOptions) *ReportDiff {
+	if options.LatencyThreshold <= 0 {
+		options.LatencyThreshold = 0.2
+	}
+	if options.MinLatencyIncrease <= 0 {
+		options.MinLatencyIncrease = 10 * time.Millisecond
+	}
+	diff := &ReportDiff{Before: before.URL, After: after.URL, Streams: []StreamDiff{}}
+
+	streams := make(map[string]StreamReport)
+	for _, stream := range before.Streams {
+		streams[stream.Name] = stream
+	}
+	matched := make(map[string]bool)
+	for _, stream := range after.Streams {
+		previous, ok := streams[stream.Name]
+		if !ok {
+			diff.AddedStreams = append(diff.AddedStreams, stream.Name)
+			continue
+		}
+		matched[stream.Name] = true
+		diff.Streams = append(diff.Streams, diffStream(previous, stream, options))
+		newlyFailing, fixed := diffSegments(previous, stream)
+		diff.NewlyFailing = append(diff.NewlyFailing, newlyFailing...)
+		diff.Fixed = append(diff.Fixed, fixed...)
+	}
+	for _, stream := range before.Streams {
+		if !matched[stream.Name] {
+			diff.RemovedStreams = append(diff.RemovedStreams, stream.Name)
+		}
+	}
+	sort.Strings(diff.AddedStreams)
+	sort.Strings(diff.RemovedStreams)
+	return diff
+}
+
+func diffStream(before, after StreamReport, options DiffOptions) StreamDiff {
+	diff := StreamDiff{
+		Name:           after.Name,
+		SegmentsBefore: len(before.Segments),
+		SegmentsAfter:  len(after.Segments),
+		FailuresBefore: streamFailures(before),
+		FailuresAfter:  streamFailures(after),
+		LatencyBefore:  streamLatency(before),
+		LatencyAfter:   streamLatency(after),
+	}
+	attributes := []AttributeChange{
+		{"bandwidth", fmt.Sprint(before.Bandwidth), fmt.Sprint(after.Bandwidth)},
+		{"resolution", before.Resolution, after.Resolution},
+		{"codecs", before.Codecs, after.Codecs},
+	}
+	for _, attribute := range attributes {
+		if attribute.Before != attribute.After {
+			diff.Changes = append(diff.Changes, attribute)
+		}
+	}
+	diff.LatencyRegressed = latencyRegressed(diff.LatencyBefore.P50, diff.LatencyAfter.P50, options) ||
+		latencyRegressed(diff.LatencyBefore.P90, diff.LatencyAfter.P90, options)
+	return diff
+}
+
+func latencyRegressed(before, after time.Duration, options DiffOptions) bool {
+	if before == 0 || after-before < options.MinLatencyIncrease {
+		return false
+	}
+	return float64(after-before)/float64(before) > options.LatencyThreshold
+}
+
+// diffSegments returns the segments of a stream in both reports that
+// started failing and that were fixed
+func diffSegments(before, after StreamReport) (newlyFailing, fixed []SegmentChange) {
+	results := make(map[string]SegmentResult)
+	for _, result := range before.Segments {
+		results[result.Name] = result
+	}
+	for _, result := range after.Segments {
+		previous, ok := results[result.Name]
+		if !ok || previous.OK == result.OK {
+			continue
+		}
+		if result.OK {
+			fixed = append(fixed, newSegmentChange(previous))
+		} else {
+			newlyFailing = append(newlyFailing, newSegmentChange(result))
+		}
+	}
+	return newlyFailing, fixed
+}
+
+func newSegmentChange(result SegmentResult) SegmentChange {
+	return SegmentChange{
+		Stream: result.Stream,
+		Name:   result.Name,
+		URL:    result.URL,
+		Status: result.Status,
+		Error:  result.Error,
+	}
+}
+
+func streamFailures(stream StreamReport) int {
+	var failures int
+	for _, result := range stream.Segments {
+		if !result.OK {
+			failures++
+		}
+	}
+	return failures
+}
+
+// streamLatency summarizes the durations of the segments that were ok
+func streamLatency(stream StreamReport) LatencySummary {
+	var durations []time.Duration
+	for _, result := range stream.Segments {
+		if result.OK {
+			durations = append(durations, result.Duration)
+		}
+	}
+	return summarizeLatency(durations)
+}
@@ -0,0 +1,84 @@
+package ottscanner
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDiffReports(t *testing.T) {
+	origin := newTestOrigin(t)
+	scanner, err := New(origin.URL+"/master.m3u8", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	before := scanner.Report()
+	if before.Streams[0].Resolution != "640x360" || before.Streams[0].Codecs != "avc1.64001f,mp4a.40.2" {
+		t.Fatalf("expected the ladder attributes of the master playlist: %+v", before.Streams[0])
+	}
+	for i := range before.Streams {
+		for j := range before.Streams[i].Segments {
+			before.Streams[i].Segments[j].Duration = 20 * time.Millisecond
+		}
+	}
+
+	// round trip the after report through json like the cli does
+	var buf bytes.Buffer
+	if err := before.Write(&buf, ReportJSON); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ReadReport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := DiffReports(before, after, DiffOptions{}); diff.Changed() || diff.Regressed() {
+		t.Fatalf("expected no differences: %+v", diff)
+	}
+
+	// the high stream moves to 1080p, loses a segment, fails another and
+	// slows down, and a new top rendition is added
+	high := &after.Streams[1]
+	high.Resolution = "1920x1080"
+	high.Segments = high.Segments[:len(high.Segments)-1]
+	high.Segments[0].OK, high.Segments[0].Status, high.Segments[0].Error = false, http.StatusNotFound, "not found"
+	for j := range high.Segments {
+		high.Segments[j].Duration = 50 * time.Millisecond
+	}
+	after.Streams = append(after.Streams, StreamReport{Name: "top.m3u8"})
+	// and a segment of the low stream that failed before is fixed
+	before.Streams[0].Segments[2].OK = false
+
+	diff := DiffReports(before, after, DiffOptions{})
+	if !diff.Changed() || !diff.Regressed() {
+		t.Fatalf("expected a regression: %+v", diff)
+	}
+	if len(diff.AddedStreams) != 1 || diff.AddedStreams[0] != "top.m3u8" || len(diff.RemovedStreams) != 0 {
+		t.Errorf("unexpected added and removed streams: %v %v", diff.AddedStreams, diff.RemovedStreams)
+	}
+	stream := diff.Streams[1]
+	if len(stream.Changes) != 1 || stream.Changes[0] != (AttributeChange{"resolution", "1280x720", "1920x1080"}) {
+		t.Errorf("unexpected changes: %+v", stream.Changes)
+	}
+	if stream.SegmentsBefore != testOriginSegments || stream.SegmentsAfter != testOriginSegments-1 || stream.FailuresAfter != 1 {
+		t.Errorf("unexpected segment counts: %+v", stream)
+	}
+	if !stream.LatencyRegressed || diff.Streams[0].LatencyRegressed {
+		t.Errorf("expected only the high stream latency to regress: %+v", diff.Streams)
+	}
+	if len(diff.NewlyFailing) != 1 || diff.NewlyFailing[0].Status != http.StatusNotFound || diff.NewlyFailing[0].Stream != "high.m3u8" {
+		t.Errorf("unexpected newly failing segments: %+v", diff.NewlyFailing)
+	}
+	if len(diff.Fixed) != 1 || diff.Fixed[0].Stream != "low.m3u8" {
+		t.Errorf("unexpected fixed segments: %+v", diff.Fixed)
+	}
+
+	// a higher threshold tolerates the slowdown
+	diff = DiffReports(before, after, DiffOptions{LatencyThreshold: 2})
+	if diff.Streams[1].LatencyRegressed {
+		t.Errorf("expected the latency to be within the threshold: %+v", diff.Streams[1])
+	}
+}
@@ -0,0 +1,252 @@
+package ottscanner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jkittell/toolbox"
+	"io"
+	"sort"
+	"time"
+)
+
+// defaultSegmentDuration is used for the buffer when the playlist or
+// manifest does not declare the duration of a segment.
+const defaultSegmentDuration = 6 * time.Second
+
+// PlaybackOptions configures EmulatePlayback.
+type PlaybackOptions struct {
+	// Profile throttles segment fetches to the bandwidth, latency and
+	// loss of the profile. Without a profile segments are fetched as fast
+	// as the network allows and timed with the wall clock.
+	Profile *NetworkProfile
+	// Simulated only accounts for the shaped transfer time on the virtual
+	// clock of the profile instead of throttling the reader, which is
+	// faster and makes the report reproducible.
+	Simulated bool
+	// Segments is the number of segments to play. Defaults to 10.
+	Segments int
+	// StartupSegments is the number of segments buffered before
+	// playback starts. Defaults to 2.
+	StartupSegments int
+}
+
+// PlaybackSegment is a segment fetched by the emulated player.
+type PlaybackSegment struct {
+	Stream       string        `json:"stream"`
+	Bandwidth    int           `json:"bandwidth"`
+	Name         string        `json:"name"`
+	URL          string        `json:"url"`
+	Bytes        int64         `json:"bytes"`
+	Duration     time.Duration `json:"duration"`
+	DownloadTime time.Duration `json:"download_time"`
+	// Buffer is the amount of media buffered after the segment arrived.
+	Buffer  time.Duration `json:"buffer"`
+	Error   string        `json:"error,omitempty"`
+	Timings *Timings      `json:"timings,omitempty"`
+}
+
+// PlaybackReport is the quality of experience of an emulated playback.
+type PlaybackReport struct {
+	URL          string            `json:"url"`
+	Profile      string            `json:"profile,omitempty"`
+	Started      time.Time         `json:"started"`
+	Finished     time.Time         `json:"finished"`
+	StartupTime  time.Duration     `json:"startup_time"`
+	Rebuffers    int               `json:"rebuffers"`
+	RebufferTime time.Duration     `json:"rebuffer_time"`
+	Switches     int               `json:"switches"`
+	Segments     []PlaybackSegment `json:"segments"`
+	Playlists    []PlaylistFetch   `json:"playlists,omitempty"`
+}
+
+// EmulatePlayback will select a stream then download segments
+// in a buffer from the live edge. The player starts on the lowest
+// bandwidth stream and switches to the highest stream that fits the
+// measured throughput, reporting startup time, rebuffering and
+// stream switches.
+func (s *Scanner) EmulatePlayback(options PlaybackOptions) (PlaybackReport, error) {
+	report := PlaybackReport{URL: s.url, Started: time.Now()}
+	if options.Segments < 1 {
+		options.Segments = 10
+	}
+	if options.StartupSegments < 1 {
+		options.StartupSegments = 2
+	}
+
+	var link *networkLink
+	if options.Profile != nil {
+		var err error
+		link, err = newNetworkLink(options.Profile, !options.Simulated)
+		if err != nil {
+			return report, newScannerError(err, "error creating network profile for playback")
+		}
+		report.Profile = options.Profile.Name
+	}
+
+	ladder, err := s.ladder()
+	if err != nil {
+		return report, newScannerError(err, fmt.Sprintf("error getting streams for playback: %s", s.url))
+	}
+
+	// segments of each stream in the ladder, decoded when first selected
+	playlists := make(map[string]Segments)
+	var current int
+	var start int
+	var buffer time.Duration
+	var throughput float64
+	playing := false
+	for i := 0; i < options.Segments; i++ {
+		stream := ladder[current]
+		segments, ok := playlists[stream.name]
+		if !ok {
+			segments, err = s.streamSegments(stream)
+			if err != nil {
+				return report, newScannerError(err, fmt.Sprintf("error getting segments for playback: %s", stream.url))
+			}
+			playlists[stream.name] = segments
+			if i == 0 {
+				// join at the live edge
+				start = len(segments) - options.Segments
+				if start < 0 {
+					start = 0
+				}
+			}
+		}
+		if start+i >= len(segments) {
+			break
+		}
+		segment := segments[start+i]
+
+		played := PlaybackSegment{
+			Stream:    stream.name,
+			Bandwidth: stream.bandwidth,
+			Name:      segment.name,
+			URL:       segment.url,
+			Duration:  segment.duration,
+		}
+		if played.Duration == 0 {
+			played.Duration = defaultSegmentDuration
+		}
+		trace := new(requestTrace)
+		played.Bytes, played.DownloadTime, err = s.fetchSegment(trace, segment, link)
+		played.Timings = trace.result()
+		if err != nil {
+			s.logger.Warn("playback segment failed", "stream", stream.name, "segment", segment.name, "url", segment.url,
+				"status", statusCode(err), "duration", played.DownloadTime, "error", err)
+			played.Error = err.Error()
+		}
+
+		if playing {
+			buffer -= played.DownloadTime
+			if buffer < 0 {
+				report.Rebuffers++
+				report.RebufferTime += -buffer
+				buffer = 0
+			}
+		} else {
+			report.StartupTime += played.DownloadTime
+		}
+		if played.Error == "" {
+			buffer += played.Duration
+		}
+		if !playing && i+1 >= options.StartupSegments {
+			playing = true
+		}
+		played.Buffer = buffer
+		report.Segments = append(report.Segments, played)
+
+		// estimate the throughput then pick the next stream
+		if played.Error == "" && played.DownloadTime > 0 {
+			sample := float64(played.Bytes*8) / played.DownloadTime.Seconds()
+			if throughput == 0 {
+				throughput = sample
+			} else {
+				throughput = 0.7*throughput + 0.3*sample
+			}
+		}
+		next := selectStream(ladder, throughput)
+		if next != current {
+			report.Switches++
+			current = next
+		}
+	}
+
+	report.Finished = time.Now()
+	s.mutex.Lock()
+	report.Playlists = s.playlistFetches(report.Started)
+	s.mutex.Unlock()
+	if len(report.Segments) == 0 {
+		return report, newScannerError(errors.New("no segments played"), s.url)
+	}
+	return report, nil
+}
+
+// ladder returns the ABR streams sorted by bandwidth. Streams without a
+// bandwidth such as I-frame and audio playlists are left out unless no
+// stream declares a bandwidth.
+func (s *Scanner) ladder() (Streams, error) {
+	streams, err := s.Streams()
+	if err != nil {
+		return streams, err
+	}
+	var ladder Streams
+	for _, stream := range streams {
+		if stream.bandwidth > 0 {
+			ladder = append(ladder, stream)
+		}
+	}
+	if len(ladder) == 0 {
+		ladder = streams
+	}
+	if len(ladder) == 0 {
+		return ladder, newScannerError(ErrNoStreams, s.url)
+	}
+	sort.SliceStable(ladder, func(i, j int) bool {
+		return ladder[i].bandwidth < ladder[j].bandwidth
+	})
+	return ladder, nil
+}
+
+// selectStream returns the index of the highest stream in the ladder
+// that fits in 80% of the throughput.
+func selectStream(ladder Streams, throughput float64) int {
+	selected := 0
+	for i, stream := range ladder {
+		if float64(stream.bandwidth) <= 0.8*throughput {
+			selected = i
+		}
+	}
+	return selected
+}
+
+// fetchSegment downloads a segment and returns its size and how long it
+// took. When a simulated network link is given the time comes from the
+// virtual clock of the link, otherwise from the wall clock. The timings
+// of the request are recorded in trace.
+func (s *Scanner) fetchSegment(trace *requestTrace, segment Segment, link *networkLink) (int64, time.Duration, error) {
+	started := time.Now()
+	var linkStarted time.Duration
+	if link != nil {
+		linkStarted = link.elapsed
+		link.request()
+	}
+	elapsed := func() time.Duration {
+		if link != nil && !link.realtime {
+			return link.elapsed - linkStarted
+		}
+		return time.Since(started)
+	}
+
+	resp, err := s.do(trace, RequestSegment, toolbox.GET, segment.url, rangeHeader(segment))
+	if err != nil {
+		return 0, elapsed(), err
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	if link != nil {
+		body = link.reader(body)
+	}
+	written, err := io.Copy(io.Discard, body)
+	return written, elapsed(), err
+}
@@ -0,0 +1,74 @@
+package ottscanner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScanner_EmulatePlaybackProfile(t *testing.T) {
+	origin := newTestOrigin(t)
+	run := func(profileName string) PlaybackReport {
+		scanner, err := New(origin.URL+"/master.m3u8", maxConcurrency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile, err := NetworkProfileByName(profileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := scanner.EmulatePlayback(PlaybackOptions{Profile: profile, Simulated: true, Segments: testOriginSegments})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// only the wall clock, the playlist fetches and the request timings
+		// differ between runs
+		report.Started, report.Finished = time.Time{}, time.Time{}
+		report.Playlists = nil
+		for i := range report.Segments {
+			report.Segments[i].Timings = nil
+		}
+		return report
+	}
+
+	report := run("4g")
+	if len(report.Segments) != testOriginSegments {
+		t.Fatalf("expected: %d segments, got: %d", testOriginSegments, len(report.Segments))
+	}
+	if report.Segments[0].Stream != "low.m3u8" {
+		t.Fatalf("expected playback to start on the lowest stream, got: %s", report.Segments[0].Stream)
+	}
+	if report.Switches == 0 || report.Segments[len(report.Segments)-1].Stream != "high.m3u8" {
+		t.Fatalf("expected a switch to the highest stream on 4g: %+v", report)
+	}
+	if report.Rebuffers != 0 {
+		t.Fatalf("expected no rebuffering on 4g, got: %d", report.Rebuffers)
+	}
+
+	if !reflect.DeepEqual(run("wifi-flaky"), run("wifi-flaky")) {
+		t.Fatal("expected the same report for the same profile")
+	}
+}
+
+func TestScanner_EmulatePlaybackThrottled(t *testing.T) {
+	origin := newTestOrigin(t)
+	scanner, _ := New(origin.URL+"/master.m3u8", maxConcurrency)
+	latency := 50 * time.Millisecond
+	profile := &NetworkProfile{
+		Name:  "slow",
+		Steps: []NetworkStep{{Duration: time.Second, Bandwidth: 100_000_000, Latency: latency}},
+	}
+	started := time.Now()
+	report, err := scanner.EmulatePlayback(PlaybackOptions{Profile: profile, Segments: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 2*latency {
+		t.Errorf("expected the fetches to be throttled, took: %v", elapsed)
+	}
+	for _, segment := range report.Segments {
+		if segment.DownloadTime < latency {
+			t.Errorf("expected a download time of at least %v, got: %v", latency, segment.DownloadTime)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package ottscanner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+var (
+	// ErrUnknownFormat is returned when a url or playlist is neither HLS
+	// nor DASH.
+	ErrUnknownFormat = errors.New("unable to determine if hls or dash")
+	// ErrNoStreams is returned when a playlist or manifest has no ABR
+	// streams.
+	ErrNoStreams = errors.New("no ABR streams")
+	// ErrNoSegments is returned when there are no segments to scan or
+	// download.
+	ErrNoSegments = errors.New("no segments")
+)
+
+type scannerError struct {
+	Context string
+	Err     error
+}
+
+func (se *scannerError) Error() string {
+	return fmt.Sprintf("%s: %v", se.Context, se.Err)
+}
+
+func (se *scannerError) Unwrap() error {
+	return se.Err
+}
+
+// Is reports whether the error falls in the failure category target so
+// errors.Is(err, FailureTimeout) works on every error of the scanner.
+func (se *scannerError) Is(target error) bool {
+	category, ok := target.(FailureCategory)
+	return ok && Category(se.Err) == category
+}
+
+func newScannerError(err error, info string) *scannerError {
+	return &scannerError{
+		Context: info,
+		Err:     err,
+	}
+}
+
+// HTTPError is the error of a response with a status other than 2xx.
+type HTTPError struct {
+	Method     string
+	URL        string
+	Status     string
+	StatusCode int
+	// retryAfter is the Retry-After header of the response
+	retryAfter string
+}
+
+func (he *HTTPError) Error() string {
+	return fmt.Sprintf("%s %s => Non 200 status code: %s", he.Method, he.URL, he.Status)
+}
+
+// Is reports whether the status is in the failure category target.
+func (he *HTTPError) Is(target error) bool {
+	category, ok := target.(FailureCategory)
+	return ok && Category(he) == category
+}
+
+// ParseError is an error parsing a playlist or manifest. Line is the
+// 1-based line of the playlist, or 0 when it is not known.
+type ParseError struct {
+	URL  string
+	Line int
+	Text string
+	Err  error
+}
+
+func (pe *ParseError) Error() string {
+	var message strings.Builder
+	message.WriteString(pe.URL)
+	if pe.Line > 0 {
+		fmt.Fprintf(&message, " line %d", pe.Line)
+	}
+	fmt.Fprintf(&message, ": %v", pe.Err)
+	if pe.Text != "" {
+		fmt.Fprintf(&message, ": %s", pe.Text)
+	}
+	return message.String()
+}
+
+func (pe *ParseError) Unwrap() error {
+	return pe.Err
+}
+
+// Is reports whether target is FailureParse.
+func (pe *ParseError) Is(target error) bool {
+	return target == FailureParse
+}
+
+// ContentError is a segment that was served but is not valid media, such
+// as an HTML error page served with a 200 status.
+type ContentError struct {
+	URL    string
+	Reason string
+}
+
+func (ce *ContentError) Error() string {
+	return fmt.Sprintf("%s: invalid content: %s", ce.URL, ce.Reason)
+}
+
+// Is reports whether target is FailureContent.
+func (ce *ContentError) Is(target error) bool {
+	return target == FailureContent
+}
+
+// FailureCategory is the broad reason a request or scan failed. It is an
+// error so it can be the target of errors.Is.
+type FailureCategory byte
+
+const (
+	FailureOther FailureCategory = iota
+	FailureDNS
+	FailureConnect
+	FailureTLS
+	FailureTimeout
+	FailureClient
+	FailureServer
+	FailureParse
+	FailureContent
+)
+
+func (c FailureCategory) String() string {
+	switch c {
+	case FailureOther:
+		return "other"
+	case FailureDNS:
+		return "dns"
+	case FailureConnect:
+		return "connect"
+	case FailureTLS:
+		return "tls"
+	case FailureTimeout:
+		return "timeout"
+	case FailureClient:
+		return "http_4xx"
+	case FailureServer:
+		return "http_5xx"
+	case FailureParse:
+		return "parse"
+	case FailureContent:
+		return "content"
+	default:
+		return fmt.Sprintf("Unknown(%d)", c)
+	}
+}
+
+func (c FailureCategory) Error() string {
+	return c.String() + " failure"
+}
+
+// Category classifies an error. Errors that are not about a request or
+// a playlist are FailureOther.
+func Category(err error) FailureCategory {
+	var httpError *HTTPError
+	var parseError *ParseError
+	var contentError *ContentError
+	var dnsError *net.DNSError
+	var netError net.Error
+	var opError *net.OpError
+	switch {
+	case errors.As(err, &httpError):
+		if httpError.StatusCode >= 500 {
+			return FailureServer
+		}
+		return FailureClient
+	case errors.As(err, &parseError):
+		return FailureParse
+	case errors.As(err, &contentError):
+		return FailureContent
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded):
+		return FailureTimeout
+	case errors.As(err, &netError) && netError.Timeout():
+		return FailureTimeout
+	case errors.As(err, &dnsError):
+		return FailureDNS
+	case isTLSError(err):
+		return FailureTLS
+	case errors.As(err, &opError), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return FailureConnect
+	default:
+		return FailureOther
+	}
+}
+
+func isTLSError(err error) bool {
+	var verification *tls.CertificateVerificationError
+	var record tls.RecordHeaderError
+	var alert tls.AlertError
+	var authority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &verification) || errors.As(err, &record) || errors.As(err, &alert) ||
+		errors.As(err, &authority) || errors.As(err, &hostname) || errors.As(err, &invalid)
+}
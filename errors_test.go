@@ -0,0 +1,115 @@
+package ottscanner
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCategory(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected FailureCategory
+	}{
+		{&HTTPError{StatusCode: http.StatusNotFound}, FailureClient},
+		{&HTTPError{StatusCode: http.StatusServiceUnavailable}, FailureServer},
+		{newScannerError(&ParseError{URL: "x", Err: errors.New("bad")}, "parsing"), FailureParse},
+		{newScannerError(ErrNoSegments, "scan"), FailureOther},
+	}
+	for _, test := range tests {
+		if category := Category(test.err); category != test.expected {
+			t.Errorf("expected %v for %v, got: %v", test.expected, test.err, category)
+		}
+		if !errors.Is(test.err, test.expected) {
+			t.Errorf("expected %v to be %v", test.err, test.expected)
+		}
+	}
+	if errors.Is(&HTTPError{StatusCode: http.StatusNotFound}, FailureServer) {
+		t.Error("expected a 404 not to be a server failure")
+	}
+}
+
+func TestScanner_Errors(t *testing.T) {
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bad/master.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\nvariant.m3u8\n"))
+		case "/bad/variant.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-BYTERANGE:two\nsegment.ts\n"))
+		case "/duration/variant.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXTINF:two,\nsegment.ts\n"))
+		case "/bad/manifest.mpd":
+			w.Write([]byte("<MPD><Period"))
+		case "/index.html":
+			w.Write([]byte("<html><body>Not a playlist</body></html>"))
+		case "/slow/master.m3u8":
+			time.Sleep(200 * time.Millisecond)
+		case "/high_1.ts":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			origin.ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner, _ := New(server.URL+"/index.html", 1)
+	if _, err := scanner.Streams(); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected %v, got: %v", ErrUnknownFormat, err)
+	}
+
+	scanner, _ = New(server.URL+"/bad/master.m3u8", 1)
+	_, err := scanner.Scan()
+	var parseError *ParseError
+	if !errors.As(err, &parseError) || parseError.Line != 3 || parseError.URL != server.URL+"/bad/variant.m3u8" {
+		t.Errorf("expected a parse error on line 3 of the variant, got: %v", err)
+	}
+	if !errors.Is(err, FailureParse) {
+		t.Errorf("expected a parse failure, got: %v", err)
+	}
+
+	// a malformed duration only loses the duration of the segment
+	scanner, _ = New(server.URL+"/duration/variant.m3u8", 1)
+	if segments, err := scanner.decodeVariant(server.URL + "/duration/variant.m3u8"); err != nil || len(segments) != 1 || segments[0].duration != 0 {
+		t.Errorf("expected the segment without a duration, got: %+v %v", segments, err)
+	}
+
+	scanner, _ = New(server.URL+"/bad/manifest.mpd", 1)
+	if _, err := scanner.Streams(); !errors.As(err, &parseError) {
+		t.Errorf("expected a parse error of the manifest, got: %v", err)
+	}
+
+	scanner, _ = New(server.URL+"/missing.m3u8", 1)
+	_, err = scanner.Streams()
+	var httpError *HTTPError
+	if !errors.As(err, &httpError) || httpError.StatusCode != http.StatusNotFound || !errors.Is(err, FailureClient) {
+		t.Errorf("expected a 404 http error, got: %v", err)
+	}
+
+	scanner, _ = New(server.URL+"/slow/master.m3u8", 1, WithTimeout(50*time.Millisecond))
+	if _, err := scanner.Streams(); !errors.Is(err, FailureTimeout) {
+		t.Errorf("expected a timeout, got: %v", err)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	scanner, _ = New(closed.URL+"/master.m3u8", 1)
+	if _, err := scanner.Streams(); !errors.Is(err, FailureConnect) {
+		t.Errorf("expected a connect failure, got: %v", err)
+	}
+
+	scanner, _ = New(server.URL+"/master.m3u8", 4)
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range scanner.Report().Results() {
+		if result.Name == "high_1.ts" && result.Category != FailureServer.String() {
+			t.Errorf("expected a %v category, got: %+v", FailureServer, result)
+		}
+		if result.OK && result.Category != "" {
+			t.Errorf("expected no category for an ok result, got: %+v", result)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ottscanner
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jkittell/toolbox"
+	"mime"
+	"strings"
+)
+
+func (f ContentFormat) String() string {
+	switch f {
+	case HLS:
+		return "hls"
+	case DASH:
+		return "dash"
+	case UnknownFormat:
+		return "unknown"
+	default:
+		return fmt.Sprintf("Unknown(%d)", f)
+	}
+}
+
+// ParseContentFormat returns the format with the name hls or dash.
+func ParseContentFormat(name string) (ContentFormat, error) {
+	for _, format := range []ContentFormat{HLS, DASH} {
+		if strings.EqualFold(format.String(), name) {
+			return format, nil
+		}
+	}
+	return UnknownFormat, newScannerError(ErrUnknownFormat, name)
+}
+
+// WithFormat sets the format of the url instead of detecting it.
+func WithFormat(format ContentFormat) Option {
+	return func(s *Scanner) {
+		s.format = format
+	}
+}
+
+// sniffSize is how much of a body is read to detect its format
+const sniffSize = 1024
+
+// DetectFormat returns the format of a response from its Content-Type,
+// then from the start of its body, #EXTM3U for HLS or an MPD element for
+// DASH, and last from an .m3u8 or .mpd extension or a format=m3u8 or
+// format=mpd parameter in the url.
+func DetectFormat(contentType string, body []byte, url string) (ContentFormat, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch strings.ToLower(mediaType) {
+	case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+		return HLS, nil
+	case "application/dash+xml":
+		return DASH, nil
+	}
+
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+	body = bytes.TrimSpace(body[:min(len(body), sniffSize)])
+	if bytes.HasPrefix(body, []byte("#EXTM3U")) {
+		return HLS, nil
+	}
+	if bytes.HasPrefix(body, []byte("<")) && bytes.Contains(body, []byte("<MPD")) {
+		return DASH, nil
+	}
+
+	lower := strings.ToLower(url)
+	switch {
+	case strings.Contains(lower, ".m3u8") || strings.Contains(lower, "format=m3u8"):
+		return HLS, nil
+	case strings.Contains(lower, ".mpd") || strings.Contains(lower, "format=mpd"):
+		return DASH, nil
+	}
+	return UnknownFormat, newScannerError(ErrUnknownFormat, url)
+}
+
+// contentFormat returns the format of the url, UnknownFormat until it is
+// detected
+func (s *Scanner) contentFormat() ContentFormat {
+	s.formatMutex.Lock()
+	defer s.formatMutex.Unlock()
+	return s.format
+}
+
+// checkURL checks that the url responds and returns its format. The
+// format is detected with a GET of the url the first time when it is not
+// known, otherwise the url is checked with HEAD.
+func (s *Scanner) checkURL() (ContentFormat, error) {
+	s.formatMutex.Lock()
+	format := s.format
+	if format == UnknownFormat {
+		var err error
+		format, err = s.detectFormat()
+		if err == nil {
+			s.format = format
+		}
+		s.formatMutex.Unlock()
+		return format, err
+	}
+	s.formatMutex.Unlock()
+	_, err := s.request(toolbox.HEAD, s.url, nil)
+	return format, err
+}
+
+// detectFormat gets the url and detects its format from the response.
+// The url of a redirect is used for the url heuristic. The body is kept
+// so the url is not fetched again to parse it.
+func (s *Scanner) detectFormat() (ContentFormat, error) {
+	playlist, err := s.fetchPlaylist(s.url)
+	if err != nil {
+		return UnknownFormat, err
+	}
+	format, err := DetectFormat(playlist.contentType, playlist.body, playlist.url)
+	if err != nil {
+		// the url given may still name the format
+		format, err = DetectFormat("", nil, s.url)
+	}
+	if err != nil {
+		return format, err
+	}
+	s.mutex.Lock()
+	s.detected = playlist.body
+	s.mutex.Unlock()
+	s.logger.Debug("detected format", "url", s.url, "format", format)
+	return format, nil
+}
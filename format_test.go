@@ -0,0 +1,99 @@
+package ottscanner
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		url         string
+		expected    ContentFormat
+	}{
+		{"application/vnd.apple.mpegurl", "", "http://origin/live", HLS},
+		{"application/dash+xml; charset=utf-8", "", "http://origin/live.m3u8", DASH},
+		{"text/plain", "\xef\xbb\xbf\n#EXTM3U\n#EXT-X-VERSION:3\n", "http://origin/live", HLS},
+		{"application/octet-stream", `<?xml version="1.0"?><MPD type="static">`, "http://origin/live", DASH},
+		{"", "", "http://origin/live/manifest(format=m3u8-aapl)", HLS},
+		{"", "", "http://origin/live/manifest?format=mpd-time-csf", DASH},
+		{"", "", "http://origin/live.mpd?token=a", DASH},
+		{"text/html", "<html></html>", "http://origin/index.html", UnknownFormat},
+	}
+	for _, test := range tests {
+		format, err := DetectFormat(test.contentType, []byte(test.body), test.url)
+		if format != test.expected {
+			t.Errorf("expected %v for %+v, got: %v", test.expected, test, format)
+		}
+		if (test.expected == UnknownFormat) != errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("unexpected error for %+v: %v", test, err)
+		}
+	}
+	if format, err := ParseContentFormat("DASH"); err != nil || format != DASH {
+		t.Errorf("expected dash, got: %v %v", format, err)
+	}
+	if _, err := ParseContentFormat("smooth"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestScanner_DetectFormat(t *testing.T) {
+	origin := newTestOriginHandler()
+	var masterRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/live":
+			http.Redirect(w, r, "/master.m3u8", http.StatusFound)
+		case "/channel":
+			masterRequests++
+			r.URL.Path = "/master.m3u8"
+			origin.ServeHTTP(w, r)
+		default:
+			origin.ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/channel", "/live", "/master.m3u8"} {
+		scanner, err := New(server.URL+path, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams, err := scanner.Streams()
+		if err != nil || len(streams) != 2 {
+			t.Errorf("expected the streams of %s, got: %v %v", path, streams, err)
+		}
+	}
+	// the GET of the detection replaces the HEAD that checks the url and
+	// its body is parsed
+	if masterRequests != 1 {
+		t.Errorf("expected one request to detect and parse the playlist, got: %d", masterRequests)
+	}
+
+	// and the GET is kept in the report
+	scanner, err := New(server.URL+"/channel", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	var fetches int
+	for _, fetch := range scanner.Report().Playlists {
+		if fetch.URL == server.URL+"/channel" && fetch.Status == http.StatusOK && fetch.Bytes > 0 {
+			fetches++
+		}
+	}
+	if fetches != 1 || masterRequests != 2 {
+		t.Errorf("expected one fetch of the playlist in the report, got: %d of %d requests", fetches, masterRequests)
+	}
+
+	// the format given wins over the content
+	scanner, _ = New(server.URL+"/channel", 4, WithFormat(DASH))
+	if _, err := scanner.Streams(); !errors.Is(err, FailureParse) {
+		t.Errorf("expected the playlist to fail to parse as dash, got: %v", err)
+	}
+}
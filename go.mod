@@ -1,6 +1,6 @@
 module github.com/jkittell/ottscanner
 
-go 1.20
+go 1.21
 
 require (
 	github.com/fatih/color v1.15.0
@@ -8,7 +8,10 @@ require (
 	github.com/jkittell/toolbox v0.0.0-20230413221842-f83782afcec5
 	github.com/nexidian/gocliselect v1.0.0
 	github.com/unki2aut/go-mpd v0.0.0-20200811090714-f633ce416f26
-	golang.org/x/sync v0.1.0
+	go.etcd.io/bbolt v1.3.9
+	golang.org/x/sync v0.5.0
+	golang.org/x/time v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
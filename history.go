@@ -0,0 +1,440 @@
+package ottscanner
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// historyBucket holds a bucket of scan records per channel keyed by the
+// start time of the scan
+var historyBucket = []byte("scans")
+
+// History keeps a summary of every scan in an embedded bbolt database so
+// trends can be queried across runs. A history file can be open by one
+// process at a time.
+type History struct {
+	// Logger receives the errors of OnScan. Nothing is logged when it
+	// is nil.
+	Logger *slog.Logger
+	db     *bolt.DB
+}
+
+// StreamSummary is the outcome of the segments of an ABR stream in a scan.
+type StreamSummary struct {
+	Name     string `json:"name"`
+	Segments int    `json:"segments"`
+	Failures int    `json:"failures"`
+	// Statuses counts the responses by HTTP status code, 0 when there
+	// was no response.
+	Statuses map[int]int `json:"statuses,omitempty"`
+}
+
+// HistoryRecord is the summary of a scan kept in the history.
+type HistoryRecord struct {
+	Channel  string          `json:"channel"`
+	Kind     string          `json:"kind,omitempty"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	OK       bool            `json:"ok"`
+	Error    string          `json:"error,omitempty"`
+	Segments int             `json:"segments"`
+	Failures int             `json:"failures"`
+	Streams  []StreamSummary `json:"streams,omitempty"`
+}
+
+// TrendPoint summarizes the scans of a channel that started within
+// a step of a trend.
+type TrendPoint struct {
+	Start        time.Time `json:"start"`
+	Scans        int       `json:"scans"`
+	FailedScans  int       `json:"failed_scans"`
+	Segments     int       `json:"segments"`
+	Failures     int       `json:"failures"`
+	FailureRate  float64   `json:"failure_rate"`
+	Availability float64   `json:"availability"`
+}
+
+// OpenHistory opens or creates the history database at path.
+func OpenHistory(path string) (*History, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, newScannerError(err, fmt.Sprintf("error opening history: %s", path))
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, newScannerError(err, fmt.Sprintf("error opening history: %s", path))
+	}
+	return &History{db: db}, nil
+}
+
+// Close closes the database.
+func (h *History) Close() error {
+	return h.db.Close()
+}
+
+// WithHistory records every Scan and Random call of the scanner in the
+// history under the channel of WithChannel or the url.
+func WithHistory(history *History) Option {
+	return func(s *Scanner) {
+		s.history = history
+	}
+}
+
+// newHistoryRecord summarizes a scan. The report may be nil when the scan
+// failed before any segment was requested.
+func newHistoryRecord(channel string, report *Report, err error) HistoryRecord {
+	record := HistoryRecord{Channel: channel, Finished: time.Now()}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if report == nil {
+		record.Started = record.Finished
+		return record
+	}
+	record.Kind = report.Kind
+	record.Started = report.Started
+	if !report.Finished.IsZero() {
+		record.Finished = report.Finished
+	}
+	for _, stream := range report.Streams {
+		summary := StreamSummary{Name: stream.Name, Statuses: make(map[int]int)}
+		for _, result := range stream.Segments {
+			summary.Segments++
+			if !result.OK {
+				summary.Failures++
+			}
+			summary.Statuses[result.Status]++
+		}
+		record.Segments += summary.Segments
+		record.Failures += summary.Failures
+		record.Streams = append(record.Streams, summary)
+	}
+	record.OK = err == nil && record.Failures == 0
+	return record
+}
+
+// historyKey sorts records of a channel by start time
+func historyKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// Record adds a scan of a channel to the history.
+func (h *History) Record(channel string, report *Report, err error) error {
+	return h.Add(newHistoryRecord(channel, report, err))
+}
+
+// Add adds a record to the history. A record of the same channel that
+// started at the same time is replaced.
+func (h *History) Add(record HistoryRecord) error {
+	if record.Channel == "" {
+		return newScannerError(errors.New("history record needs a channel"), "history")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return newScannerError(err, "error encoding history record")
+	}
+	err = h.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(record.Channel))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(historyKey(record.Started), data)
+	})
+	if err != nil {
+		return newScannerError(err, fmt.Sprintf("error recording history of %s", record.Channel))
+	}
+	return nil
+}
+
+// OnScan records a scan of a monitored stream. Plug it into
+// MonitorOptions.OnScan.
+func (h *History) OnScan(health StreamHealth, report *Report, err error) {
+	if recordErr := h.Record(health.Name, report, err); recordErr != nil {
+		orDiscard(h.Logger).Error("error recording history", "channel", health.Name, "error", recordErr)
+	}
+}
+
+// Channels returns the channels in the history in sorted order.
+func (h *History) Channels() ([]string, error) {
+	var channels []string
+	err := h.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucket).ForEach(func(name, _ []byte) error {
+			channels = append(channels, string(name))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, newScannerError(err, "error reading history")
+	}
+	sort.Strings(channels)
+	return channels, nil
+}
+
+// Records returns the records of a channel that started within
+// [from, to) in order. A zero from or to has no bound.
+func (h *History) Records(channel string, from, to time.Time) ([]HistoryRecord, error) {
+	var records []HistoryRecord
+	err := h.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket).Bucket([]byte(channel))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		end := historyKey(to)
+		key, value := cursor.First()
+		if !from.IsZero() {
+			key, value = cursor.Seek(historyKey(from))
+		}
+		for ; key != nil; key, value = cursor.Next() {
+			if !to.IsZero() && string(key) >= string(end) {
+				break
+			}
+			var record HistoryRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, newScannerError(err, fmt.Sprintf("error reading history of %s", channel))
+	}
+	return records, nil
+}
+
+// Prune removes the records that started before the given time and
+// returns how many were removed.
+func (h *History) Prune(before time.Time) (int, error) {
+	var removed int
+	err := h.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucket).ForEach(func(name, _ []byte) error {
+			cursor := tx.Bucket(historyBucket).Bucket(name).Cursor()
+			end := string(historyKey(before))
+			for key, _ := cursor.First(); key != nil && string(key) < end; key, _ = cursor.First() {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				removed++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return removed, newScannerError(err, "error pruning history")
+	}
+	return removed, nil
+}
+
+// Availability returns the fraction of scans of a channel without
+// failures that started within [from, to), or 0 with no scans.
+func (h *History) Availability(channel string, from, to time.Time) (float64, error) {
+	records, err := h.Records(channel, from, to)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+	var ok int
+	for _, record := range records {
+		if record.OK {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(records)), nil
+}
+
+// Trend summarizes the scans of a channel that started within [from, to)
+// in steps of the given size starting at from. Steps without scans are
+// left out.
+func (h *History) Trend(channel string, from, to time.Time, step time.Duration) ([]TrendPoint, error) {
+	if step <= 0 {
+		return nil, newScannerError(errors.New("trend step must be positive"), step.String())
+	}
+	records, err := h.Records(channel, from, to)
+	if err != nil {
+		return nil, err
+	}
+	origin := from
+	if origin.IsZero() && len(records) > 0 {
+		origin = records[0].Started.Truncate(step)
+	}
+	var trend []TrendPoint
+	for _, record := range records {
+		start := origin.Add(record.Started.Sub(origin) / step * step)
+		if len(trend) == 0 || !trend[len(trend)-1].Start.Equal(start) {
+			trend = append(trend, TrendPoint{Start: start})
+		}
+		point := &trend[len(trend)-1]
+		point.Scans++
+		if !record.OK {
+			point.FailedScans++
+		}
+		point.Segments += record.Segments
+		point.Failures += record.Failures
+	}
+	for i := range trend {
+		if trend[i].Segments > 0 {
+			trend[i].FailureRate = float64(trend[i].Failures) / float64(trend[i].Segments)
+		}
+		trend[i].Availability = float64(trend[i].Scans-trend[i].FailedScans) / float64(trend[i].Scans)
+	}
+	return trend, nil
+}
+
+// FailingSince returns when a stream of a channel started responding
+// with the status code: the start of the first of the latest scans in a
+// row that saw the status for the stream. Status 0 matches any failed
+// segment. It returns false when the latest scan of the stream did not
+// see the status.
+func (h *History) FailingSince(channel, stream string, status int) (time.Time, bool, error) {
+	records, err := h.Records(channel, time.Time{}, time.Time{})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	since := failingSince(records, stream, status)
+	return since, !since.IsZero(), nil
+}
+
+func failingSince(records []HistoryRecord, stream string, status int) time.Time {
+	var since time.Time
+	for i := len(records) - 1; i >= 0; i-- {
+		summary, ok := records[i].stream(stream)
+		if !ok {
+			// scans that did not get as far as the stream do not end a streak
+			continue
+		}
+		failing := summary.Failures > 0
+		if status != 0 {
+			failing = summary.Statuses[status] > 0
+		}
+		if !failing {
+			break
+		}
+		since = records[i].Started
+	}
+	return since
+}
+
+func (r *HistoryRecord) stream(name string) (StreamSummary, bool) {
+	for _, stream := range r.Streams {
+		if stream.Name == name {
+			return stream, true
+		}
+	}
+	return StreamSummary{}, false
+}
+
+// FailingStream is a stream that responded with an error status in the
+// latest scan of a channel.
+type FailingStream struct {
+	Stream string `json:"stream"`
+	// Status is the HTTP status code, 0 when there was no response.
+	Status int       `json:"status"`
+	Since  time.Time `json:"since"`
+}
+
+// Failing returns the streams and error statuses of the latest scan of
+// a channel that got as far as the streams with the time each of them
+// started.
+func (h *History) Failing(channel string) ([]FailingStream, error) {
+	records, err := h.Records(channel, time.Time{}, time.Time{})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return failingStreams(records), nil
+}
+
+func failingStreams(records []HistoryRecord) []FailingStream {
+	latest := len(records) - 1
+	for latest > 0 && len(records[latest].Streams) == 0 {
+		latest--
+	}
+	var failing []FailingStream
+	for _, stream := range records[latest].Streams {
+		for status, count := range stream.Statuses {
+			if count == 0 || (status >= 200 && status < 300) {
+				continue
+			}
+			since := failingSince(records, stream.Name, status)
+			failing = append(failing, FailingStream{Stream: stream.Name, Status: status, Since: since})
+		}
+	}
+	sort.Slice(failing, func(i, j int) bool {
+		if failing[i].Stream != failing[j].Stream {
+			return failing[i].Stream < failing[j].Stream
+		}
+		return failing[i].Status < failing[j].Status
+	})
+	return failing
+}
+
+// HistorySummary answers the common questions about a channel: how
+// available it was over a window, how its failure rate trended and
+// since when its failing streams have been failing.
+type HistorySummary struct {
+	Channel      string          `json:"channel"`
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	Scans        int             `json:"scans"`
+	Availability float64         `json:"availability"`
+	FailureRate  float64         `json:"failure_rate"`
+	Trend        []TrendPoint    `json:"trend"`
+	Failing      []FailingStream `json:"failing,omitempty"`
+}
+
+// Summary summarizes the scans of a channel that started within
+// [from, to) with a trend in steps of the given size.
+func (h *History) Summary(channel string, from, to time.Time, step time.Duration) (HistorySummary, error) {
+	summary := HistorySummary{Channel: channel, From: from, To: to}
+	trend, err := h.Trend(channel, from, to, step)
+	if err != nil {
+		return summary, err
+	}
+	summary.Trend = trend
+	var ok, segments, failures int
+	for _, point := range trend {
+		summary.Scans += point.Scans
+		ok += point.Scans - point.FailedScans
+		segments += point.Segments
+		failures += point.Failures
+	}
+	if summary.Scans > 0 {
+		summary.Availability = float64(ok) / float64(summary.Scans)
+	}
+	if segments > 0 {
+		summary.FailureRate = float64(failures) / float64(segments)
+	}
+	summary.Failing, err = h.Failing(channel)
+	return summary, err
+}
+
+// RecordBatch records the scan of every channel of a batch keyed by
+// channel name.
+func (h *History) RecordBatch(report *BatchReport) error {
+	for _, key := range report.Keys() {
+		channel := report.Channels[key]
+		var err error
+		if channel.Error != "" {
+			err = errors.New(channel.Error)
+		}
+		record := newHistoryRecord(key, channel.Report, err)
+		if channel.Report == nil {
+			record.Started, record.Finished = report.Started, report.Finished
+		}
+		if err := h.Add(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package ottscanner
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestHistory(t *testing.T) *History {
+	t.Helper()
+	history, err := OpenHistory(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { history.Close() })
+	return history
+}
+
+// testScanReport is a scan of a low and a high stream where the high
+// stream responded with the status to every segment
+func testScanReport(started time.Time, high int) *Report {
+	low := StreamReport{Name: "low.m3u8"}
+	upper := StreamReport{Name: "high.m3u8"}
+	for i := 0; i < 4; i++ {
+		low.Segments = append(low.Segments, SegmentResult{OK: true, Status: http.StatusOK})
+		upper.Segments = append(upper.Segments, SegmentResult{OK: high == http.StatusOK, Status: high})
+	}
+	return &Report{Kind: "scan", Started: started, Finished: started.Add(time.Second), Streams: []StreamReport{low, upper}}
+}
+
+func TestHistory(t *testing.T) {
+	history := openTestHistory(t)
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	statuses := []int{200, 200, 404, 200, 500, 404, 404}
+	for i, status := range statuses {
+		if err := history.Record("news", testScanReport(start.Add(time.Duration(i)*30*time.Minute), status), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a scan that could not load the playlist does not end the 404 streak
+	failed := newHistoryRecord("news", nil, errors.New("playlist unavailable"))
+	failed.Started = start.Add(200 * time.Minute)
+	if err := history.Add(failed); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Record("sports", testScanReport(start, 200), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	channels, err := history.Channels()
+	if err != nil || len(channels) != 2 || channels[0] != "news" {
+		t.Fatalf("unexpected channels: %v %v", channels, err)
+	}
+
+	end := start.Add(4 * time.Hour)
+	availability, err := history.Availability("news", start, end)
+	if err != nil || availability != 3.0/8 {
+		t.Errorf("expected an availability of 3/8, got: %v %v", availability, err)
+	}
+	if availability, _ := history.Availability("news", start, start.Add(time.Hour)); availability != 1 {
+		t.Errorf("expected the first hour to be available, got: %v", availability)
+	}
+
+	trend, err := history.Trend("news", start, end, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trend) != 4 {
+		t.Fatalf("expected four hourly points, got: %+v", trend)
+	}
+	if trend[1].Scans != 2 || trend[1].FailedScans != 1 || trend[1].FailureRate != 4.0/16 || trend[1].Availability != 0.5 {
+		t.Errorf("unexpected second hour: %+v", trend[1])
+	}
+	if trend[3].Scans != 2 || trend[3].FailedScans != 2 || trend[3].Segments != 8 {
+		t.Errorf("unexpected last hour: %+v", trend[3])
+	}
+
+	since, ok, err := history.FailingSince("news", "high.m3u8", http.StatusNotFound)
+	if err != nil || !ok || !since.Equal(start.Add(150*time.Minute)) {
+		t.Errorf("expected high to 404 since the sixth scan, got: %v %v %v", since, ok, err)
+	}
+	since, _, _ = history.FailingSince("news", "high.m3u8", 0)
+	if !since.Equal(start.Add(120 * time.Minute)) {
+		t.Errorf("expected high to fail since the fifth scan, got: %v", since)
+	}
+	if _, ok, _ := history.FailingSince("news", "low.m3u8", 0); ok {
+		t.Error("expected low to be ok")
+	}
+
+	summary, err := history.Summary("news", start, end, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Scans != 8 || len(summary.Failing) != 1 || summary.Failing[0].Status != http.StatusNotFound {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	removed, err := history.Prune(start.Add(time.Hour))
+	if err != nil || removed != 3 {
+		t.Errorf("expected three pruned records, got: %d %v", removed, err)
+	}
+}
+
+func TestHistory_Scanner(t *testing.T) {
+	origin := newTestOrigin(t)
+	history := openTestHistory(t)
+	scanner, err := New(origin.URL+"/master.m3u8", 4, WithHistory(history))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	records, err := history.Records(origin.URL+"/master.m3u8", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !records[0].OK || records[0].Segments != 2*testOriginSegments || len(records[0].Streams) != 2 {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	server, err := NewServer(ServerOptions{History: history})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	resp, err := http.Get(api.URL + "/history?channel=" + origin.URL + "/master.m3u8&since=1h&step=10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var summary HistorySummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || summary.Scans != 1 || summary.Availability != 1 {
+		t.Errorf("unexpected history: %d %+v", resp.StatusCode, summary)
+	}
+
+	resp, err = http.Get(api.URL + "/history?channel=x&step=soon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected %d for a bad step, got: %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestHistory_ChannelName(t *testing.T) {
+	origin := newTestOrigin(t)
+	history := openTestHistory(t)
+	channel := Channel{Name: "news", URL: origin.URL + "/master.m3u8"}
+
+	// a scan of the named channel, a batch and the monitor share a key
+	scanner, _ := New(channel.URL, 4, WithChannel(channel.Name), WithHistory(history))
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := ScanBatch([]Channel{channel}, BatchOptions{MaxConcurrency: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.RecordBatch(report); err != nil {
+		t.Fatal(err)
+	}
+	history.OnScan(StreamHealth{Name: channel.Name, URL: channel.URL}, nil, errors.New("playlist timed out"))
+
+	channels, err := history.Channels()
+	if err != nil || len(channels) != 1 || channels[0] != channel.Name {
+		t.Fatalf("expected every scan under %s, got: %v %v", channel.Name, channels, err)
+	}
+	if records, _ := history.Records(channel.Name, time.Time{}, time.Time{}); len(records) != 3 {
+		t.Errorf("expected three records, got: %+v", records)
+	}
+}
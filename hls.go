@@ -9,16 +9,17 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // decodeVariant returns a map where the keys are Segment urls and the values are byte ranges. If no bytes range then empty value for
 // the key.
-func decodeVariant(url string) (Segments, error) {
-	logger.Debugf("decoding hls variant %s", url)
+func (s *Scanner) decodeVariant(url string) (Segments, error) {
+	s.logger.Debug("decoding hls variant", "url", url)
 	// slice to return that gives full url
 	var segments Segments
 
-	playlist, err := toolbox.SendRequest(toolbox.GET, url, "", nil)
+	playlist, err := s.requestPlaylist(url)
 	if err != nil {
 		return segments, newScannerError(err, fmt.Sprintf("unable to download hls variant playlist url %s", url))
 	}
@@ -30,32 +31,49 @@ func decodeVariant(url string) (Segments, error) {
 	// Detect GAP tag and skip adding segments that are missing
 	var gapSegment bool
 
+	// duration of the next media segment from the EXTINF tag
+	var segmentDuration time.Duration
+
 	segmentFormats := []string{".ts", ".fmp4", ".cmfv", ".cmfa", ".aac", ".ac3", ".ec3", ".webvtt"}
+	var lineNumber int
 	scanner := bufio.NewScanner(bytes.NewReader(playlist))
 	for scanner.Scan() {
 		line := scanner.Text()
+		lineNumber++
 		if strings.HasPrefix(line, "#EXT-X-GAP") {
 			gapSegment = true
 		}
+		if strings.HasPrefix(line, "#EXTINF:") {
+			// #EXTINF:10.010,
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				// the duration is only used for playback so the segment is kept
+				s.logger.Warn("problem parsing segment duration", "url", url, "line", lineNumber, "text", line)
+				seconds = 0
+			}
+			segmentDuration = time.Duration(seconds * float64(time.Second))
+		}
 		if strings.Contains(line, "#EXT-X-BYTERANGE") {
 			// #EXT-X-BYTERANGE:44744@2304880
 			// -H "Range: bytes=0-1023"
 			// parse byte range here
 			byteRangeValues := strings.Split(line, ":")
+			byteRangeError := &ParseError{URL: url, Line: lineNumber, Text: line, Err: errors.New("problem parsing byte range")}
 			if len(byteRangeValues) != 2 {
-				message := fmt.Sprintf("problem parsing byte range: %s", byteRangeValues)
-				return segments, newScannerError(errors.New(message), url)
+				return segments, byteRangeError
 			}
 			byteRange := strings.Split(byteRangeValues[1], "@")
+			if len(byteRange) != 2 {
+				return segments, byteRangeError
+			}
 			startNumber, err := strconv.Atoi(byteRange[1])
 			if err != nil {
-				message := fmt.Sprintf("problem parsing byte range: %s", byteRangeValues)
-				return segments, newScannerError(errors.New(message), url)
+				return segments, byteRangeError
 			}
 			sizeNumber, err := strconv.Atoi(byteRange[0])
 			if err != nil {
-				message := fmt.Sprintf("problem parsing byte range: %s", byteRangeValues)
-				return segments, newScannerError(errors.New(message), url)
+				return segments, byteRangeError
 			}
 			byteRangeStart = startNumber
 			byteRangeSize = sizeNumber
@@ -94,7 +112,7 @@ func decodeVariant(url string) (Segments, error) {
 							}
 							segments = append(segments, seg)
 						} else {
-							return segments, newScannerError(errors.New("unable to parse init Segment: %s"), line)
+							return segments, &ParseError{URL: url, Line: lineNumber, Text: line, Err: errors.New("unable to parse init segment")}
 						}
 					} else {
 						SegmentName := line
@@ -110,8 +128,10 @@ func decodeVariant(url string) (Segments, error) {
 							url:            SegmentURL,
 							byteRangeStart: byteRangeStart,
 							byteRangeSize:  byteRangeSize,
+							duration:       segmentDuration,
 						}
 						segments = append(segments, seg)
+						segmentDuration = 0
 					}
 				}
 			}
@@ -119,17 +139,26 @@ func decodeVariant(url string) (Segments, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return segments, newScannerError(err, fmt.Sprintf("unable to parse hls variant playlist: %s", url))
+		return segments, &ParseError{URL: url, Err: err}
 	}
 
 	return segments, nil
 }
 
-func decodeMaster(url string) (Streams, error) {
-	logger.Debugf("decoding hls master playlist %s", url)
+var (
+	resolutionRegEx = regexp.MustCompile(`[:,]RESOLUTION=(\d+x\d+)`)
+	codecsRegEx     = regexp.MustCompile(`[:,]CODECS="(.*?)"`)
+)
+
+func (s *Scanner) decodeMaster(url string) (Streams, error) {
+	s.logger.Debug("decoding hls master playlist", "url", url)
 	var variants []string
 	var Streams Streams
-	playlist, err := toolbox.SendRequest(toolbox.GET, url, "", nil)
+	// bandwidth, resolution and codecs of each variant from the
+	// EXT-X-STREAM-INF tag before it
+	attributes := make(map[string]Stream)
+	var inf Stream
+	playlist, err := s.requestPlaylist(url)
 	if err != nil {
 		return Streams, newScannerError(err, fmt.Sprintf("unable to download hls master playlist url %s", url))
 	}
@@ -137,8 +166,21 @@ func decodeMaster(url string) (Streams, error) {
 	scanner := bufio.NewScanner(bytes.NewReader(playlist))
 	for scanner.Scan() {
 		line := scanner.Text()
-		if !strings.Contains(line, "#EXT") && strings.Contains(line, "m3u8") {
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF") {
+			regEx := regexp.MustCompile(`[:,]BANDWIDTH=(\d+)`)
+			if match := regEx.FindStringSubmatch(line); match != nil {
+				inf.bandwidth, _ = strconv.Atoi(match[1])
+			}
+			if match := resolutionRegEx.FindStringSubmatch(line); match != nil {
+				inf.resolution = match[1]
+			}
+			if match := codecsRegEx.FindStringSubmatch(line); match != nil {
+				inf.codecs = match[1]
+			}
+		} else if !strings.Contains(line, "#EXT") && strings.Contains(line, "m3u8") {
 			variants = append(variants, line)
+			attributes[line] = inf
+			inf = Stream{}
 		} else if strings.Contains(line, "#EXT-X-I-FRAME-STREAM-INF") || strings.Contains(line, "#EXT-X-MEDIA") {
 			regEx := regexp.MustCompile("URI=\"(.*?)\"")
 			match := regEx.MatchString(line)
@@ -147,14 +189,14 @@ func decodeMaster(url string) (Streams, error) {
 				_, s2, _ := strings.Cut(s1, "=")
 				s3 := strings.Trim(s2, "\"")
 				URI := s3
-				logger.Debugf("variant found in master playlist %s", URI)
+				s.logger.Debug("variant found in master playlist", "url", url, "variant", URI)
 				variants = append(variants, URI)
 			}
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return Streams, newScannerError(err, fmt.Sprintf("unable to parse hls master playlist: %s", url))
+		return Streams, &ParseError{URL: url, Err: err}
 	}
 
 	for _, variant := range variants {
@@ -169,6 +211,9 @@ func decodeMaster(url string) (Streams, error) {
 			name:              variant,
 			url:               StreamURL,
 			masterPlaylistURL: url,
+			bandwidth:         attributes[variant].bandwidth,
+			resolution:        attributes[variant].resolution,
+			codecs:            attributes[variant].codecs,
 			segments:          nil,
 		}
 		Streams = append(Streams, Stream)
@@ -177,27 +222,27 @@ func decodeMaster(url string) (Streams, error) {
 	if len(Streams) > 0 {
 		return Streams, nil
 	} else {
-		return Streams, newScannerError(err, fmt.Sprintf("no variant Streams found in hls master playlist: %s", url))
+		return Streams, newScannerError(ErrNoStreams, fmt.Sprintf("no variant Streams found in hls master playlist: %s", url))
 	}
 }
 
-func parseHLS(url string) (Streams, error) {
+func (s *Scanner) parseHLS(url string) (Streams, error) {
 	var variants Streams
-	variants, err := decodeMaster(url)
+	variants, err := s.decodeMaster(url)
 	if err != nil {
 		return variants, newScannerError(err, "unable to parse hls master playlist")
 	}
 
 	if len(variants) > 0 {
 		for _, v := range variants {
-			segments, err := decodeVariant(v.url)
+			segments, err := s.decodeVariant(v.url)
 			if err != nil {
 				return variants, err
 			}
 			v.segments = segments
 		}
 	} else {
-		segments, err := decodeVariant(url)
+		segments, err := s.decodeVariant(url)
 		if err != nil {
 			return variants, err
 		}
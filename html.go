@@ -0,0 +1,399 @@
+package ottscanner
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// chart sizes of the html report in svg user units
+const (
+	htmlChartWidth  = 800.0
+	htmlChartHeight = 120.0
+	htmlRowHeight   = 24.0
+	htmlLabelWidth  = 160.0
+)
+
+type htmlCount struct {
+	Name  string
+	Count int
+}
+
+type htmlBar struct {
+	X, Y, Width, Height float64
+	Failed              bool
+	Title               string
+}
+
+type htmlStream struct {
+	StreamReport
+	Failures int
+	Latency  LatencySummary
+	Bars     []htmlBar
+	Max      time.Duration
+}
+
+type htmlPoint struct {
+	X         float64
+	Refreshed bool
+	Failed    bool
+	Title     string
+}
+
+type htmlRow struct {
+	Label  string
+	URL    string
+	Y      float64
+	Points []htmlPoint
+}
+
+// htmlReport is everything the html template shows, worked out up front
+// so the template only lays it out
+type htmlReport struct {
+	*Report
+	Duration   time.Duration
+	Segments   int
+	Failures   int
+	Streams    []htmlStream
+	Categories []htmlCount
+	Statuses   []htmlCount
+	Errors     []htmlCount
+	Timeline   []htmlRow
+	// TimelineSpan is the time from the first to the last playlist fetch
+	TimelineSpan   time.Duration
+	TimelineHeight float64
+	Buffer         []htmlBar
+	MaxBuffer      time.Duration
+}
+
+// writeHTML renders the report as a single html page with inline styles
+// and svg charts so it can be attached to a ticket and opened offline.
+func writeHTML(w io.Writer, r *Report) error {
+	view := htmlReport{Report: r, Duration: r.Finished.Sub(r.Started)}
+	categories := make(map[string]int)
+	statuses := make(map[string]int)
+	messages := make(map[string]int)
+	for _, stream := range r.Streams {
+		item := htmlStream{StreamReport: stream}
+		var durations []time.Duration
+		for _, result := range stream.Segments {
+			if result.Duration > item.Max {
+				item.Max = result.Duration
+			}
+			if result.OK {
+				durations = append(durations, result.Duration)
+				continue
+			}
+			item.Failures++
+			categories[resultCategory(result)]++
+			status := "no response"
+			if result.Status != 0 {
+				status = fmt.Sprint(result.Status)
+			}
+			statuses[status]++
+			messages[result.Error]++
+		}
+		item.Latency = summarizeLatency(durations)
+		item.Bars = htmlBars(stream.Segments, item.Max)
+		view.Segments += len(stream.Segments)
+		view.Failures += item.Failures
+		view.Streams = append(view.Streams, item)
+	}
+	view.Categories = sortedCounts(categories, 0)
+	view.Statuses = sortedCounts(statuses, 0)
+	view.Errors = sortedCounts(messages, 10)
+	view.Timeline, view.TimelineSpan = htmlTimeline(r.Playlists)
+	view.TimelineHeight = float64(len(view.Timeline))*htmlRowHeight + htmlRowHeight
+	if r.Playback != nil {
+		view.Buffer, view.MaxBuffer = htmlBufferBars(r.Playback.Segments)
+	}
+	if err := htmlTemplate.Execute(w, view); err != nil {
+		return newScannerError(err, "error writing html report")
+	}
+	return nil
+}
+
+// htmlBars draws a bar per segment scaled to the slowest segment
+func htmlBars(results []SegmentResult, max time.Duration) []htmlBar {
+	if len(results) == 0 {
+		return nil
+	}
+	width := htmlChartWidth / float64(len(results))
+	var bars []htmlBar
+	for i, result := range results {
+		height := 2.0
+		if max > 0 {
+			height += (htmlChartHeight - 2) * float64(result.Duration) / float64(max)
+		}
+		bars = append(bars, htmlBar{
+			X:      float64(i) * width,
+			Y:      htmlChartHeight - height,
+			Width:  width * 0.9,
+			Height: height,
+			Failed: !result.OK,
+			Title:  fmt.Sprintf("%s %v", result.Name, result.Duration),
+		})
+	}
+	return bars
+}
+
+// htmlBufferBars draws the playback buffer after each played segment
+func htmlBufferBars(segments []PlaybackSegment) ([]htmlBar, time.Duration) {
+	var max time.Duration
+	for _, segment := range segments {
+		if segment.Buffer > max {
+			max = segment.Buffer
+		}
+	}
+	if len(segments) == 0 {
+		return nil, max
+	}
+	width := htmlChartWidth / float64(len(segments))
+	var bars []htmlBar
+	for i, segment := range segments {
+		height := 2.0
+		if max > 0 {
+			height += (htmlChartHeight - 2) * float64(segment.Buffer) / float64(max)
+		}
+		bars = append(bars, htmlBar{
+			X:      float64(i) * width,
+			Y:      htmlChartHeight - height,
+			Width:  width * 0.9,
+			Height: height,
+			Failed: segment.Error != "",
+			Title:  fmt.Sprintf("%s %s buffer %v", segment.Stream, segment.Name, segment.Buffer),
+		})
+	}
+	return bars, max
+}
+
+// htmlTimeline places every playlist fetch on a row per playlist in the
+// order the playlists were first fetched
+func htmlTimeline(fetches []PlaylistFetch) ([]htmlRow, time.Duration) {
+	if len(fetches) == 0 {
+		return nil, 0
+	}
+	first, last := fetches[0].Fetched, fetches[0].Fetched
+	for _, fetch := range fetches {
+		if fetch.Fetched.Before(first) {
+			first = fetch.Fetched
+		}
+		if fetch.Fetched.After(last) {
+			last = fetch.Fetched
+		}
+	}
+	span := last.Sub(first)
+	width := htmlChartWidth - htmlLabelWidth - 10
+	var rows []htmlRow
+	index := make(map[string]int)
+	for _, fetch := range fetches {
+		i, ok := index[fetch.URL]
+		if !ok {
+			i = len(rows)
+			index[fetch.URL] = i
+			rows = append(rows, htmlRow{Label: path.Base(fetch.URL), URL: fetch.URL, Y: float64(i)*htmlRowHeight + htmlRowHeight/2})
+		}
+		x := htmlLabelWidth
+		if span > 0 {
+			x += width * float64(fetch.Fetched.Sub(first)) / float64(span)
+		}
+		title := fmt.Sprintf("%s +%v", fetch.Fetched.Format(time.RFC3339Nano), fetch.Fetched.Sub(first))
+		if fetch.Modified != nil {
+			title += " modified " + fetch.Modified.Format(time.RFC3339)
+		}
+		if fetch.Error != "" {
+			title += " " + fetch.Error
+		}
+		rows[i].Points = append(rows[i].Points, htmlPoint{
+			X:         x,
+			Refreshed: fetch.Refreshed,
+			Failed:    fetch.Error != "",
+			Title:     title,
+		})
+	}
+	return rows, span
+}
+
+// sortedCounts orders counts from most to least, keeping at most limit
+// of them when limit is above 0
+func sortedCounts(counts map[string]int, limit int) []htmlCount {
+	var sorted []htmlCount
+	for name, count := range counts {
+		sorted = append(sorted, htmlCount{name, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+	"ms": func(d time.Duration) string {
+		return fmt.Sprintf("%.1f ms", float64(d)/float64(time.Millisecond))
+	},
+	"percent": func(part, whole int) string {
+		if whole == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(whole))
+	},
+	"mbps": func(bandwidth int) string {
+		if bandwidth == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%.2f Mbps", float64(bandwidth)/1e6)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ottscanner {{.Kind}} report {{.URL}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; word-break: break-all; }
+h2 { font-size: 1.15em; margin-top: 2em; border-bottom: 1px solid #ddd; }
+table { border-collapse: collapse; margin: 0.5em 0; }
+th, td { border: 1px solid #ddd; padding: 0.25em 0.6em; text-align: left; font-size: 0.9em; }
+th { background: #f4f4f4; }
+td.num { text-align: right; }
+.ok { color: #1a7f37; }
+.failed { color: #cf222e; }
+.summary span { display: inline-block; margin-right: 2em; }
+svg { display: block; margin: 0.5em 0; }
+svg .bar { fill: #4c8bf5; }
+svg .bar.failed { fill: #cf222e; }
+svg .fetch { fill: #fff; stroke: #4c8bf5; stroke-width: 2; }
+svg .fetch.refreshed { fill: #4c8bf5; }
+svg .fetch.failed { fill: #cf222e; stroke: #cf222e; }
+svg text { font-size: 11px; fill: #555; }
+details { margin: 0.5em 0; }
+summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>{{.Kind}} report for {{.URL}}</h1>
+<p class="summary">
+<span>started {{time .Started}}</span>
+<span>took {{.Duration}}</span>
+<span>{{.Segments}} segments</span>
+<span class="{{if .Failures}}failed{{else}}ok{{end}}">{{.Failures}} failed ({{percent .Failures .Segments}})</span>
+</p>
+{{with .Playback}}
+<p class="summary">
+<span>profile {{if .Profile}}{{.Profile}}{{else}}unthrottled{{end}}</span>
+<span>startup {{.StartupTime}}</span>
+<span>{{.Rebuffers}} rebuffers ({{.RebufferTime}})</span>
+<span>{{.Switches}} switches</span>
+</p>
+{{end}}
+
+<h2>Ladder</h2>
+<table>
+<tr><th>stream</th><th>bandwidth</th><th>resolution</th><th>codecs</th><th>segments</th><th>failed</th><th>p50</th><th>p90</th><th>p99</th><th>max</th><th>playlist modified</th></tr>
+{{range .Streams}}
+<tr>
+<td>{{.Name}}</td>
+<td class="num">{{mbps .Bandwidth}}</td>
+<td>{{.Resolution}}</td>
+<td>{{.Codecs}}</td>
+<td class="num">{{len .Segments}}</td>
+<td class="num {{if .Failures}}failed{{end}}">{{.Failures}}</td>
+<td class="num">{{ms .Latency.P50}}</td>
+<td class="num">{{ms .Latency.P90}}</td>
+<td class="num">{{ms .Latency.P99}}</td>
+<td class="num">{{ms .Latency.Max}}</td>
+<td>{{with .PlaylistModified}}{{time .}}{{end}}</td>
+</tr>
+{{end}}
+</table>
+
+<h2>Latency</h2>
+{{range .Streams}}
+<h3>{{.Name}} <small>slowest {{ms .Max}}</small></h3>
+<svg width="800" height="120" viewBox="0 0 800 120" role="img" aria-label="segment latency of {{.Name}}">
+{{range .Bars}}<rect class="bar{{if .Failed}} failed{{end}}" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Title}}</title></rect>
+{{end}}</svg>
+{{end}}
+
+{{if .Buffer}}
+<h2>Playback buffer</h2>
+<svg width="800" height="120" viewBox="0 0 800 120" role="img" aria-label="playback buffer">
+{{range .Buffer}}<rect class="bar{{if .Failed}} failed{{end}}" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Title}}</title></rect>
+{{end}}</svg>
+<p>largest buffer {{.MaxBuffer}}</p>
+{{end}}
+
+<h2>Errors</h2>
+{{if .Failures}}
+<table>
+<tr><th>category</th><th>segments</th></tr>
+{{range .Categories}}<tr><td>{{.Name}}</td><td class="num">{{.Count}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>status</th><th>segments</th></tr>
+{{range .Statuses}}<tr><td>{{.Name}}</td><td class="num">{{.Count}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>most common errors</th><th>segments</th></tr>
+{{range .Errors}}<tr><td>{{.Name}}</td><td class="num">{{.Count}}</td></tr>
+{{end}}</table>
+{{else}}
+<p class="ok">no failed segments</p>
+{{end}}
+
+{{if .Timeline}}
+<h2>Playlist refreshes</h2>
+<p>{{len .Playlists}} playlist fetches over {{.TimelineSpan}}. Filled points changed since the previous fetch.</p>
+<svg width="800" height="{{.TimelineHeight}}" viewBox="0 0 800 {{.TimelineHeight}}" role="img" aria-label="playlist fetches">
+{{range $row := .Timeline}}<text x="0" y="{{$row.Y}}" dy="4">{{$row.Label}}<title>{{$row.URL}}</title></text>
+{{range .Points}}<circle class="fetch{{if .Refreshed}} refreshed{{end}}{{if .Failed}} failed{{end}}" cx="{{.X}}" cy="{{$row.Y}}" r="5"><title>{{.Title}}</title></circle>
+{{end}}{{end}}</svg>
+<table>
+<tr><th>fetched</th><th>playlist</th><th>status</th><th>took</th><th>bytes</th><th>last modified</th><th>refreshed</th></tr>
+{{range .Playlists}}
+<tr>
+<td>{{time .Fetched}}</td>
+<td>{{.URL}}</td>
+<td class="{{if .Error}}failed{{end}}">{{if .Status}}{{.Status}}{{end}} {{.Error}}</td>
+<td class="num">{{ms .Duration}}</td>
+<td class="num">{{.Bytes}}</td>
+<td>{{with .Modified}}{{time .}}{{end}}</td>
+<td>{{if .Refreshed}}yes{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+
+<h2>Segments</h2>
+{{range .Streams}}
+<details{{if .Failures}} open{{end}}>
+<summary>{{.Name}}: {{len .Segments}} segments, <span class="{{if .Failures}}failed{{else}}ok{{end}}">{{.Failures}} failed</span></summary>
+<table>
+<tr><th>segment</th><th>result</th><th>status</th><th>took</th><th>error</th></tr>
+{{range .Segments}}
+<tr>
+<td><a href="{{.URL}}">{{.Name}}</a></td>
+<td class="{{if .OK}}ok{{else}}failed{{end}}">{{if .OK}}OK{{else}}ERR{{end}}</td>
+<td class="num">{{if .Status}}{{.Status}}{{end}}</td>
+<td class="num">{{ms .Duration}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{end}}
+</table>
+</details>
+{{end}}
+</body>
+</html>
+`))
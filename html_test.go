@@ -0,0 +1,103 @@
+package ottscanner
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReport_WriteHTML(t *testing.T) {
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/high_2.ts" {
+			http.NotFound(w, r)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	scanner, err := New(server.URL+"/master.m3u8", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// scan twice so the report only has the playlist fetches of the second scan
+	for i := 0; i < 2; i++ {
+		if _, err := scanner.Scan(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report := scanner.Report()
+	if len(report.Playlists) == 0 || report.Playlists[0].URL != server.URL+"/master.m3u8" {
+		t.Fatalf("expected the playlist fetches of the second scan to start at the master: %+v", report.Playlists)
+	}
+	for _, fetch := range report.Playlists {
+		if fetch.Refreshed || fetch.Status != http.StatusOK {
+			t.Errorf("expected unchanged vod playlists: %+v", fetch)
+		}
+	}
+
+	var html strings.Builder
+	if err := report.Write(&html, ReportHTML); err != nil {
+		t.Fatal(err)
+	}
+	page := html.String()
+	expected := []string{
+		"<!DOCTYPE html>",
+		"<td>1280x720</td>",
+		"<td>avc1.64001f,mp4a.40.2</td>",
+		`aria-label="segment latency of high.m3u8"`,
+		`<rect class="bar failed"`,
+		"<tr><td>http_4xx</td><td class=\"num\">1</td></tr>",
+		"<tr><td>404</td><td class=\"num\">1</td></tr>",
+		"playlist fetches over",
+		"<title>" + server.URL + "/high.m3u8</title>",
+		`<details open>`,
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(page, fragment) {
+			t.Errorf("missing %s in the html report", fragment)
+		}
+	}
+	for _, external := range []string{"<script", "<link", "<img", "@import"} {
+		if strings.Contains(page, external) {
+			t.Errorf("expected no external assets, found %s", external)
+		}
+	}
+}
+
+func TestScanner_PlaylistRefreshes(t *testing.T) {
+	origin := newTestOriginHandler()
+	var fetches int
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin.ServeHTTP(w, r)
+		// the low playlist changes on every fetch like a live playlist
+		if r.URL.Path == "/low.m3u8" {
+			mutex.Lock()
+			fetches++
+			fmt.Fprintf(w, "# refresh %d\n", fetches)
+			mutex.Unlock()
+		}
+	}))
+	defer server.Close()
+
+	scanner, err := New(server.URL+"/master.m3u8", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := scanner.Scan(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fetch := range scanner.Report().Playlists {
+		live := strings.HasSuffix(fetch.URL, "/low.m3u8")
+		if fetch.Refreshed != live {
+			t.Errorf("expected only the low playlist to refresh: %+v", fetch)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package ottscanner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// JobStore keeps the jobs of a Server.
+type JobStore interface {
+	// Put adds or replaces a job.
+	Put(job Job) error
+	// Get returns the job with the id and false if there is none.
+	Get(id string) (Job, bool, error)
+	// List returns every job ordered by creation time.
+	List() ([]Job, error)
+}
+
+type memoryJobStore struct {
+	jobs  map[string]Job
+	mutex sync.Mutex
+}
+
+// NewMemoryJobStore returns a job store that keeps jobs in memory
+// until the process exits.
+func NewMemoryJobStore() JobStore {
+	return &memoryJobStore{jobs: make(map[string]Job)}
+}
+
+func (m *memoryJobStore) Put(job Job) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.jobs[job.ID] = job
+	return nil
+}
+
+func (m *memoryJobStore) Get(id string) (Job, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok, nil
+}
+
+func (m *memoryJobStore) List() ([]Job, error) {
+	m.mutex.Lock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.mutex.Unlock()
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+type fileJobStore struct {
+	directory string
+	mutex     sync.Mutex
+}
+
+// NewFileJobStore returns a job store that keeps every job as a json
+// file in the directory so jobs survive a restart.
+func NewFileJobStore(directory string) (JobStore, error) {
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, newScannerError(err, fmt.Sprintf("error creating job store: %s", directory))
+	}
+	return &fileJobStore{directory: directory}, nil
+}
+
+func (f *fileJobStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", newScannerError(errors.New("invalid job id"), id)
+	}
+	return filepath.Join(f.directory, id+".json"), nil
+}
+
+func (f *fileJobStore) Put(job Job) error {
+	path, err := f.path(job.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return newScannerError(err, fmt.Sprintf("error encoding job %s", job.ID))
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// write and rename so a crash never leaves half a job behind
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0o644); err != nil {
+		return newScannerError(err, fmt.Sprintf("error writing job %s", job.ID))
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return newScannerError(err, fmt.Sprintf("error writing job %s", job.ID))
+	}
+	return nil
+}
+
+func (f *fileJobStore) Get(id string) (Job, bool, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return Job{}, false, nil
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return readJob(path)
+}
+
+func readJob(path string) (Job, bool, error) {
+	var job Job
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return job, false, nil
+	}
+	if err != nil {
+		return job, false, newScannerError(err, fmt.Sprintf("error reading job: %s", path))
+	}
+	if err := json.Unmarshal(data, &job); err != nil {
+		return job, false, newScannerError(err, fmt.Sprintf("error decoding job: %s", path))
+	}
+	return job, true, nil
+}
+
+func (f *fileJobStore) List() ([]Job, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	paths, err := filepath.Glob(filepath.Join(f.directory, "*.json"))
+	if err != nil {
+		return nil, newScannerError(err, f.directory)
+	}
+	jobs := make([]Job, 0, len(paths))
+	for _, path := range paths {
+		job, ok, err := readJob(path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			jobs = append(jobs, job)
+		}
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].Created.Equal(jobs[j].Created) {
+			return jobs[i].Created.Before(jobs[j].Created)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
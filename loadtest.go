@@ -0,0 +1,177 @@
+package ottscanner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LoadTestOptions configures LoadTest.
+type LoadTestOptions struct {
+	// Viewers is the number of virtual viewers to run.
+	Viewers int
+	// Jitter is the longest a viewer waits before it starts playing.
+	Jitter time.Duration
+	// Seed makes the start times and network profiles of the viewers reproducible.
+	Seed int64
+	// Playback configures the emulated player of every viewer. Each
+	// viewer gets its own copy of the network profile seeded from Seed.
+	Playback PlaybackOptions
+}
+
+// LatencySummary holds percentiles of request durations.
+type LatencySummary struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// LoadTestReport aggregates the playback of every virtual viewer.
+type LoadTestReport struct {
+	URL           string        `json:"url"`
+	Viewers       int           `json:"viewers"`
+	FailedViewers int           `json:"failed_viewers"`
+	Duration      time.Duration `json:"duration"`
+	// Requests is the number of segment requests made by all viewers.
+	Requests    int            `json:"requests"`
+	Errors      int            `json:"errors"`
+	ErrorRate   float64        `json:"error_rate"`
+	RequestRate float64        `json:"request_rate"`
+	Latency     LatencySummary `json:"latency"`
+	// Rebuffers is the total number of rebuffer events of all viewers.
+	Rebuffers         int              `json:"rebuffers"`
+	RebufferTime      time.Duration    `json:"rebuffer_time"`
+	ViewersRebuffered int              `json:"viewers_rebuffered"`
+	Sessions          []PlaybackReport `json:"sessions"`
+}
+
+// LoadTest simulates viewers watching the stream at the same time, each
+// running the emulated playback loop after a jittered start. Every viewer
+// plays at once whatever the maxConcurrency of the scanner. With a
+// simulated network profile the duration and request rate are measured
+// on the virtual clock like the latency of the requests.
+func (s *Scanner) LoadTest(options LoadTestOptions) (LoadTestReport, error) {
+	report := LoadTestReport{URL: s.url, Viewers: options.Viewers}
+	if options.Viewers < 1 {
+		return report, newScannerError(errors.New("load test needs at least one viewer"), s.url)
+	}
+
+	random := rand.New(rand.NewSource(options.Seed))
+	delays := make([]time.Duration, options.Viewers)
+	for i := range delays {
+		if options.Jitter > 0 {
+			delays[i] = time.Duration(random.Int63n(int64(options.Jitter)))
+		}
+	}
+
+	sessions := make([]PlaybackReport, options.Viewers)
+	failed := make([]bool, options.Viewers)
+	var wg sync.WaitGroup
+	started := time.Now()
+	for viewer := 0; viewer < options.Viewers; viewer++ {
+		wg.Add(1)
+		go func(viewer int) {
+			defer wg.Done()
+			timer := time.NewTimer(delays[viewer])
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-s.ctx.Done():
+				failed[viewer] = true
+				return
+			}
+
+			playback := options.Playback
+			if playback.Profile != nil {
+				profile := *playback.Profile
+				profile.Seed += options.Seed + int64(viewer)
+				playback.Profile = &profile
+			}
+			session, err := s.EmulatePlayback(playback)
+			if err != nil {
+				s.logger.Warn("viewer failed", "url", s.url, "viewer", viewer, "error", err)
+				failed[viewer] = true
+			}
+			sessions[viewer] = session
+		}(viewer)
+	}
+	wg.Wait()
+	report.Duration = time.Since(started)
+	report.Sessions = sessions
+	if options.Playback.Profile != nil && options.Playback.Simulated {
+		// the segments took virtual time so the load test did too
+		report.Duration = 0
+		for viewer, session := range sessions {
+			elapsed := delays[viewer]
+			for _, segment := range session.Segments {
+				elapsed += segment.DownloadTime
+			}
+			report.Duration = max(report.Duration, elapsed)
+		}
+	}
+
+	var latencies []time.Duration
+	for viewer, session := range sessions {
+		if failed[viewer] {
+			report.FailedViewers++
+		}
+		for _, segment := range session.Segments {
+			report.Requests++
+			if segment.Error != "" {
+				report.Errors++
+			}
+			latencies = append(latencies, segment.DownloadTime)
+		}
+		report.Rebuffers += session.Rebuffers
+		report.RebufferTime += session.RebufferTime
+		if session.Rebuffers > 0 {
+			report.ViewersRebuffered++
+		}
+	}
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	}
+	if report.Duration > 0 {
+		report.RequestRate = float64(report.Requests) / report.Duration.Seconds()
+	}
+	report.Latency = summarizeLatency(latencies)
+
+	if report.FailedViewers == options.Viewers {
+		return report, newScannerError(errors.New("every viewer failed"), fmt.Sprintf("load test: %s", s.url))
+	}
+	return report, nil
+}
+
+// summarizeLatency returns the percentiles of the durations
+func summarizeLatency(durations []time.Duration) LatencySummary {
+	var summary LatencySummary
+	if len(durations) == 0 {
+		return summary
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	summary.P50 = percentile(sorted, 50)
+	summary.P90 = percentile(sorted, 90)
+	summary.P99 = percentile(sorted, 99)
+	summary.Max = sorted[len(sorted)-1]
+	return summary
+}
+
+// percentile returns the nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
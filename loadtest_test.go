@@ -0,0 +1,85 @@
+package ottscanner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanner_LoadTest(t *testing.T) {
+	origin := newTestOrigin(t)
+	scanner, err := New(origin.URL+"/master.m3u8", maxConcurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := NetworkProfileByName("3g")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viewers := 5
+	report, err := scanner.LoadTest(LoadTestOptions{
+		Viewers: viewers,
+		Jitter:  10 * time.Millisecond,
+		Seed:    1,
+		Playback: PlaybackOptions{
+			Profile:   profile,
+			Simulated: true,
+			Segments:  testOriginSegments,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != viewers*testOriginSegments {
+		t.Fatalf("expected: %d requests, got: %d", viewers*testOriginSegments, report.Requests)
+	}
+	if report.Errors != 0 || report.FailedViewers != 0 {
+		t.Fatalf("expected no errors: %+v", report)
+	}
+	if report.Latency.P50 == 0 || report.Latency.P50 > report.Latency.P99 {
+		t.Fatalf("unexpected latency summary: %+v", report.Latency)
+	}
+	// the 3g profile takes seconds of virtual time, which the duration and
+	// request rate are measured on like the latency
+	if report.Duration < report.Latency.Max || report.RequestRate > float64(report.Requests)/report.Latency.Max.Seconds() {
+		t.Fatalf("expected the duration on the virtual clock: %+v", report)
+	}
+}
+
+func TestScanner_LoadTestConcurrency(t *testing.T) {
+	origin := newTestOrigin(t)
+	// every viewer plays at once even with a concurrency of 1
+	scanner, _ := New(origin.URL+"/master.m3u8", 1)
+	latency := 100 * time.Millisecond
+	profile := &NetworkProfile{
+		Name:  "slow",
+		Steps: []NetworkStep{{Duration: time.Second, Bandwidth: 100_000_000, Latency: latency}},
+	}
+	viewers := 4
+	report, err := scanner.LoadTest(LoadTestOptions{
+		Viewers:  viewers,
+		Jitter:   time.Second,
+		Playback: PlaybackOptions{Profile: profile, Segments: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != viewers {
+		t.Fatalf("expected: %d requests, got: %d", viewers, report.Requests)
+	}
+	if report.Duration > time.Second+time.Duration(viewers-1)*latency {
+		t.Errorf("expected the viewers to play together, took: %v", report.Duration)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 1; i <= 100; i++ {
+		durations = append(durations, time.Duration(i))
+	}
+	summary := summarizeLatency(durations)
+	expected := LatencySummary{P50: 50, P90: 90, P99: 99, Max: 100}
+	if summary != expected {
+		t.Fatalf("expected: %v, got: %v", expected, summary)
+	}
+}
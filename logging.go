@@ -0,0 +1,136 @@
+package ottscanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// discardHandler drops every record so nothing is logged unless a
+// logger is given
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// orDiscard returns the logger, or one that logs nothing when it is nil
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger
+}
+
+// WithLogger sets the logger of the scanner. Records about a request
+// carry its stream, segment, url, status and duration as attributes.
+// Scanners log nothing by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Scanner) {
+		s.logger = orDiscard(logger)
+	}
+}
+
+// logResult logs the result of a segment request at debug level, or as
+// a warning when it failed
+func (s *Scanner) logResult(result SegmentResult) {
+	attrs := []any{"stream", result.Stream, "segment", result.Name, "url", result.URL,
+		"status", result.Status, "duration", result.Duration}
+	if result.OK {
+		s.logger.Debug("segment ok", attrs...)
+		return
+	}
+	s.logger.Warn("segment failed", append(attrs, "error", result.Error)...)
+}
+
+// loggerHandler is a slog.Handler that formats records as text and
+// writes them to an ILogger
+type loggerHandler struct {
+	logger  ILogger
+	handler slog.Handler
+	buffer  *bytes.Buffer
+	mutex   *sync.Mutex
+}
+
+// NewLoggerHandler adapts an ILogger such as a TestingLogger to a
+// slog.Handler for WithLogger. Debug records go to Debugf and the
+// others to Infof with their level.
+func NewLoggerHandler(logger ILogger) slog.Handler {
+	buffer := new(bytes.Buffer)
+	return &loggerHandler{
+		logger: logger,
+		handler: slog.NewTextHandler(buffer, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				if len(groups) == 0 && attr.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return attr
+			},
+		}),
+		buffer: buffer,
+		mutex:  new(sync.Mutex),
+	}
+}
+
+func (h *loggerHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *loggerHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.mutex.Lock()
+	h.buffer.Reset()
+	err := h.handler.Handle(ctx, record)
+	line := strings.TrimSuffix(h.buffer.String(), "\n")
+	h.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if record.Level < slog.LevelInfo {
+		h.logger.Debugf("%s", line)
+	} else {
+		h.logger.Infof("%s", line)
+	}
+	return nil
+}
+
+func (h *loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &loggerHandler{logger: h.logger, handler: h.handler.WithAttrs(attrs), buffer: h.buffer, mutex: h.mutex}
+}
+
+func (h *loggerHandler) WithGroup(name string) slog.Handler {
+	return &loggerHandler{logger: h.logger, handler: h.handler.WithGroup(name), buffer: h.buffer, mutex: h.mutex}
+}
+
+// slogLogger is an ILogger that writes to a slog.Logger
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger wraps a slog.Logger as an ILogger for code written
+// against ILogger.
+func NewSlogLogger(logger *slog.Logger) ILogger {
+	return &slogLogger{logger: orDiscard(logger)}
+}
+
+func (l *slogLogger) Debug(value ...any) {
+	l.logger.Debug(strings.TrimSuffix(fmt.Sprintln(value...), "\n"))
+}
+
+func (l *slogLogger) Debugf(message string, value ...any) {
+	l.logger.Debug(fmt.Sprintf(message, value...))
+}
+
+func (l *slogLogger) Info(value ...any) {
+	l.logger.Info(strings.TrimSuffix(fmt.Sprintln(value...), "\n"))
+}
+
+func (l *slogLogger) Infof(message string, value ...any) {
+	l.logger.Info(fmt.Sprintf(message, value...))
+}
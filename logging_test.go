@@ -0,0 +1,79 @@
+package ottscanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScanner_WithLogger(t *testing.T) {
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/high_3.ts" {
+			http.NotFound(w, r)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	scanner, err := New(server.URL+"/master.m3u8", 4, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("could not decode %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected one warning, got: %s", buffer.String())
+	}
+	record := records[0]
+	if record["msg"] != "segment failed" || record["stream"] != "high.m3u8" || record["segment"] != "high_3.ts" ||
+		record["url"] != server.URL+"/high_3.ts" || record["status"] != float64(http.StatusNotFound) {
+		t.Errorf("unexpected record: %v", record)
+	}
+}
+
+func TestNewLoggerHandler(t *testing.T) {
+	logger := &recordingLogger{}
+	slog.New(NewLoggerHandler(logger)).With("stream", "low.m3u8").Debug("segment ok", "status", 200)
+	slog.New(NewLoggerHandler(logger)).Warn("segment failed")
+	if len(logger.debug) != 1 || logger.debug[0] != "level=DEBUG msg=\"segment ok\" stream=low.m3u8 status=200" {
+		t.Errorf("unexpected debug lines: %q", logger.debug)
+	}
+	if len(logger.info) != 1 || logger.info[0] != "level=WARN msg=\"segment failed\"" {
+		t.Errorf("unexpected info lines: %q", logger.info)
+	}
+}
+
+// recordingLogger is an ILogger that keeps the lines it is given
+type recordingLogger struct {
+	debug []string
+	info  []string
+}
+
+func (l *recordingLogger) Debug(value ...any) {}
+func (l *recordingLogger) Info(value ...any)  {}
+
+func (l *recordingLogger) Debugf(message string, value ...any) {
+	l.debug = append(l.debug, value[0].(string))
+}
+
+func (l *recordingLogger) Infof(message string, value ...any) {
+	l.info = append(l.info, value[0].(string))
+}
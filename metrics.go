@@ -0,0 +1,276 @@
+package ottscanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the segment latency histogram
+var latencyBuckets = []float64{0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects the results of scans and monitoring runs and exposes
+// them in the Prometheus text exposition format. Series are labelled by
+// channel, which is the WithChannel name of the scanner, or its url
+// without one, for WithMetrics and the stream name for Metrics.OnScan,
+// and by stream for the ABR stream of a segment.
+type Metrics struct {
+	// Logger receives errors serving the metrics. Nothing is logged
+	// when it is nil.
+	Logger   *slog.Logger
+	channels map[string]*channelMetrics
+	mutex    sync.Mutex
+}
+
+type channelMetrics struct {
+	scansOK     float64
+	scansFailed float64
+	lastScan    time.Time
+	lastSuccess time.Time
+	// health is set by monitoring runs only
+	health  *HealthState
+	streams map[string]*streamMetrics
+}
+
+type streamMetrics struct {
+	segmentsOK     float64
+	segmentsFailed float64
+	// statuses counts responses by status code, 0 for no response
+	statuses map[int]float64
+	buckets  []float64
+	sum      float64
+	count    float64
+	// playlistAge is negative when the age is unknown
+	playlistAge float64
+}
+
+// NewMetrics returns an empty collection of metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{channels: make(map[string]*channelMetrics)}
+}
+
+// WithMetrics records the results of every Scan and Random call of the
+// scanner in metrics under the channel of WithChannel or the url.
+func WithMetrics(metrics *Metrics) Option {
+	return func(s *Scanner) {
+		s.metrics = metrics
+	}
+}
+
+// observe records a scan in the metrics and history of the scanner if
+// there are any
+func (s *Scanner) observe(report *Report, err error) {
+	channel := s.channelName()
+	if s.metrics != nil {
+		s.metrics.Observe(channel, report, err)
+	}
+	if s.history != nil {
+		if recordErr := s.history.Record(channel, report, err); recordErr != nil {
+			s.logger.Error("error recording history", "channel", channel, "error", recordErr)
+		}
+	}
+}
+
+// Observe records a scan of a channel. The report may be nil when the
+// scan failed before any segment was requested.
+func (m *Metrics) Observe(channel string, report *Report, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	metrics := m.channel(channel)
+
+	scanned := time.Now()
+	if report != nil && !report.Finished.IsZero() {
+		scanned = report.Finished
+	}
+	metrics.lastScan = scanned
+	if err == nil && report != nil && report.Failures() == 0 {
+		metrics.scansOK++
+		metrics.lastSuccess = scanned
+	} else {
+		metrics.scansFailed++
+	}
+	if report == nil {
+		return
+	}
+
+	for _, stream := range report.Streams {
+		sm, ok := metrics.streams[stream.Name]
+		if !ok {
+			sm = &streamMetrics{
+				statuses: make(map[int]float64),
+				buckets:  make([]float64, len(latencyBuckets)),
+			}
+			metrics.streams[stream.Name] = sm
+		}
+		for _, result := range stream.Segments {
+			if result.OK {
+				sm.segmentsOK++
+			} else {
+				sm.segmentsFailed++
+			}
+			sm.statuses[result.Status]++
+			seconds := result.Duration.Seconds()
+			for i, bound := range latencyBuckets {
+				if seconds <= bound {
+					sm.buckets[i]++
+				}
+			}
+			sm.sum += seconds
+			sm.count++
+		}
+		sm.playlistAge = -1
+		if stream.PlaylistModified != nil {
+			sm.playlistAge = scanned.Sub(*stream.PlaylistModified).Seconds()
+		}
+	}
+}
+
+// OnScan records a scan of a monitored stream along with its health.
+// Plug it into MonitorOptions.OnScan.
+func (m *Metrics) OnScan(health StreamHealth, report *Report, err error) {
+	m.Observe(health.Name, report, err)
+	m.mutex.Lock()
+	state := health.State
+	m.channel(health.Name).health = &state
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) channel(name string) *channelMetrics {
+	metrics, ok := m.channels[name]
+	if !ok {
+		metrics = &channelMetrics{streams: make(map[string]*streamMetrics)}
+		m.channels[name] = metrics
+	}
+	return metrics
+}
+
+// ServeHTTP serves the metrics for a Prometheus scrape.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.Write(w); err != nil {
+		orDiscard(m.Logger).Warn("error writing metrics", "error", err)
+	}
+}
+
+// Write writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	channels := make([]string, 0, len(m.channels))
+	for name := range m.channels {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+	// each calls f for every stream of every channel in sorted order
+	each := func(f func(channel, stream string, sm *streamMetrics)) {
+		for _, channel := range channels {
+			streams := make([]string, 0, len(m.channels[channel].streams))
+			for name := range m.channels[channel].streams {
+				streams = append(streams, name)
+			}
+			sort.Strings(streams)
+			for _, stream := range streams {
+				f(channel, stream, m.channels[channel].streams[stream])
+			}
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	family := func(name, kind, help string) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	sample := func(name string, value float64, labels ...string) {
+		out.WriteString(name)
+		if len(labels) > 0 {
+			out.WriteByte('{')
+			for i := 0; i < len(labels); i += 2 {
+				if i > 0 {
+					out.WriteByte(',')
+				}
+				fmt.Fprintf(out, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+			}
+			out.WriteByte('}')
+		}
+		fmt.Fprintf(out, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	timestamp := func(t time.Time) float64 {
+		if t.IsZero() {
+			return 0
+		}
+		return float64(t.UnixNano()) / float64(time.Second)
+	}
+
+	family("ottscanner_scans_total", "counter", "Scans by result.")
+	for _, channel := range channels {
+		sample("ottscanner_scans_total", m.channels[channel].scansOK, "channel", channel, "result", "ok")
+		sample("ottscanner_scans_total", m.channels[channel].scansFailed, "channel", channel, "result", "failed")
+	}
+	family("ottscanner_last_scan_timestamp_seconds", "gauge", "Time of the last scan.")
+	for _, channel := range channels {
+		sample("ottscanner_last_scan_timestamp_seconds", timestamp(m.channels[channel].lastScan), "channel", channel)
+	}
+	family("ottscanner_last_success_timestamp_seconds", "gauge", "Time of the last scan without failures, 0 if there was none.")
+	for _, channel := range channels {
+		sample("ottscanner_last_success_timestamp_seconds", timestamp(m.channels[channel].lastSuccess), "channel", channel)
+	}
+	family("ottscanner_health_state", "gauge", "Health state of a monitored stream, 1 for the current state.")
+	for _, channel := range channels {
+		health := m.channels[channel].health
+		if health == nil {
+			continue
+		}
+		for _, state := range []HealthState{HealthUnknown, HealthHealthy, HealthFailing, HealthRecovered} {
+			var value float64
+			if state == *health {
+				value = 1
+			}
+			sample("ottscanner_health_state", value, "channel", channel, "state", state.String())
+		}
+	}
+
+	family("ottscanner_segments_total", "counter", "Segment requests by result.")
+	each(func(channel, stream string, sm *streamMetrics) {
+		sample("ottscanner_segments_total", sm.segmentsOK, "channel", channel, "stream", stream, "result", "ok")
+		sample("ottscanner_segments_total", sm.segmentsFailed, "channel", channel, "stream", stream, "result", "failed")
+	})
+	family("ottscanner_segment_responses_total", "counter", "Segment responses by HTTP status code, 0 when there was no response.")
+	each(func(channel, stream string, sm *streamMetrics) {
+		codes := make([]int, 0, len(sm.statuses))
+		for code := range sm.statuses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			sample("ottscanner_segment_responses_total", sm.statuses[code], "channel", channel, "stream", stream, "code", strconv.Itoa(code))
+		}
+	})
+	family("ottscanner_segment_duration_seconds", "histogram", "Segment request latency.")
+	each(func(channel, stream string, sm *streamMetrics) {
+		for i, bound := range latencyBuckets {
+			sample("ottscanner_segment_duration_seconds_bucket", sm.buckets[i], "channel", channel, "stream", stream, "le", strconv.FormatFloat(bound, 'g', -1, 64))
+		}
+		sample("ottscanner_segment_duration_seconds_bucket", sm.count, "channel", channel, "stream", stream, "le", "+Inf")
+		sample("ottscanner_segment_duration_seconds_sum", sm.sum, "channel", channel, "stream", stream)
+		sample("ottscanner_segment_duration_seconds_count", sm.count, "channel", channel, "stream", stream)
+	})
+	family("ottscanner_playlist_age_seconds", "gauge", "Time since the playlist was last modified at the last scan.")
+	each(func(channel, stream string, sm *streamMetrics) {
+		if sm.playlistAge >= 0 {
+			sample("ottscanner_playlist_age_seconds", sm.playlistAge, "channel", channel, "stream", stream)
+		}
+	})
+	return out.Flush()
+}
+
+// escapeLabel escapes a label value for the exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
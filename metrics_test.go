@@ -0,0 +1,104 @@
+package ottscanner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	modified := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/low.m3u8" {
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		}
+		if r.URL.Path == "/high_5.ts" {
+			http.NotFound(w, r)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	metrics := NewMetrics()
+	scanner, err := New(server.URL+"/master.m3u8", 4, WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Random(Sample{Strategy: SampleFirstMiddleLast}); err != nil {
+		t.Fatal(err)
+	}
+	missing, err := New(server.URL+"/missing.m3u8", 1, WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := missing.Scan(); err == nil {
+		t.Fatal("expected an error scanning a missing playlist")
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if content := recorder.Header().Get("Content-Type"); !strings.HasPrefix(content, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %s", content)
+	}
+	exposition := recorder.Body.String()
+
+	channel := server.URL + "/master.m3u8"
+	expected := []string{
+		`# TYPE ottscanner_scans_total counter`,
+		`ottscanner_scans_total{channel="` + channel + `",result="failed"} 2`,
+		`ottscanner_scans_total{channel="` + server.URL + `/missing.m3u8",result="failed"} 1`,
+		`ottscanner_last_success_timestamp_seconds{channel="` + channel + `"} 0`,
+		// six segments scanned and three sampled per stream
+		`ottscanner_segments_total{channel="` + channel + `",stream="low.m3u8",result="ok"} 9`,
+		`ottscanner_segments_total{channel="` + channel + `",stream="high.m3u8",result="failed"} 2`,
+		`ottscanner_segment_responses_total{channel="` + channel + `",stream="high.m3u8",code="200"} 7`,
+		`ottscanner_segment_responses_total{channel="` + channel + `",stream="high.m3u8",code="404"} 2`,
+		`# TYPE ottscanner_segment_duration_seconds histogram`,
+		`ottscanner_segment_duration_seconds_bucket{channel="` + channel + `",stream="low.m3u8",le="+Inf"} 9`,
+		`ottscanner_segment_duration_seconds_count{channel="` + channel + `",stream="low.m3u8"} 9`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(exposition, line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, exposition)
+		}
+	}
+	if !strings.Contains(exposition, `ottscanner_playlist_age_seconds{channel="`+channel+`",stream="low.m3u8"} `) {
+		t.Errorf("missing the playlist age of the low stream in:\n%s", exposition)
+	}
+	if strings.Contains(exposition, `ottscanner_playlist_age_seconds{channel="`+channel+`",stream="high.m3u8"}`) {
+		t.Errorf("unexpected playlist age of the high stream without Last-Modified in:\n%s", exposition)
+	}
+}
+
+func TestMetrics_OnScan(t *testing.T) {
+	metrics := NewMetrics()
+	report := &Report{Finished: time.Unix(1700000000, 0), Streams: []StreamReport{
+		{Name: "high", Segments: []SegmentResult{{Name: "1.ts", OK: true, Status: 200, Duration: 30 * time.Millisecond}}},
+	}}
+	metrics.OnScan(StreamHealth{Name: `news "hd"`, State: HealthHealthy}, report, nil)
+
+	var exposition strings.Builder
+	if err := metrics.Write(&exposition); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`ottscanner_scans_total{channel="news \"hd\"",result="ok"} 1`,
+		`ottscanner_last_success_timestamp_seconds{channel="news \"hd\""} 1.7e+09`,
+		`ottscanner_health_state{channel="news \"hd\"",state="healthy"} 1`,
+		`ottscanner_health_state{channel="news \"hd\"",state="failing"} 0`,
+		`ottscanner_segment_duration_seconds_bucket{channel="news \"hd\"",stream="high",le="0.025"} 0`,
+		`ottscanner_segment_duration_seconds_bucket{channel="news \"hd\"",stream="high",le="0.05"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(exposition.String(), line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, exposition.String())
+		}
+	}
+}
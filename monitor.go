@@ -0,0 +1,346 @@
+package ottscanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/semaphore"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+type HealthState byte
+
+const (
+	// HealthUnknown is the state of a stream before its first scan.
+	HealthUnknown HealthState = iota
+	HealthHealthy
+	HealthFailing
+	// HealthRecovered is the state of a stream on the first healthy
+	// scan after failing. The next healthy scan makes it healthy.
+	HealthRecovered
+)
+
+func (state HealthState) String() string {
+	switch state {
+	case HealthUnknown:
+		return "unknown"
+	case HealthHealthy:
+		return "healthy"
+	case HealthFailing:
+		return "failing"
+	case HealthRecovered:
+		return "recovered"
+	default:
+		return fmt.Sprintf("Unknown(%d)", state)
+	}
+}
+
+func (state HealthState) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+func (state *HealthState) UnmarshalText(text []byte) error {
+	for _, s := range []HealthState{HealthUnknown, HealthHealthy, HealthFailing, HealthRecovered} {
+		if s.String() == string(text) {
+			*state = s
+			return nil
+		}
+	}
+	return newScannerError(errors.New("unknown health state"), string(text))
+}
+
+// healthWindow is the number of scans kept in the rolling history
+const healthWindow = 20
+
+// ScanOutcome summarizes a single scan of a monitored stream.
+type ScanOutcome struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	OK       bool          `json:"ok"`
+	Segments int           `json:"segments"`
+	Failures int           `json:"failures"`
+	Error    string        `json:"error,omitempty"`
+	// Category is the FailureCategory of Error.
+	Category string `json:"category,omitempty"`
+}
+
+// StreamHealth is the rolling health of a monitored stream.
+type StreamHealth struct {
+	Name  string      `json:"name"`
+	URL   string      `json:"url"`
+	State HealthState `json:"state"`
+	// Since is when the stream entered its current state.
+	Since               time.Time     `json:"since"`
+	LastScan            time.Time     `json:"last_scan"`
+	LastSuccess         time.Time     `json:"last_success"`
+	NextScan            time.Time     `json:"next_scan"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	History             []ScanOutcome `json:"history"`
+	// Report is the report of the last scan that got as far as scanning segments.
+	Report *Report `json:"-"`
+}
+
+// Availability returns the fraction of healthy scans in the history.
+func (h *StreamHealth) Availability() float64 {
+	if len(h.History) == 0 {
+		return 0
+	}
+	var ok int
+	for _, outcome := range h.History {
+		if outcome.OK {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(h.History))
+}
+
+// Transition is a change of the health state of a monitored stream.
+type Transition struct {
+	Stream  string       `json:"stream"`
+	URL     string       `json:"url"`
+	From    HealthState  `json:"from"`
+	To      HealthState  `json:"to"`
+	At      time.Time    `json:"at"`
+	Outcome ScanOutcome  `json:"outcome"`
+	Health  StreamHealth `json:"health"`
+}
+
+// MonitorTarget is a stream to monitor and when to scan it.
+type MonitorTarget struct {
+	Channel  Channel
+	Schedule Schedule
+	// Sample scans a sample of the segments with Random instead of Scan.
+	Sample *Sample
+	// Options are applied to the scanner of the target after the
+	// options of the monitor.
+	Options []Option
+}
+
+// MonitorOptions configures a Monitor.
+type MonitorOptions struct {
+	// MaxConcurrency limits segment requests in flight across all targets.
+	MaxConcurrency int64
+	// FailureThreshold is the number of failed scans in a row before a
+	// stream is failing. Defaults to 1.
+	FailureThreshold int
+	// MaxFailureRate is the fraction of segments from 0 to 1 that may
+	// fail before a scan counts as failed. Defaults to 0.
+	MaxFailureRate float64
+	// Options are applied to the scanner of every target.
+	Options []Option
+	// OnScan is called after every scan of a target.
+	OnScan func(health StreamHealth, report *Report, err error)
+	// OnTransition is called when the state of a target changes.
+	OnTransition func(transition Transition)
+	// Logger is the logger of the monitor and the default logger of the
+	// scanner of every target.
+	Logger *slog.Logger
+}
+
+// Monitor scans a set of streams on their schedules and keeps their
+// rolling health. Errors and panics of individual scans are recorded
+// as failed scans and never stop the monitor.
+type Monitor struct {
+	targets []MonitorTarget
+	options MonitorOptions
+	budget  *semaphore.Weighted
+	health  map[string]*StreamHealth
+	mutex   sync.Mutex
+}
+
+// NewMonitor returns a monitor for the targets. Every target must have
+// a unique channel name and a schedule.
+func NewMonitor(targets []MonitorTarget, options MonitorOptions) (*Monitor, error) {
+	if len(targets) == 0 {
+		return nil, newScannerError(errors.New("no streams to monitor"), "monitor")
+	}
+	if options.MaxConcurrency < 1 {
+		options.MaxConcurrency = 1
+	}
+	if options.FailureThreshold < 1 {
+		options.FailureThreshold = 1
+	}
+	monitor := &Monitor{
+		targets: targets,
+		options: options,
+		budget:  semaphore.NewWeighted(options.MaxConcurrency),
+		health:  make(map[string]*StreamHealth),
+	}
+	for _, target := range targets {
+		name := target.Channel.Name
+		if name == "" {
+			return nil, newScannerError(errors.New("monitored stream needs a name"), target.Channel.URL)
+		}
+		if target.Schedule == nil {
+			return nil, newScannerError(errors.New("monitored stream needs a schedule"), name)
+		}
+		if _, ok := monitor.health[name]; ok {
+			return nil, newScannerError(errors.New("duplicate monitored stream"), name)
+		}
+		monitor.health[name] = &StreamHealth{Name: name, URL: target.Channel.URL}
+	}
+	return monitor, nil
+}
+
+// Run scans every target right away and then on its schedule until the
+// context is done.
+func (m *Monitor) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, target := range m.targets {
+		wg.Add(1)
+		go func(target MonitorTarget) {
+			defer wg.Done()
+			m.run(ctx, target)
+		}(target)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (m *Monitor) run(ctx context.Context, target MonitorTarget) {
+	for {
+		started := time.Now()
+		m.scan(ctx, target, started)
+
+		next := target.Schedule.Next(time.Now())
+		if next.IsZero() {
+			orDiscard(m.options.Logger).Info("no more scans scheduled", "channel", target.Channel.Name)
+			return
+		}
+		m.mutex.Lock()
+		m.health[target.Channel.Name].NextScan = next
+		m.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// scan scans a target once and updates its health
+func (m *Monitor) scan(ctx context.Context, target MonitorTarget, started time.Time) {
+	report, err := m.scanTarget(ctx, target)
+	if ctx.Err() != nil {
+		// the monitor is stopping, a cancelled scan says nothing about the stream
+		return
+	}
+	outcome := ScanOutcome{
+		Started:  started,
+		Duration: time.Since(started),
+	}
+	if report != nil {
+		outcome.Segments = len(report.Results())
+		outcome.Failures = report.Failures()
+	}
+	if err != nil {
+		outcome.Error = err.Error()
+		outcome.Category = Category(err).String()
+	}
+	outcome.OK = err == nil && outcome.Failures == 0
+	if err == nil && outcome.Segments > 0 && outcome.Failures > 0 {
+		outcome.OK = float64(outcome.Failures)/float64(outcome.Segments) <= m.options.MaxFailureRate
+	}
+
+	m.mutex.Lock()
+	health := m.health[target.Channel.Name]
+	from := health.State
+	health.LastScan = started
+	if report != nil {
+		health.Report = report
+	}
+	health.History = append(health.History, outcome)
+	if len(health.History) > healthWindow {
+		health.History = health.History[len(health.History)-healthWindow:]
+	}
+	if outcome.OK {
+		health.LastSuccess = started
+		health.ConsecutiveFailures = 0
+		switch from {
+		case HealthFailing:
+			health.State = HealthRecovered
+		default:
+			health.State = HealthHealthy
+		}
+	} else {
+		health.ConsecutiveFailures++
+		if health.ConsecutiveFailures >= m.options.FailureThreshold {
+			health.State = HealthFailing
+		} else if from == HealthUnknown {
+			// not failing yet but not known to be healthy either
+			health.State = HealthUnknown
+		}
+	}
+	if health.State != from {
+		health.Since = started
+	}
+	snapshot := health.snapshot()
+	m.mutex.Unlock()
+
+	orDiscard(m.options.Logger).Debug("monitor scanned", "channel", target.Channel.Name, "state", snapshot.State.String(),
+		"consecutive_failures", snapshot.ConsecutiveFailures)
+	if m.options.OnScan != nil {
+		m.options.OnScan(snapshot, report, err)
+	}
+	if snapshot.State != from && m.options.OnTransition != nil {
+		m.options.OnTransition(Transition{
+			Stream:  snapshot.Name,
+			URL:     snapshot.URL,
+			From:    from,
+			To:      snapshot.State,
+			At:      started,
+			Outcome: outcome,
+			Health:  snapshot,
+		})
+	}
+}
+
+// scanTarget runs the scan of a target turning a panic into an error.
+// The scan is cancelled when ctx is done.
+func (m *Monitor) scanTarget(ctx context.Context, target MonitorTarget) (report *Report, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newScannerError(fmt.Errorf("%v", r), fmt.Sprintf("panic while scanning %s", target.Channel.URL))
+		}
+	}()
+
+	options := append([]Option{WithBudget(m.budget), WithLogger(m.options.Logger), WithChannel(target.Channel.Name), WithContext(ctx)}, m.options.Options...)
+	options = append(options, target.Options...)
+	scanner, err := New(target.Channel.URL, m.options.MaxConcurrency, options...)
+	if err != nil {
+		return nil, err
+	}
+	if target.Sample != nil {
+		_, err = scanner.Random(*target.Sample)
+	} else {
+		_, err = scanner.Scan()
+	}
+	return scanner.Report(), err
+}
+
+// snapshot returns a copy that does not share the history
+func (h *StreamHealth) snapshot() StreamHealth {
+	snapshot := *h
+	snapshot.History = append([]ScanOutcome(nil), h.History...)
+	return snapshot
+}
+
+// Health returns a copy of the health of every monitored stream sorted by name.
+func (m *Monitor) Health() []StreamHealth {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	health := make([]StreamHealth, 0, len(m.health))
+	for _, h := range m.health {
+		health = append(health, h.snapshot())
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Name < health[j].Name
+	})
+	return health
+}
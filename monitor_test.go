@@ -0,0 +1,139 @@
+package ottscanner
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMonitor_Transitions(t *testing.T) {
+	var failing atomic.Bool
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() && strings.HasSuffix(r.URL.Path, ".ts") {
+			http.Error(w, "gone", http.StatusServiceUnavailable)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	transitions := make(chan Transition, 10)
+	monitor, err := NewMonitor([]MonitorTarget{
+		{Channel: Channel{Name: "origin", URL: server.URL + "/master.m3u8"}, Schedule: Every(20 * time.Millisecond)},
+		{Channel: Channel{Name: "broken", URL: server.URL + "/broken"}, Schedule: Every(20 * time.Millisecond)},
+	}, MonitorOptions{
+		MaxConcurrency: 4,
+		OnTransition: func(transition Transition) {
+			if transition.Stream == "origin" {
+				transitions <- transition
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- monitor.Run(ctx)
+	}()
+
+	expect := func(state HealthState) {
+		t.Helper()
+		select {
+		case transition := <-transitions:
+			if transition.To != state {
+				t.Fatalf("expected: %s, got: %s", state, transition.To)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s", state)
+		}
+	}
+	expect(HealthHealthy)
+	failing.Store(true)
+	expect(HealthFailing)
+	failing.Store(false)
+	expect(HealthRecovered)
+	expect(HealthHealthy)
+
+	health := monitor.Health()
+	if health[0].Name != "broken" || health[0].State != HealthFailing || health[0].ConsecutiveFailures == 0 {
+		t.Fatalf("expected broken stream to keep failing: %+v", health[0])
+	}
+	if health[1].Availability() <= 0 || health[1].Availability() >= 1 {
+		t.Fatalf("expected partial availability: %v", health[1].Availability())
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected: %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestMonitor_Cancel(t *testing.T) {
+	requested := make(chan struct{}, 1)
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".ts") {
+			select {
+			case requested <- struct{}{}:
+			default:
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	var scans atomic.Int32
+	monitor, err := NewMonitor([]MonitorTarget{
+		{Channel: Channel{Name: "slow", URL: server.URL + "/master.m3u8"}, Schedule: Every(time.Minute)},
+	}, MonitorOptions{
+		MaxConcurrency: 2,
+		OnScan: func(health StreamHealth, report *Report, err error) {
+			scans.Add(1)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- monitor.Run(ctx)
+	}()
+
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a segment request")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected: %v, got: %v", context.Canceled, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("monitor did not stop the scan in flight")
+	}
+	if scans.Load() != 0 {
+		t.Fatalf("expected the cancelled scan not to be recorded, got: %d scans", scans.Load())
+	}
+	if health := monitor.Health(); health[0].State != HealthUnknown {
+		t.Fatalf("expected: %s, got: %s", HealthUnknown, health[0].State)
+	}
+}
@@ -0,0 +1,266 @@
+package ottscanner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NetworkStep is one interval of a bandwidth trace.
+type NetworkStep struct {
+	// Duration is how long the step lasts before moving to the next one.
+	Duration time.Duration
+	// Bandwidth is the link capacity in bits per second. A step with
+	// no bandwidth is an outage where no data is transferred.
+	Bandwidth int64
+	// Latency is added to every request started during the step.
+	Latency time.Duration
+}
+
+// NetworkProfile describes the network conditions used to shape segment
+// fetches during playback emulation. The steps are replayed in order and
+// start over when the trace is exhausted. Stalls are drawn from a random
+// source seeded with Seed so the same profile always produces the same
+// transfer times.
+type NetworkProfile struct {
+	Name  string
+	Steps []NetworkStep
+	// Loss is the probability from 0 to 1 that a request stalls.
+	Loss float64
+	// Stall is how long a request waits when it stalls.
+	Stall time.Duration
+	Seed  int64
+}
+
+// networkProfiles are the built-in profiles available by name
+var networkProfiles = map[string]NetworkProfile{
+	"3g": {
+		Name: "3g",
+		Steps: []NetworkStep{
+			{Duration: 10 * time.Second, Bandwidth: 1_600_000, Latency: 150 * time.Millisecond},
+			{Duration: 5 * time.Second, Bandwidth: 750_000, Latency: 300 * time.Millisecond},
+			{Duration: 10 * time.Second, Bandwidth: 1_200_000, Latency: 200 * time.Millisecond},
+		},
+		Loss:  0.01,
+		Stall: time.Second,
+		Seed:  3,
+	},
+	"4g": {
+		Name: "4g",
+		Steps: []NetworkStep{
+			{Duration: 20 * time.Second, Bandwidth: 12_000_000, Latency: 50 * time.Millisecond},
+			{Duration: 5 * time.Second, Bandwidth: 6_000_000, Latency: 80 * time.Millisecond},
+		},
+		Seed: 4,
+	},
+	"wifi-flaky": {
+		Name: "wifi-flaky",
+		Steps: []NetworkStep{
+			{Duration: 8 * time.Second, Bandwidth: 20_000_000, Latency: 20 * time.Millisecond},
+			{Duration: 4 * time.Second, Bandwidth: 1_500_000, Latency: 120 * time.Millisecond},
+			{Duration: 2 * time.Second, Bandwidth: 0, Latency: 500 * time.Millisecond},
+			{Duration: 6 * time.Second, Bandwidth: 300_000, Latency: 250 * time.Millisecond},
+		},
+		Loss:  0.05,
+		Stall: 2 * time.Second,
+		Seed:  5,
+	},
+}
+
+// NetworkProfileByName returns a copy of a built-in network profile.
+// The built-in profiles are 3g, 4g and wifi-flaky.
+func NetworkProfileByName(name string) (*NetworkProfile, error) {
+	profile, ok := networkProfiles[strings.ToLower(name)]
+	if !ok {
+		return nil, newScannerError(errors.New("unknown network profile"), name)
+	}
+	profile.Steps = append([]NetworkStep(nil), profile.Steps...)
+	return &profile, nil
+}
+
+// LoadNetworkProfile reads a bandwidth trace from a file. Each line of the
+// trace is a step with a duration, the bandwidth in kilobits per second and
+// an optional latency, for example "2s 1500 80ms". Blank lines and lines
+// starting with # are ignored.
+func LoadNetworkProfile(filePath string) (*NetworkProfile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, newScannerError(err, fmt.Sprintf("error opening network trace: %s", filePath))
+	}
+	defer file.Close()
+
+	profile := &NetworkProfile{
+		Name: strings.TrimSuffix(path.Base(filePath), path.Ext(filePath)),
+	}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		step, err := parseNetworkStep(line)
+		if err != nil {
+			return nil, newScannerError(err, fmt.Sprintf("error parsing network trace %s line %d", filePath, lineNumber))
+		}
+		profile.Steps = append(profile.Steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, newScannerError(err, fmt.Sprintf("error reading network trace: %s", filePath))
+	}
+	if err := profile.validate(); err != nil {
+		return nil, newScannerError(err, filePath)
+	}
+	return profile, nil
+}
+
+func parseNetworkStep(line string) (NetworkStep, error) {
+	var step NetworkStep
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return step, fmt.Errorf("expected duration, bandwidth and optional latency: %q", line)
+	}
+	duration, err := time.ParseDuration(fields[0])
+	if err != nil {
+		return step, err
+	}
+	kbps, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return step, err
+	}
+	step.Duration = duration
+	step.Bandwidth = int64(kbps * 1000)
+	if len(fields) == 3 {
+		latency, err := time.ParseDuration(fields[2])
+		if err != nil {
+			return step, err
+		}
+		step.Latency = latency
+	}
+	return step, nil
+}
+
+// validate makes sure the trace can transfer data
+func (p *NetworkProfile) validate() error {
+	if len(p.Steps) == 0 {
+		return errors.New("network profile has no steps")
+	}
+	var bandwidth int64
+	for _, step := range p.Steps {
+		if step.Duration <= 0 {
+			return errors.New("network profile step must have a positive duration")
+		}
+		if step.Bandwidth < 0 || step.Latency < 0 {
+			return errors.New("network profile step cannot have negative bandwidth or latency")
+		}
+		bandwidth += step.Bandwidth
+	}
+	if bandwidth == 0 {
+		return errors.New("network profile never transfers any data")
+	}
+	if p.Loss < 0 || p.Loss > 1 {
+		return errors.New("network profile loss must be between 0 and 1")
+	}
+	return nil
+}
+
+// networkLink replays a network profile on a virtual clock. The time a
+// transfer takes is computed from the trace rather than measured, which
+// makes emulation results reproducible. When realtime is set the link
+// also sleeps for the computed time so the reader is actually throttled.
+type networkLink struct {
+	profile  *NetworkProfile
+	elapsed  time.Duration
+	random   *rand.Rand
+	realtime bool
+}
+
+func newNetworkLink(profile *NetworkProfile, realtime bool) (*networkLink, error) {
+	if err := profile.validate(); err != nil {
+		return nil, newScannerError(err, profile.Name)
+	}
+	return &networkLink{
+		profile:  profile,
+		random:   rand.New(rand.NewSource(profile.Seed)),
+		realtime: realtime,
+	}, nil
+}
+
+// stepAt returns the trace step at virtual time t and how much of the
+// step is left.
+func (l *networkLink) stepAt(t time.Duration) (NetworkStep, time.Duration) {
+	var total time.Duration
+	for _, step := range l.profile.Steps {
+		total += step.Duration
+	}
+	offset := t % total
+	for _, step := range l.profile.Steps {
+		if offset < step.Duration {
+			return step, step.Duration - offset
+		}
+		offset -= step.Duration
+	}
+	// not reached because offset is always less than total
+	return l.profile.Steps[0], l.profile.Steps[0].Duration
+}
+
+// advance moves the virtual clock and sleeps when running in realtime
+func (l *networkLink) advance(d time.Duration) {
+	l.elapsed += d
+	if l.realtime && d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// request accounts for the latency and possible stall at the start of a request
+func (l *networkLink) request() {
+	step, _ := l.stepAt(l.elapsed)
+	delay := step.Latency
+	if l.profile.Loss > 0 && l.random.Float64() < l.profile.Loss {
+		delay += l.profile.Stall
+	}
+	l.advance(delay)
+}
+
+// transfer accounts for the time it takes to move n bytes over the link
+func (l *networkLink) transfer(n int) {
+	bits := float64(n) * 8
+	var d time.Duration
+	for bits > 0 {
+		step, left := l.stepAt(l.elapsed + d)
+		capacity := float64(step.Bandwidth) * left.Seconds()
+		if bits <= capacity {
+			d += time.Duration(bits / float64(step.Bandwidth) * float64(time.Second))
+			break
+		}
+		bits -= capacity
+		d += left
+	}
+	l.advance(d)
+}
+
+// reader wraps r so that every read is shaped by the link
+func (l *networkLink) reader(r io.Reader) io.Reader {
+	return &throttledReader{reader: r, link: l}
+}
+
+type throttledReader struct {
+	reader io.Reader
+	link   *networkLink
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.reader.Read(p)
+	if n > 0 {
+		tr.link.transfer(n)
+	}
+	return n, err
+}
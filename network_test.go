@@ -0,0 +1,81 @@
+package ottscanner
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNetworkLink_Transfer(t *testing.T) {
+	profile := &NetworkProfile{
+		Name: "test",
+		Steps: []NetworkStep{
+			{Duration: time.Second, Bandwidth: 8_000},
+			{Duration: time.Second, Bandwidth: 0},
+		},
+	}
+	link, err := newNetworkLink(profile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1500 bytes is 12000 bits: 1s at 8kbps, a 1s outage then 0.5s
+	link.transfer(1500)
+	if link.elapsed != 2500*time.Millisecond {
+		t.Fatalf("expected: %v, got: %v", 2500*time.Millisecond, link.elapsed)
+	}
+}
+
+func TestNetworkLink_Reproducible(t *testing.T) {
+	run := func() time.Duration {
+		profile, err := NetworkProfileByName("wifi-flaky")
+		if err != nil {
+			t.Fatal(err)
+		}
+		link, err := newNetworkLink(profile, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 50; i++ {
+			link.request()
+			link.transfer(100_000)
+		}
+		return link.elapsed
+	}
+	first, second := run(), run()
+	if first != second {
+		t.Fatalf("expected: %v, got: %v", first, second)
+	}
+}
+
+func TestLoadNetworkProfile(t *testing.T) {
+	trace := "# duration kbps latency\n2s 1500 80ms\n\n500ms 0\n"
+	filePath := path.Join(t.TempDir(), "train.trace")
+	if err := os.WriteFile(filePath, []byte(trace), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := LoadNetworkProfile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &NetworkProfile{
+		Name: "train",
+		Steps: []NetworkStep{
+			{Duration: 2 * time.Second, Bandwidth: 1_500_000, Latency: 80 * time.Millisecond},
+			{Duration: 500 * time.Millisecond},
+		},
+	}
+	if !reflect.DeepEqual(expected, profile) {
+		t.Fatalf("expected: %v, got: %v", expected, profile)
+	}
+
+	if err := os.WriteFile(filePath, []byte("2s fast\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadNetworkProfile(filePath); err == nil {
+		t.Fatal("expected error for bad bandwidth")
+	}
+}
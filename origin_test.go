@@ -0,0 +1,72 @@
+package ottscanner
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testOriginSegments is the number of segments in each test variant
+const testOriginSegments = 6
+
+// newTestOrigin starts a local HLS origin with a master playlist and two
+// variants. Segment bodies are sized from the variant bandwidth so the
+// emulated player sees a realistic ladder.
+func newTestOrigin(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(newTestOriginHandler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestOriginHandler returns the handler of the test origin so tests
+// can wrap it.
+func newTestOriginHandler() http.Handler {
+	variants := map[string]int{
+		"low":  400_000,
+		"high": 1_600_000,
+	}
+	resolutions := map[string]string{
+		"low":  "640x360",
+		"high": "1280x720",
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		var master strings.Builder
+		master.WriteString("#EXTM3U\n")
+		for _, name := range []string{"low", "high"} {
+			fmt.Fprintf(&master, "#EXT-X-STREAM-INF:AVERAGE-BANDWIDTH=%d,BANDWIDTH=%d,RESOLUTION=%s,CODECS=\"avc1.64001f,mp4a.40.2\"\n%s.m3u8\n",
+				variants[name]-1, variants[name], resolutions[name], name)
+		}
+		w.Write([]byte(master.String()))
+	})
+	for name := range variants {
+		name := name
+		mux.HandleFunc(fmt.Sprintf("/%s.m3u8", name), func(w http.ResponseWriter, r *http.Request) {
+			var playlist strings.Builder
+			playlist.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:2\n")
+			for i := 0; i < testOriginSegments; i++ {
+				fmt.Fprintf(&playlist, "#EXTINF:2.000,\n%s_%d.ts\n", name, i)
+			}
+			playlist.WriteString("#EXT-X-ENDLIST\n")
+			w.Write([]byte(playlist.String()))
+		})
+	}
+	// segments are two seconds of media at the variant bandwidth in whole
+	// MPEG-TS packets
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		for name := range variants {
+			if strings.HasPrefix(r.URL.Path, fmt.Sprintf("/%s_", name)) {
+				w.Write(bytes.Repeat([]byte{0x47}, variants[name]*2/8/mpegTSPacketSize*mpegTSPacketSize))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+
+	return mux
+}
@@ -3,48 +3,47 @@ package ottscanner
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/jkittell/toolbox"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
+	"log/slog"
+	"net/http"
 	"os"
 	"path"
-	"strings"
 	"sync"
+	"time"
 )
 
-var logger = NewTestingLogger(false)
-
+// ContentFormat is the streaming format of a url.
 type ContentFormat byte
 
 const (
 	HLS ContentFormat = iota
 	DASH
+	// UnknownFormat is detected from the response to the first request
+	// of the url, see DetectFormat.
+	UnknownFormat
 )
 
-type scannerError struct {
-	Context string
-	Err     error
-}
-
-func (se *scannerError) Error() string {
-	return fmt.Sprintf("%s: %v", se.Context, se.Err)
-}
+type Segments []Segment
 
-func newScannerError(err error, info string) *scannerError {
-	return &scannerError{
-		Context: info,
-		Err:     err,
+// withStream returns a copy of the segments tagged with the stream name
+func (segments Segments) withStream(name string) Segments {
+	tagged := make(Segments, len(segments))
+	for i, segment := range segments {
+		segment.stream = name
+		tagged[i] = segment
 	}
+	return tagged
 }
 
-type Segments []Segment
-
 type Segment struct {
 	name           string
 	url            string
 	byteRangeStart int
 	byteRangeSize  int
+	duration       time.Duration
+	stream         string
 }
 
 // Streams are playlists for each bitrate
@@ -54,15 +53,110 @@ type Stream struct {
 	name              string
 	url               string
 	masterPlaylistURL string
+	bandwidth         int
+	resolution        string
+	codecs            string
 	segments          Segments
 }
 
 type Scanner struct {
-	url            string
-	format         ContentFormat
+	url    string
+	format ContentFormat
+	// formatMutex guards the detection of the format
+	formatMutex    sync.Mutex
 	streams        Streams
 	files          map[string][]SegmentDownload
 	maxConcurrency int64
+	headers        map[string]string
+	headerFunc     HeaderFunc
+	// propagateQuery adds the query parameters of the url, or only the
+	// propagatedParameters, to child requests
+	propagateQuery       bool
+	propagatedParameters []string
+	// deepValidation downloads and validates segments, see
+	// WithDeepValidation
+	deepValidation bool
+	signer         URLSigner
+	client         *http.Client
+	ctx            context.Context
+	budget         *semaphore.Weighted
+	limiter        *RateLimiter
+	report         *Report
+	// modified is the Last-Modified time of each playlist
+	modified map[string]time.Time
+	// fetches are the latest playlist fetches and digests the hash of
+	// the last body of each playlist
+	fetches []PlaylistFetch
+	digests map[string]uint64
+	// detected is the body of the url fetched to detect its format, kept
+	// for the next request of the url
+	detected []byte
+	metrics  *Metrics
+	history  *History
+	// channel names the scanner in the metrics and history, see WithChannel
+	channel string
+	logger  *slog.Logger
+	// retryPolicy retries failed requests, see WithRetry
+	retryPolicy RetryPolicy
+	mutex       sync.Mutex
+}
+
+// Option configures optional settings of a Scanner.
+type Option func(*Scanner)
+
+// WithBudget shares a semaphore for segment requests between the streams
+// of a scanner and between scanners so their requests in flight are
+// limited together. It replaces the maxConcurrency of scans and
+// downloads.
+func WithBudget(budget *semaphore.Weighted) Option {
+	return func(s *Scanner) {
+		s.budget = budget
+	}
+}
+
+// WithContext cancels the requests of the scanner when ctx is done.
+func WithContext(ctx context.Context) Option {
+	return func(s *Scanner) {
+		s.ctx = ctx
+	}
+}
+
+// WithChannel names the channel of the scanner in its metrics and
+// history, so scans are kept with those of the monitor and batches
+// under the same name. The url is the channel by default.
+func WithChannel(name string) Option {
+	return func(s *Scanner) {
+		s.channel = name
+	}
+}
+
+// channelName returns the name of the channel or the url without one
+func (s *Scanner) channelName() string {
+	if s.channel == "" {
+		return s.url
+	}
+	return s.channel
+}
+
+// WithTimeout limits how long a single request may take including
+// reading the body. There is no limit by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Scanner) {
+		s.client.Timeout = timeout
+	}
+}
+
+// WithHeaders adds headers sent with every playlist, manifest
+// and segment request. Headers of later options win.
+func WithHeaders(headers map[string]string) Option {
+	return func(s *Scanner) {
+		if s.headers == nil {
+			s.headers = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			s.headers[k] = v
+		}
+	}
 }
 
 func (s *Segment) URL() string {
@@ -73,6 +167,16 @@ func (s *Segment) Name() string {
 	return s.name
 }
 
+// Stream returns the name of the ABR stream the segment belongs to.
+func (s *Segment) Stream() string {
+	return s.stream
+}
+
+// Duration returns the media duration of the segment or 0 if unknown.
+func (s *Segment) Duration() time.Duration {
+	return s.duration
+}
+
 func (s *Segment) ToJSON() ([]byte, error) {
 	return json.Marshal(s)
 }
@@ -95,6 +199,24 @@ func (s *Stream) Name() string {
 	return s.name
 }
 
+// Bandwidth returns the advertised bits per second of the stream
+// or 0 if the playlist/manifest does not declare one.
+func (s *Stream) Bandwidth() int {
+	return s.bandwidth
+}
+
+// Resolution returns the advertised WIDTHxHEIGHT of the stream
+// or an empty string if it is not declared.
+func (s *Stream) Resolution() string {
+	return s.resolution
+}
+
+// Codecs returns the advertised codecs of the stream
+// or an empty string if they are not declared.
+func (s *Stream) Codecs() string {
+	return s.codecs
+}
+
 // Files returns a map of stream name and the corresponding
 // segment file locations for that steam.
 func (s *Scanner) Files() map[string][]SegmentDownload {
@@ -111,31 +233,16 @@ func (s *Scanner) addFile(streamName string, download SegmentDownload) {
 // parse collects the ABR streams and segments from the playlist/manifest
 func (s *Scanner) parse() (Streams, error) {
 	var streams Streams
-	if s.format == HLS {
-		return parseHLS(s.url)
-	} else if s.format == DASH {
-		return parseDASH(s.url)
+	format := s.contentFormat()
+	if format == HLS {
+		return s.parseHLS(s.url)
+	} else if format == DASH {
+		return s.parseDASH(s.url)
 	} else {
-		err := errors.New("unable to determine if hls or dash")
-		return streams, newScannerError(err, "parsing playlist")
+		return streams, newScannerError(ErrUnknownFormat, "parsing playlist")
 	}
 }
 
-// TODO
-// Random downloads segments randomly
-func (s *Scanner) Random() error {
-	// TODO
-	return newScannerError(errors.New("not yet implemented"), "go away")
-}
-
-// TODO
-// EmulatePlayback will select a stream then download segments
-// in a buffer from the live edge.
-func (s *Scanner) EmulatePlayback() error {
-	// TODO
-	return newScannerError(errors.New("not yet implemented"), "go away")
-}
-
 func (sd *SegmentDownload) Error() error {
 	return sd.err
 }
@@ -144,27 +251,43 @@ func (sd *SegmentDownload) File() string {
 	return sd.filePath
 }
 
+// Attempts returns the number of requests made for the download.
+func (sd *SegmentDownload) Attempts() int {
+	return sd.attempts
+}
+
+// Timings returns the timings of the last request of the download or
+// nil when there was no response.
+func (sd *SegmentDownload) Timings() *Timings {
+	return sd.timings
+}
+
+// SegmentDownload is a downloaded segment, or a segment that failed to
+// download when Error is not nil.
 type SegmentDownload struct {
 	filePath string
 	err      error
+	attempts int
+	timings  *Timings
 }
 
-func downloader(done chan bool, results map[string][]SegmentDownload, directory string, str Stream, maxConcurrency int64) {
-	sem := semaphore.NewWeighted(maxConcurrency)
-	ctx := context.TODO()
+// downloader downloads the segments of a stream into the directory with
+// at most as many requests in flight as sem allows. The downloads are
+// added to results under the mutex.
+func (s *Scanner) downloader(sem *semaphore.Weighted, mutex *sync.Mutex, results map[string][]SegmentDownload, directory string, str Stream) error {
 	var wg sync.WaitGroup
-	var mutex sync.RWMutex
+	defer wg.Wait()
 
 	numberOfSegments := len(str.segments)
 	if numberOfSegments == 0 {
-		panic(newScannerError(errors.New("no segments to download"), str.name))
+		return newScannerError(ErrNoSegments, str.name)
 	}
 
-	logger.Debugf("\ndownloading %d segments for stream: %s\n", numberOfSegments, str.name)
+	s.logger.Debug("downloading segments", "stream", str.name, "segments", numberOfSegments)
 	// loop through the segments decoded from the playlist
 	for _, segment := range str.segments {
-		if err := sem.Acquire(ctx, 1); err != nil {
-			panic(newScannerError(err, "could not acquire semaphore while downloading segments"))
+		if err := sem.Acquire(s.ctx, 1); err != nil {
+			return newScannerError(err, "could not acquire semaphore while downloading segments")
 		}
 
 		wg.Add(1)
@@ -172,101 +295,107 @@ func downloader(done chan bool, results map[string][]SegmentDownload, directory
 			defer wg.Done()
 			fileName := path.Base(segment.url)
 			filePath := path.Join(directory, fileName)
-			var err error
-			if segment.byteRangeStart > -1 && segment.byteRangeSize > -1 {
-				headers := make(map[string]string)
-				// "Range: bytes=0-1023"
-				byteRange := fmt.Sprintf("%d-%d", segment.byteRangeStart, segment.byteRangeStart+segment.byteRangeSize)
-				headers["Range"] = byteRange
-				_, err = toolbox.DownloadFile(filePath, segment.url, headers)
-			} else {
-				_, err = toolbox.DownloadFile(filePath, segment.url, nil)
-			}
+			trace := new(requestTrace)
+			_, attempts, err := s.downloadFile(trace, RequestSegment, filePath, segment.url, rangeHeader(segment))
 
-			var download SegmentDownload
+			// failed downloads are kept with their error so they are not
+			// silently missing from the files
+			download := SegmentDownload{attempts: attempts, timings: trace.result()}
 			if err != nil {
-				download.err = newScannerError(err, segment.ToString())
+				s.logger.Warn("segment download failed", "stream", str.name, "segment", segment.name, "url", segment.url,
+					"status", statusCode(err), "attempts", attempts, "error", err)
+				download.err = newScannerError(err, segment.name)
 			} else {
 				download.filePath = filePath
-				mutex.Lock()
-				results[str.name] = append(results[str.name], download)
-				mutex.Unlock()
 			}
+			mutex.Lock()
+			results[str.name] = append(results[str.name], download)
+			mutex.Unlock()
 			sem.Release(1)
 		}(segment)
 	}
-	wg.Wait()
-	done <- true
+	return nil
 }
 
-func downloadDASHSegments(directory, manifestURL string, streams Streams, maxConcurrency int64) (map[string][]SegmentDownload, error) {
+// segmentBudget returns the semaphore that bounds the segment requests
+// in flight, the budget shared with other scanners when there is one
+func (s *Scanner) segmentBudget(maxConcurrency int64) *semaphore.Weighted {
+	if s.budget != nil {
+		return s.budget
+	}
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+	return semaphore.NewWeighted(maxConcurrency)
+}
+
+// downloadStreams downloads the streams at the same time with their
+// segment requests drawing from one budget. download fetches the
+// playlist and the segments of a stream into its directory.
+func (s *Scanner) downloadStreams(directory string, streams Streams, maxConcurrency int64,
+	download func(stream Stream, streamDirectory string, sem *semaphore.Weighted, mutex *sync.Mutex, results map[string][]SegmentDownload) error) (map[string][]SegmentDownload, error) {
 	results := make(map[string][]SegmentDownload)
+	sem := s.segmentBudget(maxConcurrency)
+	var mutex sync.Mutex
+	var group errgroup.Group
 	for _, stream := range streams {
-		// create a directory for the stream segments to be downloaded into
-		streamDirectory := path.Join(directory, stream.name)
-		if err := os.MkdirAll(streamDirectory, os.ModePerm); err != nil {
-			return results, newScannerError(err, fmt.Sprintf("error creating directory to download segments: %s", streamDirectory))
-		}
+		stream := stream
+		group.Go(func() error {
+			// create a directory for the stream segments to be downloaded into
+			streamDirectory := path.Join(directory, stream.name)
+			if err := os.MkdirAll(streamDirectory, os.ModePerm); err != nil {
+				return newScannerError(err, fmt.Sprintf("error creating directory to download segments: %s", streamDirectory))
+			}
+			return download(stream, streamDirectory, sem, &mutex, results)
+		})
+	}
+	err := group.Wait()
+	return results, err
+}
 
+func (s *Scanner) downloadDASHSegments(directory, manifestURL string, streams Streams, maxConcurrency int64) (map[string][]SegmentDownload, error) {
+	return s.downloadStreams(directory, streams, maxConcurrency, func(stream Stream, streamDirectory string, sem *semaphore.Weighted, mutex *sync.Mutex, results map[string][]SegmentDownload) error {
 		// download the manifest into the directory
 		playlistFileName := path.Base(manifestURL)
 		playlistPath := path.Join(streamDirectory, playlistFileName)
-		_, err := toolbox.DownloadFile(playlistPath, manifestURL, nil)
+		_, _, err := s.downloadFile(nil, RequestPlaylist, playlistPath, manifestURL, nil)
 		if err != nil {
-			return results, newScannerError(err, fmt.Sprintf("error downloading playlist: %s", stream.url))
+			return newScannerError(err, fmt.Sprintf("error downloading playlist: %s", stream.url))
 		}
 
 		// if any segments found for the stream download them into the directory for their ABR stream
-		if len(stream.segments) > 0 {
-			done := make(chan bool, 1)
-			downloader(done, results, streamDirectory, stream, maxConcurrency)
-			<-done
-		} else {
-			return results, newScannerError(errors.New("no segments to download"), stream.ToString())
+		if len(stream.segments) == 0 {
+			return newScannerError(ErrNoSegments, stream.ToString())
 		}
-	}
-
-	return results, nil
+		return s.downloader(sem, mutex, results, streamDirectory, stream)
+	})
 }
 
-func downloadHLSSegments(directory string, streams Streams, maxConcurrency int64) (map[string][]SegmentDownload, error) {
-	results := make(map[string][]SegmentDownload)
-	for _, stream := range streams {
-		// create a directory for the stream segments to be downloaded into
-		streamDirectory := path.Join(directory, stream.name)
-		if err := os.MkdirAll(streamDirectory, os.ModePerm); err != nil {
-			return results, newScannerError(err, fmt.Sprintf("error creating directory to download segments: %s", streamDirectory))
-		}
-
+func (s *Scanner) downloadHLSSegments(directory string, streams Streams, maxConcurrency int64) (map[string][]SegmentDownload, error) {
+	return s.downloadStreams(directory, streams, maxConcurrency, func(stream Stream, streamDirectory string, sem *semaphore.Weighted, mutex *sync.Mutex, results map[string][]SegmentDownload) error {
 		// download the ABR stream playlist into the directory
 		playlistFileName := path.Base(stream.url)
 		playlistPath := path.Join(streamDirectory, playlistFileName)
-		_, err := toolbox.DownloadFile(playlistPath, stream.url, nil)
+		_, _, err := s.downloadFile(nil, RequestPlaylist, playlistPath, stream.url, nil)
 		if err != nil {
-			return results, newScannerError(err, fmt.Sprintf("error downloading playlist: %s", stream.url))
+			return newScannerError(err, fmt.Sprintf("error downloading playlist: %s", stream.url))
 		}
 
 		// get the full url of each segment in the ABR stream
-		segmentsDecoded, err := decodeVariant(stream.url)
+		segmentsDecoded, err := s.decodeVariant(stream.url)
 		if err != nil {
-			return results, newScannerError(err, fmt.Sprintf("error getting segment urls from playlist: %s", stream.url))
+			return newScannerError(err, fmt.Sprintf("error getting segment urls from playlist: %s", stream.url))
 		}
 
 		// adding segments to the slice of segments of the stream
 		stream.segments = append(stream.segments, segmentsDecoded...)
 
 		// if any segments found for the stream download them into the directory for their ABR stream
-		if len(stream.segments) > 0 {
-			done := make(chan bool, 1)
-			downloader(done, results, streamDirectory, stream, maxConcurrency)
-			<-done
-
-		} else {
-			return results, newScannerError(errors.New("no segments to download"), stream.name)
+		if len(stream.segments) == 0 {
+			return newScannerError(ErrNoSegments, stream.name)
 		}
-	}
-
-	return results, nil
+		return s.downloader(sem, mutex, results, streamDirectory, stream)
+	})
 }
 
 // Download downloads the segments and stores the ABR stream names
@@ -281,55 +410,82 @@ func (s *Scanner) Download(directory string, maxConcurrency int64) error {
 	numberOfStreams := len(streams)
 
 	if numberOfStreams > 0 {
-		if s.format == HLS {
-			results, err := downloadHLSSegments(directory, streams, maxConcurrency)
+		format := s.contentFormat()
+		if format == HLS {
+			results, err := s.downloadHLSSegments(directory, streams, maxConcurrency)
 			if err != nil {
 				return newScannerError(err, fmt.Sprintf("error downloading hls segments: %s", s.url))
 			}
 			s.files = results
-		} else if s.format == DASH {
-			results, err := downloadDASHSegments(directory, s.url, streams, maxConcurrency)
+		} else if format == DASH {
+			results, err := s.downloadDASHSegments(directory, s.url, streams, maxConcurrency)
 			if err != nil {
 				return newScannerError(err, fmt.Sprintf("error downloading hls segments: %s", s.url))
 			}
 			s.files = results
 		} else {
-			return newScannerError(errors.New("unable to determine if this is hls or dash when downloading segments"), s.url)
+			return newScannerError(ErrUnknownFormat, s.url)
 		}
 	} else {
-		return newScannerError(errors.New("no ABR streams"), s.url)
+		return newScannerError(ErrNoStreams, s.url)
 	}
 	return nil
 }
 
 // Scan will do a head request on each segment and verify 200 response code
 // and return a map of the segment scanned and if it was scanned successfully.
+// The details of every request are kept for scanner.Report().
 func (s *Scanner) Scan() (map[Segment]bool, error) {
-	results := make(map[Segment]bool)
+	started := time.Now()
 	segments, err := s.Segments()
-	if err != nil || len(segments) == 0 {
-		return results, newScannerError(err, fmt.Sprintf("error getting segments: %s", s.url))
+	if err == nil && len(segments) == 0 {
+		err = ErrNoSegments
 	}
+	if err != nil {
+		err = newScannerError(err, fmt.Sprintf("error getting segments: %s", s.url))
+		s.observe(nil, err)
+		return make(map[Segment]bool), err
+	}
+	results, details, err := s.scan(segments)
+	s.setReport("scan", started, details)
+	s.observe(s.Report(), err)
+	return results, err
+}
 
+// scan does a head request on each of the segments with at most
+// maxConcurrency requests in flight.
+func (s *Scanner) scan(segments Segments) (map[Segment]bool, []SegmentResult, error) {
+	results := make(map[Segment]bool)
+	// details are kept in playlist order
+	details := make([]SegmentResult, len(segments))
 	var wg sync.WaitGroup
 	var mutex sync.RWMutex
-	sem := semaphore.NewWeighted(s.maxConcurrency)
-	ctx := context.TODO()
-	for _, segment := range segments {
+	sem := s.segmentBudget(s.maxConcurrency)
+	ctx := s.ctx
+	for i, segment := range segments {
 		if err := sem.Acquire(ctx, 1); err != nil {
-			return results, newScannerError(err, "could not acquire semaphore while scanning segments")
+			// the segments in flight still write their results
+			wg.Wait()
+			return results, details[:i], newScannerError(err, "could not acquire semaphore while scanning segments")
 		}
 		wg.Add(1)
 		// you have to pass the segment variable into the goroutine
-		go func(segment Segment) {
+		go func(i int, segment Segment) {
 			defer wg.Done()
-			headers := make(map[string]string)
-			if segment.byteRangeStart > -1 && segment.byteRangeSize > -1 {
-				// "Range: bytes=0-1023"
-				byteRangeEnd := segment.byteRangeStart + segment.byteRangeSize
-				headers["Range"] = fmt.Sprintf("%d-%d", segment.byteRangeStart, byteRangeEnd)
+			requested := time.Now()
+			trace := new(requestTrace)
+			var status int
+			attempts, err := s.retry(segment.url, func() error {
+				var err error
+				status, err = s.checkSegment(trace, segment)
+				return err
+			})
+			details[i] = newSegmentResult(segment, time.Since(requested), status, err)
+			details[i].Timings = trace.result()
+			if s.retryPolicy.MaxAttempts > 1 {
+				details[i].Attempts = attempts
 			}
-			_, err := toolbox.SendRequest(toolbox.HEAD, segment.url, "", headers)
+			s.logResult(details[i])
 			if err != nil {
 				mutex.Lock()
 				results[segment] = false
@@ -341,11 +497,11 @@ func (s *Scanner) Scan() (map[Segment]bool, error) {
 				mutex.Unlock()
 			}
 			sem.Release(1)
-		}(segment)
+		}(i, segment)
 	}
 
 	wg.Wait()
-	return results, nil
+	return results, details, nil
 }
 
 // Segments returns a slice of segment urls
@@ -356,71 +512,88 @@ func (s *Scanner) Segments() (Segments, error) {
 		return segments, newScannerError(err, fmt.Sprintf("error getting streams: %s", s.url))
 	}
 	for _, stream := range streams {
-		if s.format == HLS {
-			segmentsDecoded, err := decodeVariant(stream.url)
-			if err != nil {
-				return segments, newScannerError(err, fmt.Sprintf("error getting segments: %s", stream.url))
-			}
-			segments = append(segments, segmentsDecoded...)
-		} else if s.format == DASH {
-			dashSegments := stream.segments
-			if err != nil {
-				return segments, newScannerError(err, fmt.Sprintf("error getting segments: %s", stream.url))
-			}
-			segments = append(segments, dashSegments...)
-		} else {
-			return segments, newScannerError(errors.New("unable to determine if this is hls or dash when getting segments"), s.url)
+		streamSegments, err := s.streamSegments(stream)
+		if err != nil {
+			return segments, err
 		}
-
+		segments = append(segments, streamSegments...)
 	}
 	return segments, nil
 }
 
+// streamSegments returns the segments of a single ABR stream. HLS variant
+// playlists are downloaded and decoded while DASH segments are already
+// known from the manifest.
+func (s *Scanner) streamSegments(stream Stream) (Segments, error) {
+	switch s.contentFormat() {
+	case HLS:
+		segments, err := s.decodeVariant(stream.url)
+		if err != nil {
+			return segments, newScannerError(err, fmt.Sprintf("error getting segments: %s", stream.url))
+		}
+		return segments.withStream(stream.name), nil
+	case DASH:
+		return stream.segments.withStream(stream.name), nil
+	default:
+		return Segments{}, newScannerError(ErrUnknownFormat, s.url)
+	}
+}
+
+// setStreams keeps the last streams found for reports
+func (s *Scanner) setStreams(streams Streams) {
+	s.mutex.Lock()
+	s.streams = streams
+	s.mutex.Unlock()
+}
+
 // Streams returns a map of stream name and url
 func (s *Scanner) Streams() (Streams, error) {
-	logger.Debugf("checking url: %s", s.url)
-	_, err := toolbox.SendRequest(toolbox.HEAD, s.url, "", nil)
+	s.logger.Debug("checking url", "url", s.url)
+	format, err := s.checkURL()
 	if err != nil {
 		return Streams{}, newScannerError(err, fmt.Sprintf("error checking playlist: %s", s.url))
 	}
-	switch s.format {
+	switch format {
 	case HLS:
-		logger.Infof("getting streams for hls playlist: %s", s.url)
-		streams, err := parseHLS(s.url)
+		s.logger.Info("getting streams for hls playlist", "url", s.url)
+		streams, err := s.parseHLS(s.url)
 		if err != nil {
 			return streams, newScannerError(err, fmt.Sprintf("error getting abr streams for hls: %s", s.url))
 		}
+		s.setStreams(streams)
 		return streams, nil
 	case DASH:
-		logger.Infof("getting streams for dash playlist: %s", s.url)
-		streams, err := parseDASH(s.url)
+		s.logger.Info("getting streams for dash playlist", "url", s.url)
+		streams, err := s.parseDASH(s.url)
 		if err != nil {
 			return streams, newScannerError(err, fmt.Sprintf("error getting abr streams for dash: %s", s.url))
 		}
+		s.setStreams(streams)
 		return streams, nil
 	default:
 		var str Streams
-		return str, newScannerError(errors.New("unknown format"), "is this hls or dash?")
+		return str, newScannerError(ErrUnknownFormat, s.url)
 	}
 }
 
-func New(url string, maxConcurrency int64) (*Scanner, error) {
-	var format ContentFormat
-	if strings.Contains(url, ".m3u8") {
-		format = HLS
-	} else if strings.Contains(url, ".mpd") {
-		format = DASH
-	} else {
-		return nil, newScannerError(errors.New("cannot determine if this url is hls or dash"), url)
-	}
+// New returns a scanner of the HLS playlist or DASH manifest at url. The
+// format is detected from the first response unless it is set with
+// WithFormat, so urls without an extension are scanned too.
+func New(url string, maxConcurrency int64, options ...Option) (*Scanner, error) {
 	if maxConcurrency < 1 {
 		maxConcurrency = 1
 	}
 	scanner := &Scanner{
 		url:            url,
-		format:         format,
+		format:         UnknownFormat,
 		streams:        Streams{},
 		maxConcurrency: maxConcurrency,
+		client:         &http.Client{Jar: newCookieJar()},
+		ctx:            context.Background(),
+		logger:         discardLogger,
+	}
+	for _, option := range options {
+		option(scanner)
 	}
 	return scanner, nil
 }
@@ -147,10 +147,13 @@ func TestScanner_EmulatePlayback(t *testing.T) {
 			t.FailNow()
 		}
 
-		err = scanner.EmulatePlayback()
+		report, err := scanner.EmulatePlayback(PlaybackOptions{})
 		if err != nil {
 			t.FailNow()
 		}
+		if len(report.Segments) == 0 {
+			t.Fatal("no segments played")
+		}
 	}
 }
 
@@ -162,10 +165,20 @@ func TestScanner_Random(t *testing.T) {
 			t.FailNow()
 		}
 
-		err = scanner.Random()
+		scans, err := scanner.Random(Sample{Strategy: SamplePercent, Percent: 5})
 		if err != nil {
 			t.FailNow()
 		}
+		if len(scans) == 0 {
+			t.Fatal("no segments scanned")
+		}
+
+		for segment, ok := range scans {
+			if !ok {
+				fmt.Println(segment.Name(), "FAIL")
+				t.FailNow()
+			}
+		}
 	}
 }
 
@@ -226,7 +239,7 @@ func BenchmarkClient_EmulatePlayback(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, url := range testurls {
 			scanner, _ := New(url, maxConcurrency)
-			scanner.EmulatePlayback()
+			scanner.EmulatePlayback(PlaybackOptions{})
 		}
 	}
 }
@@ -235,7 +248,7 @@ func BenchmarkClient_Random(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for _, url := range testurls {
 			scanner, _ := New(url, maxConcurrency)
-			scanner.Random()
+			scanner.Random(Sample{Strategy: SamplePercent, Percent: 5})
 		}
 	}
 }
@@ -0,0 +1,50 @@
+package ottscanner
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"sync"
+)
+
+// RateLimiter limits the requests to each origin host with a token
+// bucket per host. Share a limiter between scanners with WithRateLimiter
+// so their requests to a host count together.
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+	mutex sync.Mutex
+	hosts map[string]*rate.Limiter
+}
+
+// NewRateLimiter returns a limiter that allows requestsPerSecond to each
+// host with bursts of up to burst requests. burst is at least 1.
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		limit: rate.Limit(requestsPerSecond),
+		burst: burst,
+		hosts: make(map[string]*rate.Limiter),
+	}
+}
+
+// Wait blocks until a request to the host is allowed or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, host string) error {
+	l.mutex.Lock()
+	limiter, ok := l.hosts[host]
+	if !ok {
+		limiter = rate.NewLimiter(l.limit, l.burst)
+		l.hosts[host] = limiter
+	}
+	l.mutex.Unlock()
+	return limiter.Wait(ctx)
+}
+
+// WithRateLimiter limits the rate of every request of the scanner to
+// each host, including playlist fetches, retries and emulated playback.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(s *Scanner) {
+		s.limiter = limiter
+	}
+}
@@ -0,0 +1,100 @@
+package ottscanner
+
+import (
+	"context"
+	"golang.org/x/sync/semaphore"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(20, 1)
+	ctx := context.Background()
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(ctx, "a.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+		t.Errorf("expected three requests to take at least 100ms, took: %v", elapsed)
+	}
+	started = time.Now()
+	if err := limiter.Wait(ctx, "b.example.com"); err != nil || time.Since(started) > 20*time.Millisecond {
+		t.Errorf("expected another host not to wait: %v", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := limiter.Wait(canceled, "a.example.com"); err == nil {
+		t.Error("expected an error waiting with a canceled context")
+	}
+}
+
+func TestScanner_RateLimiter(t *testing.T) {
+	origin := newTestOrigin(t)
+	limiter := NewRateLimiter(100, 1)
+	scanner, err := New(origin.URL+"/master.m3u8", 8, WithRateLimiter(limiter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	// the master playlist twice, both variants and every segment at 100/s
+	if elapsed := time.Since(started); elapsed < 120*time.Millisecond {
+		t.Errorf("expected the scan to be rate limited, took: %v", elapsed)
+	}
+}
+
+func TestScanner_DownloadBudget(t *testing.T) {
+	handler := newTestOriginHandler()
+	var inFlight, maxInFlight int
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".ts") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		handler.ServeHTTP(w, r)
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	budget := semaphore.NewWeighted(2)
+	scanner, err := New(server.URL+"/master.m3u8", 8, WithBudget(budget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Download(t.TempDir(), 8); err != nil {
+		t.Fatal(err)
+	}
+	var downloads int
+	for _, files := range scanner.Files() {
+		for _, download := range files {
+			if download.Error() != nil {
+				t.Error(download.Error())
+			}
+			downloads++
+		}
+	}
+	if downloads != 2*testOriginSegments {
+		t.Errorf("expected %d downloads, got: %d", 2*testOriginSegments, downloads)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("expected at most the budget of 2 requests in flight across streams, got: %d", maxInFlight)
+	}
+}
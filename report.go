@@ -0,0 +1,408 @@
+package ottscanner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReportFormat byte
+
+const (
+	ReportJSON ReportFormat = iota
+	ReportNDJSON
+	ReportCSV
+	ReportJUnit
+	ReportHTML
+)
+
+func (format ReportFormat) String() string {
+	switch format {
+	case ReportJSON:
+		return "json"
+	case ReportNDJSON:
+		return "ndjson"
+	case ReportCSV:
+		return "csv"
+	case ReportJUnit:
+		return "junit"
+	case ReportHTML:
+		return "html"
+	default:
+		return fmt.Sprintf("Unknown(%d)", format)
+	}
+}
+
+// ParseReportFormat returns the report format with the given name:
+// json, ndjson, csv, junit or html.
+func ParseReportFormat(name string) (ReportFormat, error) {
+	for _, format := range []ReportFormat{ReportJSON, ReportNDJSON, ReportCSV, ReportJUnit, ReportHTML} {
+		if strings.EqualFold(format.String(), name) {
+			return format, nil
+		}
+	}
+	return ReportJSON, newScannerError(errors.New("unknown report format"), name)
+}
+
+// SegmentResult is the outcome of requesting a single segment.
+type SegmentResult struct {
+	Stream string `json:"stream"`
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	OK     bool   `json:"ok"`
+	// Status is the HTTP status code of the response or 0 when there
+	// was no response.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Category is the FailureCategory of the error, such as dns,
+	// timeout or http_5xx.
+	Category string        `json:"category,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Attempts is the number of requests made for the segment when the
+	// scanner has a retry policy.
+	Attempts int `json:"attempts,omitempty"`
+	// Timings of the last attempt, or nil when there was no response.
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+func newSegmentResult(segment Segment, duration time.Duration, status int, err error) SegmentResult {
+	result := SegmentResult{
+		Stream:   segment.stream,
+		Name:     segment.name,
+		URL:      segment.url,
+		OK:       err == nil,
+		Status:   status,
+		Duration: duration,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		// content errors keep the status of the response
+		if code := statusCode(err); code != 0 {
+			result.Status = code
+		}
+		result.Category = Category(err).String()
+	}
+	return result
+}
+
+// StreamReport groups the segment results of an ABR stream.
+type StreamReport struct {
+	Name       string `json:"name"`
+	URL        string `json:"url,omitempty"`
+	Bandwidth  int    `json:"bandwidth,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	Codecs     string `json:"codecs,omitempty"`
+	// PlaylistModified is the Last-Modified time of the playlist of the
+	// stream, or of the manifest for DASH, when the origin sends it.
+	PlaylistModified *time.Time      `json:"playlist_modified,omitempty"`
+	Segments         []SegmentResult `json:"segments"`
+	// Timings are the percentiles of the timings of the segments.
+	Timings *TimingSummary `json:"timings,omitempty"`
+}
+
+// PlaylistFetch is a request of a playlist or manifest during a scan.
+// Fetches of live playlists make a timeline of their refreshes.
+type PlaylistFetch struct {
+	URL      string        `json:"url"`
+	Fetched  time.Time     `json:"fetched"`
+	Duration time.Duration `json:"duration"`
+	// Status is the HTTP status code of the response or 0 when there
+	// was no response.
+	Status   int        `json:"status,omitempty"`
+	Modified *time.Time `json:"modified,omitempty"`
+	Bytes    int        `json:"bytes"`
+	// Refreshed is true when the playlist differs from the previous
+	// fetch of the same playlist by the scanner.
+	Refreshed bool   `json:"refreshed"`
+	Error     string `json:"error,omitempty"`
+	// Attempts is the number of requests made for the fetch.
+	Attempts int      `json:"attempts,omitempty"`
+	Timings  *Timings `json:"timings,omitempty"`
+}
+
+// Report is the serializable result of a scan, a random sample or an
+// emulated playback. Durations are in nanoseconds.
+type Report struct {
+	Kind     string          `json:"kind"`
+	URL      string          `json:"url"`
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	Streams  []StreamReport  `json:"streams"`
+	Playback *PlaybackReport `json:"playback,omitempty"`
+	// Playlists are the playlist and manifest fetches of the scan.
+	Playlists []PlaylistFetch `json:"playlists,omitempty"`
+}
+
+// Report returns the report of the last Scan or Random call
+// or nil if nothing has been scanned yet.
+func (s *Scanner) Report() *Report {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.report
+}
+
+// setReport keeps the results of a scan as the report of the scanner
+func (s *Scanner) setReport(kind string, started time.Time, results []SegmentResult) {
+	format := s.contentFormat()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	report := &Report{
+		Kind:     kind,
+		URL:      s.url,
+		Started:  started,
+		Finished: time.Now(),
+	}
+	report.Streams = groupResults(s.streams, results)
+	report.Playlists = s.playlistFetches(started)
+	for i, stream := range report.Streams {
+		playlist := stream.URL
+		if format == DASH {
+			playlist = s.url
+		}
+		if modified, ok := s.modified[playlist]; ok {
+			report.Streams[i].PlaylistModified = &modified
+		}
+	}
+	s.report = report
+}
+
+// groupResults groups results by stream in the order the streams were
+// first seen, adding the attributes of the streams that are known.
+func groupResults(streams Streams, results []SegmentResult) []StreamReport {
+	var grouped []StreamReport
+	index := make(map[string]int)
+	for _, result := range results {
+		i, ok := index[result.Stream]
+		if !ok {
+			group := StreamReport{Name: result.Stream}
+			for _, stream := range streams {
+				if stream.name == result.Stream {
+					group.URL = stream.url
+					group.Bandwidth = stream.bandwidth
+					group.Resolution = stream.resolution
+					group.Codecs = stream.codecs
+					break
+				}
+			}
+			i = len(grouped)
+			index[result.Stream] = i
+			grouped = append(grouped, group)
+		}
+		grouped[i].Segments = append(grouped[i].Segments, result)
+	}
+	for i := range grouped {
+		grouped[i].Timings = summarizeTimings(grouped[i].Segments)
+	}
+	return grouped
+}
+
+// ToReport converts an emulated playback into a report with a segment
+// result for every segment the player fetched.
+func (p *PlaybackReport) ToReport() *Report {
+	var results []SegmentResult
+	for _, segment := range p.Segments {
+		results = append(results, SegmentResult{
+			Stream:   segment.Stream,
+			Name:     segment.Name,
+			URL:      segment.URL,
+			OK:       segment.Error == "",
+			Error:    segment.Error,
+			Duration: segment.DownloadTime,
+			Timings:  segment.Timings,
+		})
+	}
+	report := &Report{
+		Kind:      "emulate",
+		URL:       p.URL,
+		Started:   p.Started,
+		Finished:  p.Finished,
+		Playback:  p,
+		Playlists: p.Playlists,
+	}
+	report.Streams = groupResults(nil, results)
+	for i := range report.Streams {
+		for _, segment := range p.Segments {
+			if segment.Stream == report.Streams[i].Name {
+				report.Streams[i].Bandwidth = segment.Bandwidth
+				break
+			}
+		}
+	}
+	return report
+}
+
+// Results returns every segment result of the report in stream order.
+func (r *Report) Results() []SegmentResult {
+	var results []SegmentResult
+	for _, stream := range r.Streams {
+		results = append(results, stream.Segments...)
+	}
+	return results
+}
+
+// Failures returns the number of segments that failed.
+func (r *Report) Failures() int {
+	var failures int
+	for _, result := range r.Results() {
+		if !result.OK {
+			failures++
+		}
+	}
+	return failures
+}
+
+// Write renders the report in the given format.
+func (r *Report) Write(w io.Writer, format ReportFormat) error {
+	switch format {
+	case ReportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case ReportNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, result := range r.Results() {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ReportCSV:
+		return writeCSV(w, nil, r.Results())
+	case ReportJUnit:
+		return writeJUnit(w, r.URL, r.Started, r.Streams)
+	case ReportHTML:
+		return writeHTML(w, r)
+	default:
+		return newScannerError(errors.New("unknown report format"), format.String())
+	}
+}
+
+// ReadReport decodes a report written in the json format.
+func ReadReport(reader io.Reader) (*Report, error) {
+	report := new(Report)
+	if err := json.NewDecoder(reader).Decode(report); err != nil {
+		return nil, newScannerError(err, "error decoding report")
+	}
+	return report, nil
+}
+
+// writeCSV writes a row per result. Columns are prefixed with the
+// values of prefix, which must have a header and a value for every row.
+func writeCSV(w io.Writer, prefix [][]string, results []SegmentResult) error {
+	writer := csv.NewWriter(w)
+	header := []string{"stream", "name", "url", "ok", "status", "error", "duration_ms"}
+	if len(prefix) > 0 {
+		header = append(append([]string(nil), prefix[0]...), header...)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for i, result := range results {
+		record := []string{
+			result.Stream,
+			result.Name,
+			result.URL,
+			strconv.FormatBool(result.OK),
+			strconv.Itoa(result.Status),
+			result.Error,
+			strconv.FormatFloat(float64(result.Duration)/float64(time.Millisecond), 'f', 3, 64),
+		}
+		if len(prefix) > 0 {
+			record = append(append([]string(nil), prefix[i+1]...), record...)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// writeJUnit writes a test suite per stream with a test case per segment
+func writeJUnit(w io.Writer, url string, started time.Time, streams []StreamReport) error {
+	suites := junitTestSuites{Name: url}
+	var total time.Duration
+	for _, stream := range streams {
+		name := stream.Name
+		if name == "" {
+			name = path.Base(url)
+		}
+		suite := junitTestSuite{Name: name}
+		if !started.IsZero() {
+			suite.Timestamp = started.UTC().Format(time.RFC3339)
+		}
+		var elapsed time.Duration
+		for _, result := range stream.Segments {
+			testCase := junitTestCase{
+				ClassName: name,
+				Name:      result.Name,
+				Time:      junitSeconds(result.Duration),
+			}
+			if !result.OK {
+				testCase.Failure = &junitFailure{Message: "segment request failed", Text: result.Error}
+				suite.Failures++
+			}
+			elapsed += result.Duration
+			suite.Tests++
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		suite.Time = junitSeconds(elapsed)
+		total += elapsed
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+	suites.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,118 @@
+package ottscanner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testReport = &Report{
+	Kind: "scan",
+	URL:  "http://origin/master.m3u8",
+	Streams: []StreamReport{
+		{
+			Name:      "low.m3u8",
+			Bandwidth: 400000,
+			Segments: []SegmentResult{
+				{Stream: "low.m3u8", Name: "low_0.ts", URL: "http://origin/low_0.ts", OK: true, Duration: 10 * time.Millisecond},
+				{Stream: "low.m3u8", Name: "low_1.ts", URL: "http://origin/low_1.ts", Status: 404, Error: "404 Not Found", Duration: 5 * time.Millisecond},
+			},
+		},
+		{
+			Name: "high.m3u8",
+			Segments: []SegmentResult{
+				{Stream: "high.m3u8", Name: "high_0.ts", URL: "http://origin/high_0.ts", OK: true, Duration: 20 * time.Millisecond},
+			},
+		},
+	},
+}
+
+func TestReport_Write(t *testing.T) {
+	var out bytes.Buffer
+	if err := testReport.Write(&out, ReportJSON); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadReport(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(testReport, decoded) {
+		t.Fatalf("expected: %+v, got: %+v", testReport, decoded)
+	}
+
+	out.Reset()
+	if err := testReport.Write(&out, ReportNDJSON); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != 3 {
+		t.Fatalf("expected: 3 lines, got: %d", lines)
+	}
+
+	out.Reset()
+	if err := testReport.Write(&out, ReportCSV); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"low.m3u8", "low_1.ts", "http://origin/low_1.ts", "false", "404", "404 Not Found", "5.000"}
+	if len(records) != 4 || !reflect.DeepEqual(records[2], expected) {
+		t.Fatalf("expected: %v, got: %v", expected, records)
+	}
+
+	out.Reset()
+	if err := testReport.Write(&out, ReportJUnit); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || len(suites.Suites) != 2 {
+		t.Fatalf("unexpected test suites: %+v", suites)
+	}
+	if suites.Suites[0].Cases[1].Failure == nil || suites.Suites[0].Cases[1].Failure.Text != "404 Not Found" {
+		t.Fatalf("expected failure for low_1.ts: %+v", suites.Suites[0])
+	}
+}
+
+func TestParseReportFormat(t *testing.T) {
+	format, err := ParseReportFormat("JUnit")
+	if err != nil || format != ReportJUnit {
+		t.Fatalf("expected: %v, got: %v %v", ReportJUnit, format, err)
+	}
+	if _, err := ParseReportFormat("yaml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestScanner_Report(t *testing.T) {
+	origin := newTestOrigin(t)
+	scanner, err := New(origin.URL+"/master.m3u8", maxConcurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanner.Report() != nil {
+		t.Fatal("expected no report before scanning")
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	report := scanner.Report()
+	if report.Kind != "scan" || len(report.Streams) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	low := report.Streams[0]
+	if low.Name != "low.m3u8" || low.Bandwidth != 400000 || len(low.Segments) != testOriginSegments {
+		t.Fatalf("unexpected stream report: %+v", low)
+	}
+	if low.Segments[0].Name != "low_0.ts" || report.Failures() != 0 {
+		t.Fatalf("expected segments in playlist order without failures: %+v", low.Segments)
+	}
+}
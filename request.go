@@ -0,0 +1,354 @@
+package ottscanner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jkittell/toolbox"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	neturl "net/url"
+	"os"
+	"time"
+)
+
+// RequestKind is what a request of the scanner fetches.
+type RequestKind byte
+
+const (
+	// RequestPlaylist is a master playlist, variant playlist or manifest.
+	RequestPlaylist RequestKind = iota
+	// RequestSegment is a media or init segment.
+	RequestSegment
+)
+
+func (k RequestKind) String() string {
+	switch k {
+	case RequestPlaylist:
+		return "playlist"
+	case RequestSegment:
+		return "segment"
+	default:
+		return fmt.Sprintf("Unknown(%d)", k)
+	}
+}
+
+// HeaderFunc returns the headers of a single request, such as a token
+// signed for the url.
+type HeaderFunc func(kind RequestKind, url string) map[string]string
+
+// WithHeaderFunc adds the headers returned by fn to every request. They
+// win over the headers of WithHeaders.
+func WithHeaderFunc(fn HeaderFunc) Option {
+	return func(s *Scanner) {
+		s.headerFunc = fn
+	}
+}
+
+// WithCookieJar sets the cookie jar of the scanner. Scanners keep the
+// cookies set by the origin across master, variant and segment requests
+// in a jar of their own by default. Share a jar to keep cookies across
+// scanners, or pass nil to send no cookies.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(s *Scanner) {
+		s.client.Jar = jar
+	}
+}
+
+// newCookieJar returns an empty jar. It only fails on a bad public
+// suffix list, which is not given.
+func newCookieJar() http.CookieJar {
+	jar, _ := cookiejar.New(nil)
+	return jar
+}
+
+// WithQueryPropagation adds the query parameters of the master playlist
+// or manifest url, such as an auth token, to every variant and segment
+// request that does not have them. Only the named parameters are added,
+// or every parameter when there are no names.
+func WithQueryPropagation(names ...string) Option {
+	return func(s *Scanner) {
+		s.propagateQuery = true
+		s.propagatedParameters = names
+	}
+}
+
+// requestURL returns the url with the query parameters propagated from
+// the master url
+func (s *Scanner) requestURL(url string) string {
+	if !s.propagateQuery || url == s.url {
+		return url
+	}
+	master, err := neturl.Parse(s.url)
+	if err != nil || master.RawQuery == "" {
+		return url
+	}
+	child, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	parameters := master.Query()
+	query := child.Query()
+	changed := false
+	for name, values := range parameters {
+		if len(s.propagatedParameters) > 0 && !containsString(s.propagatedParameters, name) {
+			continue
+		}
+		if _, ok := query[name]; !ok {
+			query[name] = values
+			changed = true
+		}
+	}
+	if !changed {
+		return url
+	}
+	child.RawQuery = query.Encode()
+	return child.String()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// requestHeaders merges the scanner headers, the headers of the header
+// func and the headers of a single request. Headers of the request win.
+func (s *Scanner) requestHeaders(kind RequestKind, url string, headers map[string]string) map[string]string {
+	var fromFunc map[string]string
+	if s.headerFunc != nil {
+		fromFunc = s.headerFunc(kind, url)
+	}
+	if len(s.headers) == 0 && len(fromFunc) == 0 {
+		return headers
+	}
+	merged := make(map[string]string, len(s.headers)+len(fromFunc)+len(headers))
+	for k, v := range s.headers {
+		merged[k] = v
+	}
+	for k, v := range fromFunc {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	return merged
+}
+
+// rangeHeader returns the Range header of the byte range of a segment,
+// or nil when the segment is the whole file
+func rangeHeader(segment Segment) map[string]string {
+	if segment.byteRangeStart < 0 || segment.byteRangeSize < 0 {
+		return nil
+	}
+	return map[string]string{
+		"Range": fmt.Sprintf("bytes=%d-%d", segment.byteRangeStart, segment.byteRangeStart+segment.byteRangeSize-1),
+	}
+}
+
+// statusCode returns the status code of the response that failed with
+// err, or 0 when there was no response.
+func statusCode(err error) int {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.StatusCode
+	}
+	return 0
+}
+
+// do sends a request with the scanner headers and client and records
+// its timings in trace when it is not nil. The caller must close the
+// body of the response.
+func (s *Scanner) do(trace *requestTrace, kind RequestKind, method toolbox.RequestMethod, url string, headers map[string]string) (*http.Response, error) {
+	ctx := s.ctx
+	if trace != nil {
+		ctx = httptrace.WithClientTrace(ctx, trace.clientTrace())
+	}
+	req, err := http.NewRequestWithContext(ctx, method.String(), s.requestURL(url), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.requestHeaders(kind, url, headers) {
+		req.Header.Set(k, v)
+	}
+	if s.limiter != nil {
+		if err := s.limiter.Wait(s.ctx, req.URL.Host); err != nil {
+			return nil, err
+		}
+	}
+	// signed after waiting so the signature does not expire in the wait
+	if s.signer != nil {
+		if err := s.signer.Sign(req); err != nil {
+			return nil, newScannerError(err, "signing "+url)
+		}
+	}
+	if trace != nil {
+		// waiting for the rate limiter is not part of the timings
+		trace.reset()
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &HTTPError{Method: method.String(), URL: url, Status: resp.Status, StatusCode: resp.StatusCode,
+			retryAfter: resp.Header.Get("Retry-After")}
+	}
+	return resp, nil
+}
+
+// request sends a request with the scanner headers and retry policy and
+// returns the body
+func (s *Scanner) request(method toolbox.RequestMethod, url string, headers map[string]string) ([]byte, error) {
+	var body []byte
+	_, err := s.retry(url, func() error {
+		resp, err := s.do(nil, RequestPlaylist, method, url, headers)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, err = io.ReadAll(resp.Body)
+		return err
+	})
+	return body, err
+}
+
+// maxPlaylistFetches bounds the playlist fetches a scanner keeps
+const maxPlaylistFetches = 1000
+
+// playlist is the response to a playlist or manifest request
+type playlist struct {
+	body        []byte
+	contentType string
+	// url is the url of the response after redirects
+	url string
+}
+
+// requestPlaylist gets a playlist or manifest and keeps the fetch and
+// its Last-Modified time for reports. The body fetched to detect the
+// format of the url is used for the first request of the url.
+func (s *Scanner) requestPlaylist(url string) ([]byte, error) {
+	s.mutex.Lock()
+	body := s.detected
+	if url == s.url {
+		s.detected = nil
+	}
+	s.mutex.Unlock()
+	if url == s.url && body != nil {
+		return body, nil
+	}
+	playlist, err := s.fetchPlaylist(url)
+	return playlist.body, err
+}
+
+// fetchPlaylist gets a playlist or manifest and keeps the fetch and its
+// Last-Modified time for reports
+func (s *Scanner) fetchPlaylist(url string) (playlist, error) {
+	fetch := PlaylistFetch{URL: url, Fetched: time.Now()}
+	trace := new(requestTrace)
+	response := playlist{url: url}
+	var body []byte
+	attempts, err := s.retry(url, func() error {
+		fetch.Status, fetch.Modified = 0, nil
+		resp, err := s.do(trace, RequestPlaylist, toolbox.GET, url, nil)
+		if err != nil {
+			fetch.Status = statusCode(err)
+			return err
+		}
+		defer resp.Body.Close()
+		fetch.Status = resp.StatusCode
+		if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			fetch.Modified = &modified
+		}
+		response.contentType = resp.Header.Get("Content-Type")
+		if resp.Request != nil && resp.Request.URL != nil {
+			response.url = resp.Request.URL.String()
+		}
+		body, err = io.ReadAll(resp.Body)
+		return err
+	})
+	fetch.Duration = time.Since(fetch.Fetched)
+	fetch.Timings = trace.result()
+	if s.retryPolicy.MaxAttempts > 1 {
+		fetch.Attempts = attempts
+	}
+	fetch.Bytes = len(body)
+	if err != nil {
+		fetch.Error = err.Error()
+		body = nil
+	}
+	s.addPlaylistFetch(fetch, body)
+	response.body = body
+	return response, err
+}
+
+// addPlaylistFetch keeps a fetch, marking it refreshed when the body
+// differs from the last fetch of the same playlist
+func (s *Scanner) addPlaylistFetch(fetch PlaylistFetch, body []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if fetch.Modified != nil {
+		if s.modified == nil {
+			s.modified = make(map[string]time.Time)
+		}
+		s.modified[fetch.URL] = *fetch.Modified
+	}
+	if fetch.Error == "" {
+		hash := fnv.New64a()
+		hash.Write(body)
+		digest := hash.Sum64()
+		if s.digests == nil {
+			s.digests = make(map[string]uint64)
+		}
+		previous, ok := s.digests[fetch.URL]
+		fetch.Refreshed = ok && previous != digest
+		s.digests[fetch.URL] = digest
+	}
+	if len(s.fetches) >= maxPlaylistFetches {
+		s.fetches = s.fetches[1:]
+	}
+	s.fetches = append(s.fetches, fetch)
+}
+
+// playlistFetches returns the playlist fetches since a time. The caller
+// must hold the mutex.
+func (s *Scanner) playlistFetches(since time.Time) []PlaylistFetch {
+	var fetches []PlaylistFetch
+	for _, fetch := range s.fetches {
+		if !fetch.Fetched.Before(since) {
+			fetches = append(fetches, fetch)
+		}
+	}
+	return fetches
+}
+
+// downloadFile downloads the url into filePath with the scanner headers
+// and retry policy and returns the bytes written and the attempts made.
+// The timings of the request are recorded in trace when it is not nil.
+func (s *Scanner) downloadFile(trace *requestTrace, kind RequestKind, filePath, url string, headers map[string]string) (int64, int, error) {
+	var written int64
+	attempts, err := s.retry(url, func() error {
+		resp, err := s.do(trace, kind, toolbox.GET, url, headers)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		out, err := os.Create(filePath)
+		if err != nil {
+			return err
+		}
+		written, err = io.Copy(out, resp.Body)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+	return written, attempts, err
+}
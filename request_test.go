@@ -0,0 +1,72 @@
+package ottscanner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScanner_RequestHeaders(t *testing.T) {
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/master.m3u8" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1", Path: "/"})
+		} else if _, err := r.Cookie("session"); err != nil {
+			http.Error(w, "no session", http.StatusForbidden)
+			return
+		}
+		kind := "playlist"
+		if strings.HasSuffix(r.URL.Path, ".ts") {
+			kind = "segment"
+		}
+		propagated := r.URL.Path != "/master.m3u8" && r.URL.Query().Has("other")
+		if r.URL.Query().Get("token") != "abc" || propagated || r.Header.Get("Referer") != "https://player" ||
+			r.Header.Get("X-Kind") != kind {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	headerFunc := func(kind RequestKind, url string) map[string]string {
+		return map[string]string{"X-Kind": kind.String()}
+	}
+	options := []Option{WithHeaders(map[string]string{"Referer": "https://player"}), WithHeaderFunc(headerFunc)}
+	scanner, err := New(server.URL+"/master.m3u8?token=abc&other=1", 4, append(options, WithQueryPropagation("token"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	report := scanner.Report()
+	if report.Failures() != 0 || len(report.Results()) != 2*testOriginSegments {
+		t.Errorf("expected every segment to be ok, got: %+v", report.Results())
+	}
+	// the token is sent but not kept in the report
+	if url := report.Results()[0].URL; strings.Contains(url, "token") {
+		t.Errorf("expected the segment url without the token, got: %s", url)
+	}
+
+	scanner, _ = New(server.URL+"/master.m3u8?token=abc", 4, options...)
+	if _, err := scanner.Segments(); err == nil {
+		t.Error("expected variants without the token to be forbidden")
+	}
+
+	scanner, _ = New(server.URL+"/master.m3u8?token=abc", 4, append(options, WithQueryPropagation(), WithCookieJar(nil))...)
+	if _, err := scanner.Segments(); err == nil {
+		t.Error("expected variants without the session cookie to be forbidden")
+	}
+}
+
+func TestRangeHeader(t *testing.T) {
+	if headers := rangeHeader(Segment{byteRangeStart: -1, byteRangeSize: -1}); headers != nil {
+		t.Errorf("expected no range header, got: %v", headers)
+	}
+	headers := rangeHeader(Segment{byteRangeStart: 1024, byteRangeSize: 512})
+	if headers["Range"] != "bytes=1024-1535" {
+		t.Errorf("unexpected range header: %v", headers)
+	}
+}
@@ -0,0 +1,175 @@
+package ottscanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Resolve sends the requests to Host and Port to IP instead of an
+// address Host resolves to, like curl --resolve. The Host header and TLS
+// server name are still Host. An empty or * Port matches every port.
+type Resolve struct {
+	Host string
+	Port string
+	IP   string
+}
+
+// ParseResolve parses a host:port:ip override such as
+// cdn.example.com:443:192.0.2.10. IPv6 addresses may be in brackets.
+func ParseResolve(value string) (Resolve, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return Resolve{}, fmt.Errorf("resolve must look like host:port:ip: %s", value)
+	}
+	resolve := Resolve{Host: parts[0], Port: parts[1], IP: strings.Trim(parts[2], "[]")}
+	if net.ParseIP(resolve.IP) == nil {
+		return Resolve{}, fmt.Errorf("not an ip address: %s", parts[2])
+	}
+	return resolve, nil
+}
+
+func (r Resolve) String() string {
+	return fmt.Sprintf("%s:%s:%s", r.Host, r.Port, r.IP)
+}
+
+// matches returns true when the override applies to a dial of host and
+// port
+func (r Resolve) matches(host, port string) bool {
+	return strings.EqualFold(r.Host, host) && (r.Port == "" || r.Port == "*" || r.Port == port)
+}
+
+// WithResolve dials the IP of each override instead of resolving its
+// host. Requests through a proxy dial the proxy so they are not changed.
+func WithResolve(resolves ...Resolve) Option {
+	return func(s *Scanner) {
+		transport := s.transport()
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if host, port, err := net.SplitHostPort(address); err == nil {
+				for _, resolve := range resolves {
+					if resolve.matches(host, port) {
+						address = net.JoinHostPort(resolve.IP, port)
+						break
+					}
+				}
+			}
+			return dial(ctx, network, address)
+		}
+	}
+}
+
+// ResolveEdges returns every A and AAAA address of the host of the url.
+// A url with an ip address returns that address.
+func ResolveEdges(ctx context.Context, rawURL string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		return []string{ip.String()}, nil
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return nil, newScannerError(err, "error resolving "+u.Hostname())
+	}
+	ips := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if ip := address.IP.String(); !containsString(ips, ip) {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
+
+// withEdge dials ip for host and for every other host that resolves to
+// one of the edges, so playlists and segments on other hostnames of the
+// same CDN are fetched through the edge too. Hosts that do not resolve
+// to an edge, such as a separate segment CDN, are not pinned and are
+// logged as a warning.
+func withEdge(host, ip string, edges []string) Option {
+	return func(s *Scanner) {
+		transport := s.transport()
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		var mutex sync.Mutex
+		pinned := map[string]bool{strings.ToLower(host): true}
+		pin := func(ctx context.Context, host string) bool {
+			host = strings.ToLower(host)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if pin, ok := pinned[host]; ok {
+				return pin
+			}
+			pinned[host] = false
+			if net.ParseIP(host) == nil {
+				addresses, _ := net.DefaultResolver.LookupIPAddr(ctx, host)
+				for _, address := range addresses {
+					if containsString(edges, address.IP.String()) {
+						pinned[host] = true
+						break
+					}
+				}
+			}
+			if !pinned[host] {
+				s.logger.Warn("host does not resolve to an edge so it is not scanned through the edge", "host", host, "edge", ip)
+			}
+			return pinned[host]
+		}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			if host, port, err := net.SplitHostPort(address); err == nil && pin(ctx, host) {
+				address = net.JoinHostPort(ip, port)
+			}
+			return dial(ctx, network, address)
+		}
+	}
+}
+
+// ScanEdges scans the url once through each edge ip, or through every
+// address its host resolves to when ips is empty, so a broken edge node
+// can be found. The report has a channel per ip keyed by the ip. Host
+// and TLS server name stay those of the url. Variants and segments on
+// other hosts are fetched through the edge when their host resolves to
+// one of the ips, otherwise as usual.
+func ScanEdges(ctx context.Context, rawURL string, ips []string, options BatchOptions) (*BatchReport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, newScannerError(err, rawURL)
+	}
+	if len(ips) == 0 {
+		if ips, err = ResolveEdges(ctx, rawURL); err != nil {
+			return nil, err
+		}
+	}
+	if len(ips) == 0 {
+		return nil, newScannerError(errors.New("no addresses"), u.Hostname())
+	}
+	if options.Context == nil {
+		options.Context = ctx
+	}
+	channels := make([]Channel, len(ips))
+	for i, ip := range ips {
+		channels[i] = Channel{Name: ip, URL: rawURL}
+	}
+	channelOptions := options.ChannelOptions
+	options.ChannelOptions = func(channel Channel) ([]Option, error) {
+		var edgeOptions []Option
+		if channelOptions != nil {
+			var err error
+			if edgeOptions, err = channelOptions(channel); err != nil {
+				return nil, err
+			}
+		}
+		return append(edgeOptions, withEdge(u.Hostname(), channel.Name, ips)), nil
+	}
+	return ScanBatch(channels, options)
+}
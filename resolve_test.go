@@ -0,0 +1,122 @@
+package ottscanner
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestParseResolve(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Resolve
+		ok       bool
+	}{
+		{"cdn.example.com:443:192.0.2.10", Resolve{"cdn.example.com", "443", "192.0.2.10"}, true},
+		{"cdn.example.com:*:[2001:db8::1]", Resolve{"cdn.example.com", "*", "2001:db8::1"}, true},
+		{"cdn.example.com:443:2001:db8::1", Resolve{"cdn.example.com", "443", "2001:db8::1"}, true},
+		{"cdn.example.com:443", Resolve{}, false},
+		{"cdn.example.com:443:edge", Resolve{}, false},
+	}
+	for _, test := range tests {
+		resolve, err := ParseResolve(test.value)
+		if (err == nil) != test.ok || resolve != test.expected {
+			t.Errorf("expected %+v for %s, got: %+v %v", test.expected, test.value, resolve, err)
+		}
+	}
+}
+
+func TestScanner_Resolve(t *testing.T) {
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, _, _ := net.SplitHostPort(r.Host); host != "edge.test" {
+			http.Error(w, "wrong host", http.StatusMisdirectedRequest)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	ip, port, _ := net.SplitHostPort(u.Host)
+
+	// edge.test does not resolve so every request must be overridden
+	edgeURL := "http://edge.test:" + port + "/master.m3u8"
+	scanner, _ := New(edgeURL, 4, WithResolve(Resolve{Host: "edge.test", Port: port, IP: ip}))
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if failures := scanner.Report().Failures(); failures != 0 {
+		t.Errorf("expected no failures, got: %d", failures)
+	}
+
+	report, err := ScanEdges(context.Background(), edgeURL, []string{ip, "127.0.0.2"}, BatchOptions{MaxConcurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Channels) != 2 || report.Channels["127.0.0.2"].OK() {
+		t.Fatalf("expected the unreachable edge to fail, got: %+v", report.Channels)
+	}
+	if edge := report.Channels[ip]; !edge.OK() || edge.Report.URL != edgeURL {
+		t.Errorf("expected the edge to be scanned with the host of the url, got: %+v", edge)
+	}
+
+	if ips, err := ResolveEdges(context.Background(), server.URL); err != nil || len(ips) != 1 || ips[0] != ip {
+		t.Errorf("expected the ip of the url, got: %v %v", ips, err)
+	}
+}
+
+func TestScanEdges_OtherHosts(t *testing.T) {
+	// the same origin on two edges of one port, which serve variants and
+	// segments from localhost
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(first.Addr().String())
+	second, err := net.Listen("tcp", "127.0.0.2:"+port)
+	if err != nil {
+		first.Close()
+		t.Skip("no second loopback address:", err)
+	}
+	var mutex sync.Mutex
+	served := make(map[string]int)
+	origin := newTestOriginHandler()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		local := r.Context().Value(http.LocalAddrContextKey).(net.Addr).String()
+		mutex.Lock()
+		served[r.Host+" "+local]++
+		mutex.Unlock()
+		if r.URL.Path == "/master.m3u8" {
+			fmt.Fprintf(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nhttp://localhost:%s/low.m3u8\n", port)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	})
+	for _, listener := range []net.Listener{first, second} {
+		server := &httptest.Server{Listener: listener, Config: &http.Server{Handler: handler}}
+		server.Start()
+		defer server.Close()
+	}
+
+	edgeURL := "http://edge.test:" + port + "/master.m3u8"
+	report, err := ScanEdges(context.Background(), edgeURL, []string{"127.0.0.1", "127.0.0.2"}, BatchOptions{MaxConcurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Failures() != 0 {
+		t.Fatalf("expected both edges to pass, got: %+v", report.Channels)
+	}
+	// localhost resolves to an edge so its requests go through the edge
+	// being scanned
+	mutex.Lock()
+	defer mutex.Unlock()
+	firstEdge, secondEdge := served["localhost:"+port+" 127.0.0.1:"+port], served["localhost:"+port+" 127.0.0.2:"+port]
+	if secondEdge <= testOriginSegments || secondEdge != firstEdge {
+		t.Errorf("expected the variant and segments through each edge, got: %v", served)
+	}
+}
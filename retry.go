@@ -0,0 +1,128 @@
+package ottscanner
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy retries playlist, manifest, segment and download requests
+// that failed with a connection error, a timeout or one of the retryable
+// status codes. Emulated playback is not retried so it measures what a
+// player would see on the first attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a request including the
+	// first. Requests are not retried when it is less than 2.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles with every
+	// retry. Defaults to 200ms.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts, including the delay
+	// asked for by a Retry-After header. Defaults to 10s.
+	MaxBackoff time.Duration
+	// Jitter is the fraction from 0 to 1 of each delay that is random so
+	// retries of many segments are spread out.
+	Jitter float64
+	// Statuses are the retryable status codes. Defaults to 408, 429, 500,
+	// 502, 503 and 504.
+	Statuses []int
+}
+
+var defaultRetryStatuses = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// WithRetry sets the retry policy of the scanner. Segment results and
+// playlist fetches of reports record the number of attempts.
+func WithRetry(policy RetryPolicy) Option {
+	return func(s *Scanner) {
+		if policy.Backoff <= 0 {
+			policy.Backoff = 200 * time.Millisecond
+		}
+		if policy.MaxBackoff <= 0 {
+			policy.MaxBackoff = 10 * time.Second
+		}
+		if policy.Statuses == nil {
+			policy.Statuses = defaultRetryStatuses
+		}
+		s.retryPolicy = policy
+	}
+}
+
+// retryable returns true when a request that failed with err may
+// succeed when it is sent again
+func (p RetryPolicy) retryable(err error) bool {
+	switch Category(err) {
+	case FailureConnect, FailureTimeout:
+		return true
+	case FailureClient, FailureServer:
+		code := statusCode(err)
+		for _, status := range p.Statuses {
+			if status == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// delay returns the wait before the retry after the attempt, which is
+// 1 for the first attempt
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	delay := p.Backoff << (attempt - 1)
+	if delay <= 0 || delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	if after := retryAfter(err); after > delay {
+		delay = after
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// retryAfter returns the delay of the Retry-After header of the response
+// that failed with err, or 0 when there is none
+func retryAfter(err error) time.Duration {
+	var he *HTTPError
+	if !errors.As(err, &he) || he.retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(he.retryAfter); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(he.retryAfter); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// retry calls attempt until it succeeds, fails with an error that is not
+// retryable or the policy runs out of attempts. It returns the number of
+// attempts made.
+func (s *Scanner) retry(url string, attempt func() error) (int, error) {
+	for attempts := 1; ; attempts++ {
+		err := attempt()
+		if err == nil || attempts >= s.retryPolicy.MaxAttempts || !s.retryPolicy.retryable(err) || s.ctx.Err() != nil {
+			return attempts, err
+		}
+		delay := s.retryPolicy.delay(attempts, err)
+		s.logger.Debug("retrying request", "url", url, "attempt", attempts, "delay", delay, "error", err)
+		select {
+		case <-s.ctx.Done():
+			return attempts, err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package ottscanner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	if delay := policy.delay(1, nil); delay != 100*time.Millisecond {
+		t.Errorf("expected the backoff before the first retry, got: %v", delay)
+	}
+	if delay := policy.delay(3, nil); delay != 400*time.Millisecond {
+		t.Errorf("expected the backoff to double, got: %v", delay)
+	}
+	if delay := policy.delay(10, nil); delay != time.Second {
+		t.Errorf("expected the max backoff, got: %v", delay)
+	}
+	unavailable := &HTTPError{StatusCode: http.StatusServiceUnavailable, retryAfter: "1"}
+	if delay := policy.delay(1, unavailable); delay != time.Second {
+		t.Errorf("expected the Retry-After delay, got: %v", delay)
+	}
+	unavailable.retryAfter = "120"
+	if delay := policy.delay(1, unavailable); delay != time.Second {
+		t.Errorf("expected Retry-After to be capped, got: %v", delay)
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := policy.delay(2, nil); delay < 100*time.Millisecond || delay > 200*time.Millisecond {
+			t.Fatalf("expected a delay between 100ms and 200ms, got: %v", delay)
+		}
+	}
+}
+
+func TestScanner_Retry(t *testing.T) {
+	origin := newTestOriginHandler()
+	requests := make(map[string]int)
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		count := requests[r.Method+" "+r.URL.Path]
+		heads := requests["HEAD "+r.URL.Path]
+		mutex.Unlock()
+		switch {
+		case r.URL.Path == "/low.m3u8" && count == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/high_1.ts" && heads <= 2:
+			// the GET fallback of the first two attempts fails too
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/low_2.ts":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/low_3.ts":
+			http.NotFound(w, r)
+		default:
+			origin.ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner, err := New(server.URL+"/master.m3u8", 4, WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	report := scanner.Report()
+	attempts := make(map[string]SegmentResult)
+	for _, result := range report.Results() {
+		attempts[result.Name] = result
+	}
+	expected := map[string]struct {
+		ok       bool
+		attempts int
+	}{
+		"high_1.ts": {true, 3},
+		"low_2.ts":  {false, 3},
+		"low_3.ts":  {false, 1},
+		"low_0.ts":  {true, 1},
+	}
+	for name, e := range expected {
+		if result := attempts[name]; result.OK != e.ok || result.Attempts != e.attempts {
+			t.Errorf("expected %s ok %v after %d attempts, got: %+v", name, e.ok, e.attempts, result)
+		}
+	}
+	if len(report.Playlists) < 2 || report.Playlists[1].Attempts != 2 || report.Playlists[1].Error != "" {
+		t.Errorf("expected the low playlist to succeed on the second attempt, got: %+v", report.Playlists)
+	}
+
+	directory := t.TempDir()
+	scanner, _ = New(server.URL+"/master.m3u8", 4, WithRetry(RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}))
+	if err := scanner.Download(directory, 4); err != nil {
+		t.Fatal(err)
+	}
+	var failed int
+	for _, downloads := range scanner.Files() {
+		for _, download := range downloads {
+			if download.Error() == nil {
+				if _, err := os.Stat(download.File()); err != nil {
+					t.Error(err)
+				}
+				continue
+			}
+			failed++
+			if download.Attempts() != 2 && download.Attempts() != 1 {
+				t.Errorf("unexpected attempts of a failed download: %d", download.Attempts())
+			}
+		}
+	}
+	if failed != 2 {
+		t.Errorf("expected the two failing segments in the files, got: %d", failed)
+	}
+}
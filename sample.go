@@ -0,0 +1,160 @@
+package ottscanner
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+type SampleStrategy byte
+
+const (
+	// SampleUniform picks Count segments at random across all streams.
+	SampleUniform SampleStrategy = iota
+	// SamplePerStream picks Count segments at random from each stream.
+	SamplePerStream
+	// SampleFirstMiddleLast picks the first, middle and last segment of each stream.
+	SampleFirstMiddleLast
+	// SamplePercent picks Percent of the segments of each stream at random.
+	SamplePercent
+)
+
+func (strategy SampleStrategy) String() string {
+	switch strategy {
+	case SampleUniform:
+		return "uniform"
+	case SamplePerStream:
+		return "per-stream"
+	case SampleFirstMiddleLast:
+		return "first-middle-last"
+	case SamplePercent:
+		return "percent"
+	default:
+		return fmt.Sprintf("Unknown(%d)", strategy)
+	}
+}
+
+// ParseSampleStrategy returns the sample strategy with the given name:
+// uniform, per-stream, first-middle-last or percent.
+func ParseSampleStrategy(name string) (SampleStrategy, error) {
+	for _, strategy := range []SampleStrategy{SampleUniform, SamplePerStream, SampleFirstMiddleLast, SamplePercent} {
+		if strategy.String() == name {
+			return strategy, nil
+		}
+	}
+	return SampleUniform, newScannerError(errors.New("unknown sample strategy"), name)
+}
+
+// Sample configures which segments Random scans. Random choices are
+// drawn from a source seeded with Seed so the same sample of the same
+// playlists always selects the same segments.
+type Sample struct {
+	Strategy SampleStrategy
+	Count    int
+	Percent  float64
+	Seed     int64
+}
+
+// Random will do a head request on a sample of the segments of every
+// ABR stream and return a map of the segment scanned and if it was
+// scanned successfully, the same as Scan. The details of every request
+// are kept for scanner.Report().
+func (s *Scanner) Random(sample Sample) (map[Segment]bool, error) {
+	started := time.Now()
+	streams, err := s.Streams()
+	if err != nil {
+		err = newScannerError(err, fmt.Sprintf("error getting streams: %s", s.url))
+		s.observe(nil, err)
+		return make(map[Segment]bool), err
+	}
+	var playlists []Segments
+	for _, stream := range streams {
+		segments, err := s.streamSegments(stream)
+		if err != nil {
+			s.observe(nil, err)
+			return make(map[Segment]bool), err
+		}
+		playlists = append(playlists, segments)
+	}
+
+	segments, err := sampleSegments(playlists, sample)
+	if err == nil && len(segments) == 0 {
+		err = ErrNoSegments
+	}
+	if err != nil {
+		err = newScannerError(err, fmt.Sprintf("error sampling segments: %s", s.url))
+		s.observe(nil, err)
+		return make(map[Segment]bool), err
+	}
+	s.logger.Debug("scanning sampled segments", "url", s.url, "strategy", sample.Strategy.String(), "segments", len(segments))
+	results, details, err := s.scan(segments)
+	s.setReport("random", started, details)
+	s.observe(s.Report(), err)
+	return results, err
+}
+
+// sampleSegments selects segments from the playlists of each stream
+func sampleSegments(playlists []Segments, sample Sample) (Segments, error) {
+	random := rand.New(rand.NewSource(sample.Seed))
+	var sampled Segments
+	switch sample.Strategy {
+	case SampleUniform:
+		if sample.Count < 1 {
+			return sampled, errors.New("uniform sample needs a count of at least 1")
+		}
+		var all Segments
+		for _, segments := range playlists {
+			all = append(all, segments...)
+		}
+		sampled = pick(random, all, sample.Count)
+	case SamplePerStream:
+		if sample.Count < 1 {
+			return sampled, errors.New("per stream sample needs a count of at least 1")
+		}
+		for _, segments := range playlists {
+			sampled = append(sampled, pick(random, segments, sample.Count)...)
+		}
+	case SampleFirstMiddleLast:
+		for _, segments := range playlists {
+			if len(segments) == 0 {
+				continue
+			}
+			positions := []int{0, len(segments) / 2, len(segments) - 1}
+			for i, position := range positions {
+				// short playlists have overlapping positions
+				if i > 0 && position == positions[i-1] {
+					continue
+				}
+				sampled = append(sampled, segments[position])
+			}
+		}
+	case SamplePercent:
+		if sample.Percent <= 0 || sample.Percent > 100 {
+			return sampled, errors.New("percent sample must be greater than 0 and at most 100")
+		}
+		for _, segments := range playlists {
+			count := int(math.Ceil(float64(len(segments)) * sample.Percent / 100))
+			sampled = append(sampled, pick(random, segments, count)...)
+		}
+	default:
+		return sampled, fmt.Errorf("unknown sample strategy: %s", sample.Strategy)
+	}
+	return sampled, nil
+}
+
+// pick returns n segments chosen at random keeping their playlist order
+func pick(random *rand.Rand, segments Segments, n int) Segments {
+	if n >= len(segments) {
+		return append(Segments(nil), segments...)
+	}
+	indexes := random.Perm(len(segments))[:n]
+	sort.Ints(indexes)
+	picked := make(Segments, 0, n)
+	for _, i := range indexes {
+		picked = append(picked, segments[i])
+	}
+	return picked
+}
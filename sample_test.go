@@ -0,0 +1,70 @@
+package ottscanner
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testPlaylists(streams, segments int) []Segments {
+	var playlists []Segments
+	for i := 0; i < streams; i++ {
+		var playlist Segments
+		for j := 0; j < segments; j++ {
+			name := fmt.Sprintf("%d_%d.ts", i, j)
+			playlist = append(playlist, Segment{name: name, url: "http://origin/" + name, stream: fmt.Sprint(i)})
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists
+}
+
+func TestSampleSegments(t *testing.T) {
+	playlists := testPlaylists(3, 10)
+	tests := []struct {
+		sample   Sample
+		expected int
+	}{
+		{Sample{Strategy: SampleUniform, Count: 4, Seed: 1}, 4},
+		{Sample{Strategy: SamplePerStream, Count: 2, Seed: 1}, 6},
+		{Sample{Strategy: SampleFirstMiddleLast}, 9},
+		{Sample{Strategy: SamplePercent, Percent: 25, Seed: 1}, 9},
+	}
+	for _, test := range tests {
+		sampled, err := sampleSegments(playlists, test.sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sampled) != test.expected {
+			t.Fatalf("%s expected: %d, got: %d", test.sample.Strategy, test.expected, len(sampled))
+		}
+		again, _ := sampleSegments(playlists, test.sample)
+		if !reflect.DeepEqual(sampled, again) {
+			t.Fatalf("%s expected the same sample for the same seed", test.sample.Strategy)
+		}
+	}
+
+	if _, err := sampleSegments(playlists, Sample{Strategy: SampleUniform}); err == nil {
+		t.Fatal("expected error for uniform sample without count")
+	}
+}
+
+func TestScanner_RandomOrigin(t *testing.T) {
+	origin := newTestOrigin(t)
+	scanner, err := New(origin.URL+"/master.m3u8", maxConcurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scans, err := scanner.Random(Sample{Strategy: SamplePerStream, Count: 2, Seed: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scans) != 4 {
+		t.Fatalf("expected: %d, got: %d", 4, len(scans))
+	}
+	for segment, ok := range scans {
+		if !ok {
+			t.Fatal(segment.Name(), "FAIL")
+		}
+	}
+}
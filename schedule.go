@@ -0,0 +1,176 @@
+package ottscanner
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a monitored stream is scanned next.
+type Schedule interface {
+	// Next returns the first time after the given time to scan.
+	Next(after time.Time) time.Time
+}
+
+type interval time.Duration
+
+func (i interval) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(i))
+}
+
+func (i interval) String() string {
+	return time.Duration(i).String()
+}
+
+// Every returns a schedule that scans at a fixed interval.
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+// ParseSchedule parses an interval such as "30s" or "5m", or a cron
+// expression such as "*/5 * * * *".
+func ParseSchedule(value string) (Schedule, error) {
+	value = strings.TrimSpace(value)
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return nil, newScannerError(errors.New("interval must be positive"), value)
+		}
+		return Every(d), nil
+	}
+	return ParseCron(value)
+}
+
+// cronSchedule is a standard five field cron expression: minute, hour,
+// day of month, month and day of week.
+type cronSchedule struct {
+	expression string
+	minutes    [60]bool
+	hours      [24]bool
+	days       [32]bool
+	months     [13]bool
+	weekdays   [7]bool
+	// restricted days of month and week match when either matches
+	anyDay     bool
+	anyWeekday bool
+}
+
+// ParseCron parses a five field cron expression. Fields support *,
+// single values, ranges like 1-5, steps like */15 or 0-30/10 and comma
+// separated lists. Day of week is 0-6 with 0 as Sunday; 7 is also Sunday.
+func ParseCron(expression string) (Schedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, newScannerError(errors.New("cron expression needs 5 fields"), expression)
+	}
+	schedule := &cronSchedule{
+		expression: expression,
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+	parsers := []struct {
+		field    string
+		min, max int
+		set      func(int)
+	}{
+		{fields[0], 0, 59, func(v int) { schedule.minutes[v] = true }},
+		{fields[1], 0, 23, func(v int) { schedule.hours[v] = true }},
+		{fields[2], 1, 31, func(v int) { schedule.days[v] = true }},
+		{fields[3], 1, 12, func(v int) { schedule.months[v] = true }},
+		{fields[4], 0, 7, func(v int) { schedule.weekdays[v%7] = true }},
+	}
+	for _, parser := range parsers {
+		if err := parseCronField(parser.field, parser.min, parser.max, parser.set); err != nil {
+			return nil, newScannerError(err, fmt.Sprintf("cron expression %q", expression))
+		}
+	}
+	return schedule, nil
+}
+
+func parseCronField(field string, min, max int, set func(int)) error {
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepValue)
+			if err != nil || step < 1 {
+				return fmt.Errorf("invalid step: %s", part)
+			}
+		}
+
+		low, high := min, max
+		if valueRange != "*" {
+			lowValue, highValue, isRange := strings.Cut(valueRange, "-")
+			var err error
+			low, err = strconv.Atoi(lowValue)
+			if err != nil {
+				return fmt.Errorf("invalid value: %s", part)
+			}
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highValue)
+				if err != nil {
+					return fmt.Errorf("invalid range: %s", part)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return fmt.Errorf("%s is outside %d-%d", part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			set(v)
+		}
+	}
+	return nil
+}
+
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	day := c.days[t.Day()]
+	weekday := c.weekdays[t.Weekday()]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// Next returns the next whole minute after the given time that matches.
+// A schedule that never matches, such as February 30th, returns the zero time.
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// every combination repeats within a few years
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.months[t.Month()] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) String() string {
+	return c.expression
+}
@@ -0,0 +1,50 @@
+package ottscanner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	after := time.Date(2023, time.April, 14, 10, 7, 30, 0, time.UTC) // a Friday
+	tests := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"* * * * *", time.Date(2023, time.April, 14, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2023, time.April, 14, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2023, time.April, 14, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1", time.Date(2023, time.April, 17, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * 7", time.Date(2023, time.April, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := schedule.Next(after); !next.Equal(test.expected) {
+			t.Fatalf("%s expected: %v, got: %v", test.expression, test.expected, next)
+		}
+	}
+
+	for _, expression := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expression); err == nil {
+			t.Fatalf("expected error for %q", expression)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := ParseSchedule("90s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if next := schedule.Next(now); next.Sub(now) != 90*time.Second {
+		t.Fatalf("expected: %v, got: %v", 90*time.Second, next.Sub(now))
+	}
+	if _, err := ParseSchedule("-1s"); err == nil {
+		t.Fatal("expected error for negative interval")
+	}
+}
@@ -0,0 +1,634 @@
+package ottscanner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/semaphore"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type JobStatus byte
+
+const (
+	JobQueued JobStatus = iota
+	JobRunning
+	// JobSucceeded is a job that ran to the end. Segments may still have
+	// failed, see Job.Failures.
+	JobSucceeded
+	// JobFailed is a job that could not run to the end.
+	JobFailed
+	JobCanceled
+)
+
+func (status JobStatus) String() string {
+	switch status {
+	case JobQueued:
+		return "queued"
+	case JobRunning:
+		return "running"
+	case JobSucceeded:
+		return "succeeded"
+	case JobFailed:
+		return "failed"
+	case JobCanceled:
+		return "canceled"
+	default:
+		return fmt.Sprintf("Unknown(%d)", status)
+	}
+}
+
+func (status JobStatus) MarshalText() ([]byte, error) {
+	return []byte(status.String()), nil
+}
+
+func (status *JobStatus) UnmarshalText(text []byte) error {
+	for _, s := range []JobStatus{JobQueued, JobRunning, JobSucceeded, JobFailed, JobCanceled} {
+		if s.String() == string(text) {
+			*status = s
+			return nil
+		}
+	}
+	return newScannerError(errors.New("unknown job status"), string(text))
+}
+
+// done returns true when the job will not change anymore
+func (status JobStatus) done() bool {
+	return status == JobSucceeded || status == JobFailed || status == JobCanceled
+}
+
+// JobRequest is a scan, random, download or emulate job to run.
+type JobRequest struct {
+	Kind    string            `json:"kind"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+	// Sample is the sample of a random job. Defaults to 5 percent.
+	Sample *SampleConfig `json:"sample,omitempty"`
+	// Emulate configures the playback of an emulate job.
+	Emulate *EmulateConfig `json:"emulate,omitempty"`
+}
+
+// EmulateConfig configures an emulated playback. Profile is the name
+// of a built-in network profile.
+type EmulateConfig struct {
+	Profile         string `json:"profile,omitempty"`
+	Segments        int    `json:"segments,omitempty"`
+	StartupSegments int    `json:"startup_segments,omitempty"`
+}
+
+// Validate checks the request can be run.
+func (r *JobRequest) Validate() error {
+	switch r.Kind {
+	case "scan", "random", "download", "emulate":
+	default:
+		return newScannerError(errors.New("kind must be scan, random, download or emulate"), r.Kind)
+	}
+	if u, err := url.ParseRequestURI(r.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return newScannerError(errors.New("not an absolute http url"), r.URL)
+	}
+	problems := new(ConfigError)
+	validateSettings(problems, "", r.Timeout, r.Headers, nil, "", r.Sample, "")
+	if len(problems.Problems) > 0 {
+		return problems
+	}
+	if r.Emulate != nil && r.Emulate.Profile != "" {
+		if _, err := NetworkProfileByName(r.Emulate.Profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Job is a request run by a Server and its outcome.
+type Job struct {
+	ID       string     `json:"id"`
+	Request  JobRequest `json:"request"`
+	Status   JobStatus  `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Started  time.Time  `json:"started"`
+	Finished time.Time  `json:"finished"`
+	// Failures is the number of failed segments in the report.
+	Failures int `json:"failures"`
+	// Directory has the segments of a download job.
+	Directory string  `json:"directory,omitempty"`
+	Report    *Report `json:"report,omitempty"`
+}
+
+var (
+	errInvalidJob  = errors.New("invalid job")
+	errJobNotFound = errors.New("job not found")
+	errJobDone     = errors.New("job already finished")
+	errQueueFull   = errors.New("job queue is full")
+)
+
+// ServerOptions configures a Server.
+type ServerOptions struct {
+	// Workers is the number of jobs run at the same time. Defaults to 2.
+	Workers int
+	// QueueSize is the number of jobs that may wait for a worker.
+	// Defaults to 100.
+	QueueSize int
+	// MaxConcurrency limits segment requests in flight across all jobs.
+	// Defaults to 10.
+	MaxConcurrency int64
+	// Store keeps the jobs. Defaults to a memory store.
+	Store JobStore
+	// DownloadDirectory is where download jobs write their segments, in
+	// a directory per job. Defaults to a temporary directory.
+	DownloadDirectory string
+	// Options are applied to the scanner of every job.
+	Options []Option
+	// History records the scan and random jobs by url and is served
+	// at /history when set.
+	History *History
+	// Logger is the logger of the server and the default logger of the
+	// scanner of every job.
+	Logger *slog.Logger
+}
+
+// Server runs jobs on a bounded pool of workers and serves a REST API:
+//
+//	POST   /jobs              submit a JobRequest, 202 with the Job
+//	GET    /jobs              list jobs without reports, ?status= filters
+//	GET    /jobs/{id}         get a job and its report
+//	GET    /jobs/{id}/report  the report, ?format=json, ndjson, csv, junit or html
+//	DELETE /jobs/{id}         cancel a queued or running job
+//	GET    /history           the channels in the history
+//	GET    /history?channel=  a HistorySummary, ?since=24h&step=1h
+type Server struct {
+	options ServerOptions
+	store   JobStore
+	queue   chan string
+	budget  *semaphore.Weighted
+	logger  *slog.Logger
+	// cancels cancels the running jobs by id
+	cancels map[string]context.CancelFunc
+	ctx     context.Context
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+	mutex   sync.Mutex
+}
+
+// NewServer starts the workers of a server. Jobs of the store that were
+// queued are queued again and jobs that were running are failed.
+func NewServer(options ServerOptions) (*Server, error) {
+	if options.Workers < 1 {
+		options.Workers = 2
+	}
+	if options.QueueSize < 1 {
+		options.QueueSize = 100
+	}
+	if options.MaxConcurrency < 1 {
+		options.MaxConcurrency = 10
+	}
+	if options.Store == nil {
+		options.Store = NewMemoryJobStore()
+	}
+	if options.DownloadDirectory == "" {
+		options.DownloadDirectory = filepath.Join(os.TempDir(), "ottscanner-jobs")
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	server := &Server{
+		options: options,
+		store:   options.Store,
+		queue:   make(chan string, options.QueueSize),
+		budget:  semaphore.NewWeighted(options.MaxConcurrency),
+		logger:  orDiscard(options.Logger),
+		cancels: make(map[string]context.CancelFunc),
+		ctx:     ctx,
+		stop:    stop,
+	}
+
+	jobs, err := server.store.List()
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	for _, job := range jobs {
+		switch {
+		case job.Status == JobQueued && len(server.queue) < cap(server.queue):
+			server.queue <- job.ID
+		case !job.Status.done():
+			job.Status = JobFailed
+			job.Error = "interrupted by a restart of the server"
+			job.Finished = time.Now()
+			if err := server.store.Put(job); err != nil {
+				stop()
+				return nil, err
+			}
+		}
+	}
+
+	for i := 0; i < options.Workers; i++ {
+		server.wg.Add(1)
+		go server.work()
+	}
+	return server, nil
+}
+
+// Close cancels the running jobs and waits for the workers to stop.
+// Queued jobs stay queued in the store.
+func (s *Server) Close() {
+	s.stop()
+	s.wg.Wait()
+}
+
+func newJobID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Submit queues a job for the request.
+func (s *Server) Submit(request JobRequest) (Job, error) {
+	if err := request.Validate(); err != nil {
+		return Job{}, fmt.Errorf("%w: %v", errInvalidJob, err)
+	}
+	job := Job{
+		ID:      newJobID(),
+		Request: request,
+		Status:  JobQueued,
+		Created: time.Now(),
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.queue) == cap(s.queue) {
+		return Job{}, errQueueFull
+	}
+	if err := s.store.Put(job); err != nil {
+		return Job{}, err
+	}
+	s.queue <- job.ID
+	return job, nil
+}
+
+// Job returns the job with the id.
+func (s *Server) Job(id string) (Job, error) {
+	job, ok, err := s.store.Get(id)
+	if err != nil {
+		return job, err
+	}
+	if !ok {
+		return job, fmt.Errorf("%w: %s", errJobNotFound, id)
+	}
+	return job, nil
+}
+
+// Jobs returns every job ordered by creation time.
+func (s *Server) Jobs() ([]Job, error) {
+	return s.store.List()
+}
+
+// Cancel cancels a queued or running job.
+func (s *Server) Cancel(id string) (Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, err := s.Job(id)
+	if err != nil {
+		return job, err
+	}
+	switch {
+	case job.Status.done():
+		return job, fmt.Errorf("%w: %s", errJobDone, id)
+	case job.Status == JobQueued:
+		job.Status = JobCanceled
+		job.Finished = time.Now()
+		return job, s.store.Put(job)
+	default:
+		// the worker records the job as canceled when it stops
+		if cancel, ok := s.cancels[id]; ok {
+			cancel()
+		}
+		return job, nil
+	}
+}
+
+func (s *Server) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case id := <-s.queue:
+			s.runJob(id)
+		}
+	}
+}
+
+// runJob runs a queued job and stores its outcome
+func (s *Server) runJob(id string) {
+	s.mutex.Lock()
+	job, ok, err := s.store.Get(id)
+	if err != nil || !ok || job.Status != JobQueued {
+		// canceled while queued
+		s.mutex.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	s.cancels[id] = cancel
+	job.Status = JobRunning
+	job.Started = time.Now()
+	err = s.store.Put(job)
+	s.mutex.Unlock()
+	if err != nil {
+		s.logger.Error("error starting job", "job", id, "error", err)
+		return
+	}
+
+	err = s.run(ctx, &job)
+	job.Finished = time.Now()
+	switch {
+	case ctx.Err() != nil:
+		job.Status = JobCanceled
+		job.Error = ctx.Err().Error()
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobSucceeded
+	}
+	if job.Report != nil {
+		job.Failures = job.Report.Failures()
+	}
+	if s.options.History != nil && ctx.Err() == nil && (job.Request.Kind == "scan" || job.Request.Kind == "random") {
+		if err := s.options.History.Record(job.Request.URL, job.Report, err); err != nil {
+			s.logger.Error("error recording job", "job", id, "error", err)
+		}
+	}
+
+	s.mutex.Lock()
+	delete(s.cancels, id)
+	if err := s.store.Put(job); err != nil {
+		s.logger.Error("error storing job", "job", id, "error", err)
+	}
+	s.mutex.Unlock()
+}
+
+// run runs the request of a job with a scanner
+func (s *Server) run(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newScannerError(fmt.Errorf("%v", r), fmt.Sprintf("panic while running job %s", job.ID))
+		}
+	}()
+
+	request := job.Request
+	options := append([]Option{WithBudget(s.budget), WithLogger(s.options.Logger)}, s.options.Options...)
+	options = append(options, WithContext(ctx))
+	if len(request.Headers) > 0 {
+		options = append(options, WithHeaders(request.Headers))
+	}
+	if timeout, err := time.ParseDuration(request.Timeout); err == nil && timeout > 0 {
+		options = append(options, WithTimeout(timeout))
+	}
+	scanner, err := New(request.URL, s.options.MaxConcurrency, options...)
+	if err != nil {
+		return err
+	}
+
+	switch request.Kind {
+	case "scan":
+		_, err = scanner.Scan()
+		job.Report = scanner.Report()
+	case "random":
+		sample := Sample{Strategy: SamplePercent, Percent: 5}
+		if request.Sample != nil {
+			sample = request.Sample.sample()
+		}
+		_, err = scanner.Random(sample)
+		job.Report = scanner.Report()
+	case "download":
+		job.Directory = filepath.Join(s.options.DownloadDirectory, job.ID)
+		if err := os.MkdirAll(job.Directory, 0o755); err != nil {
+			return newScannerError(err, job.Directory)
+		}
+		if err = scanner.Download(job.Directory, s.options.MaxConcurrency); err != nil {
+			return err
+		}
+		// segments that failed to download are only in the files
+		for _, downloads := range scanner.Files() {
+			for _, download := range downloads {
+				if download.Error() != nil {
+					job.Failures++
+				}
+			}
+		}
+		if job.Failures > 0 {
+			err = newScannerError(fmt.Errorf("%d segments failed to download", job.Failures), request.URL)
+		}
+	case "emulate":
+		var playback PlaybackOptions
+		if request.Emulate != nil {
+			playback.Segments = request.Emulate.Segments
+			playback.StartupSegments = request.Emulate.StartupSegments
+			if request.Emulate.Profile != "" {
+				if playback.Profile, err = NetworkProfileByName(request.Emulate.Profile); err != nil {
+					return err
+				}
+			}
+		}
+		var report PlaybackReport
+		report, err = scanner.EmulatePlayback(playback)
+		if err == nil {
+			job.Report = report.ToReport()
+		}
+	}
+	return err
+}
+
+// ServeHTTP serves the REST API of the server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "jobs":
+		switch r.Method {
+		case http.MethodGet:
+			s.listJobs(w, r)
+		case http.MethodPost:
+			s.submitJob(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+	case len(parts) == 2 && parts[0] == "jobs":
+		switch r.Method {
+		case http.MethodGet:
+			job, err := s.Job(parts[1])
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, job)
+		case http.MethodDelete:
+			job, err := s.Cancel(parts[1])
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, job)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	case len(parts) == 3 && parts[0] == "jobs" && parts[2] == "report":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.jobReport(w, r, parts[1])
+	case path == "history" && s.options.History != nil:
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		s.history(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request) {
+	var request JobRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	job, err := s.Submit(request)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.Jobs()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	listed := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		if status != "" && job.Status.String() != status {
+			continue
+		}
+		job.Report = nil
+		listed = append(listed, job)
+	}
+	writeJSON(w, http.StatusOK, listed)
+}
+
+func (s *Server) jobReport(w http.ResponseWriter, r *http.Request, id string) {
+	job, err := s.Job(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if job.Report == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("job %s has no report", id)})
+		return
+	}
+	format := ReportJSON
+	if name := r.URL.Query().Get("format"); name != "" {
+		if format, err = ParseReportFormat(name); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	switch format {
+	case ReportJSON:
+		w.Header().Set("Content-Type", "application/json")
+	case ReportNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	case ReportCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	case ReportJUnit:
+		w.Header().Set("Content-Type", "application/xml")
+	case ReportHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	if err := job.Report.Write(w, format); err != nil {
+		s.logger.Warn("error writing report", "job", id, "error", err)
+	}
+}
+
+// history serves the channels of the history or the summary of a channel
+func (s *Server) history(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	channel := query.Get("channel")
+	if channel == "" {
+		channels, err := s.options.History.Channels()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if channels == nil {
+			channels = []string{}
+		}
+		writeJSON(w, http.StatusOK, channels)
+		return
+	}
+	since, step := 24*time.Hour, time.Hour
+	for name, value := range map[string]*time.Duration{"since": &since, "step": &step} {
+		if v := query.Get(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid %s: %s", name, v)})
+				return
+			}
+			*value = d
+		}
+	}
+	now := time.Now()
+	summary, err := s.options.History.Summary(channel, now.Add(-since), now, step)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// writeError writes an error with the status code that matches it
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errInvalidJob):
+		status = http.StatusBadRequest
+	case errors.Is(err, errJobNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errJobDone):
+		status = http.StatusConflict
+	case errors.Is(err, errQueueFull):
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+}
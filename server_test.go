@@ -0,0 +1,273 @@
+package ottscanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForJob polls the api until the job is done
+func waitForJob(t *testing.T, api *httptest.Server, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(api.URL + "/jobs/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var job Job
+		err = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status.done() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for job %s", id)
+	return Job{}
+}
+
+func submitJob(t *testing.T, api *httptest.Server, body string) (*http.Response, Job) {
+	t.Helper()
+	resp, err := http.Post(api.URL+"/jobs", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	return resp, job
+}
+
+func TestServer_Jobs(t *testing.T) {
+	origin := newTestOrigin(t)
+	server, err := NewServer(ServerOptions{Workers: 2, MaxConcurrency: 4, DownloadDirectory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	resp, job := submitJob(t, api, `{"kind": "scan", "url": "`+origin.URL+`/master.m3u8"}`)
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Location") != "/jobs/"+job.ID {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	job = waitForJob(t, api, job.ID)
+	if job.Status != JobSucceeded || job.Report == nil || len(job.Report.Results()) != 2*testOriginSegments || job.Failures != 0 {
+		t.Fatalf("unexpected scan job: %+v", job)
+	}
+
+	resp, err = http.Get(api.URL + "/jobs/" + job.ID + "/report?format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var csv bytes.Buffer
+	csv.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/csv" || strings.Count(csv.String(), "\n") != 2*testOriginSegments+1 {
+		t.Errorf("unexpected csv report: %s", csv.String())
+	}
+
+	_, emulate := submitJob(t, api, `{"kind": "emulate", "url": "`+origin.URL+`/master.m3u8", "emulate": {"profile": "4g", "segments": 4}}`)
+	_, download := submitJob(t, api, `{"kind": "download", "url": "`+origin.URL+`/master.m3u8"}`)
+	if job := waitForJob(t, api, emulate.ID); job.Status != JobSucceeded || job.Report == nil || job.Report.Playback == nil {
+		t.Errorf("unexpected emulate job: %+v", job)
+	}
+	if job := waitForJob(t, api, download.ID); job.Status != JobSucceeded || job.Directory == "" || job.Failures != 0 {
+		t.Errorf("unexpected download job: %+v", job)
+	}
+
+	resp, err = http.Get(api.URL + "/jobs?status=succeeded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs []Job
+	json.NewDecoder(resp.Body).Decode(&jobs)
+	resp.Body.Close()
+	if len(jobs) != 3 || jobs[0].ID != job.ID || jobs[0].Report != nil {
+		t.Errorf("expected three succeeded jobs in order without reports: %+v", jobs)
+	}
+}
+
+func TestServer_DownloadFailures(t *testing.T) {
+	origin := newTestOriginHandler()
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".ts") {
+			http.NotFound(w, r)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer missing.Close()
+	server, err := NewServer(ServerOptions{MaxConcurrency: 4, DownloadDirectory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	_, job := submitJob(t, api, `{"kind": "download", "url": "`+missing.URL+`/master.m3u8"}`)
+	if job = waitForJob(t, api, job.ID); job.Status != JobFailed || job.Failures != 2*testOriginSegments || job.Error == "" {
+		t.Errorf("expected the download job to fail with every segment, got: %+v", job)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	server, err := NewServer(ServerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"unknown kind", http.MethodPost, "/jobs", `{"kind": "probe", "url": "http://origin/a.m3u8"}`, http.StatusBadRequest},
+		{"bad url", http.MethodPost, "/jobs", `{"kind": "scan", "url": "file:///etc/passwd"}`, http.StatusBadRequest},
+		{"bad sample", http.MethodPost, "/jobs", `{"kind": "random", "url": "http://origin/a.m3u8", "sample": {"strategy": "most"}}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/jobs", `{"kind": "scan", "uri": "http://origin/a.m3u8"}`, http.StatusBadRequest},
+		{"missing job", http.MethodGet, "/jobs/0123456789abcdef", "", http.StatusNotFound},
+		{"cancel missing job", http.MethodDelete, "/jobs/0123456789abcdef", "", http.StatusNotFound},
+		{"method", http.MethodPut, "/jobs", "", http.StatusMethodNotAllowed},
+		{"path", http.MethodGet, "/scans", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, api.URL+test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var body map[string]string
+			json.NewDecoder(resp.Body).Decode(&body)
+			if resp.StatusCode != test.status || body["error"] == "" {
+				t.Errorf("expected %d with an error, got: %d %v", test.status, resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestServer_Cancel(t *testing.T) {
+	origin := newTestOriginHandler()
+	// segment requests hang until they are canceled
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".ts") {
+			<-r.Context().Done()
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+
+	server, err := NewServer(ServerOptions{Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	api := httptest.NewServer(server)
+	defer api.Close()
+
+	_, running := submitJob(t, api, `{"kind": "scan", "url": "`+slow.URL+`/master.m3u8"}`)
+	_, queued := submitJob(t, api, `{"kind": "scan", "url": "`+slow.URL+`/master.m3u8"}`)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		job, err := server.Job(running.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == JobRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the job to run")
+		}
+	}
+
+	for _, id := range []string{queued.ID, running.ID} {
+		req, _ := http.NewRequest(http.MethodDelete, api.URL+"/jobs/"+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected %d canceling %s, got: %d", http.StatusAccepted, id, resp.StatusCode)
+		}
+	}
+	for _, id := range []string{queued.ID, running.ID} {
+		if job := waitForJob(t, api, id); job.Status != JobCanceled {
+			t.Errorf("expected job %s to be canceled: %+v", id, job)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, api.URL+"/jobs/"+running.ID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected %d canceling a finished job, got: %d", http.StatusConflict, resp.StatusCode)
+	}
+}
+
+func TestFileJobStore(t *testing.T) {
+	directory := t.TempDir()
+	store, err := NewFileJobStore(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now()
+	request := JobRequest{Kind: "scan", URL: "http://127.0.0.1:1/master.m3u8"}
+	jobs := []Job{
+		{ID: "a", Request: request, Status: JobSucceeded, Created: created},
+		{ID: "b", Request: request, Status: JobRunning, Created: created.Add(time.Second)},
+	}
+	for _, job := range jobs {
+		if err := store.Put(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := store.Get("../a"); ok {
+		t.Error("expected ids with paths to be rejected")
+	}
+
+	// a new server on the same store fails the job that was running
+	store, err = NewFileJobStore(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(ServerOptions{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	listed, err := server.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || listed[0].ID != "a" || listed[0].Status != JobSucceeded {
+		t.Fatalf("unexpected jobs: %+v", listed)
+	}
+	if listed[1].Status != JobFailed || listed[1].Error == "" {
+		t.Errorf("expected the running job to fail: %+v", listed[1])
+	}
+}
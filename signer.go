@@ -0,0 +1,219 @@
+package ottscanner
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// URLSigner signs a request before it is sent, by changing its url,
+// headers or cookies. It is called for every attempt of every request so
+// signatures do not expire during long scans.
+type URLSigner interface {
+	Sign(req *http.Request) error
+}
+
+// WithURLSigner signs every playlist, manifest and segment request of
+// the scanner with the signer.
+func WithURLSigner(signer URLSigner) Option {
+	return func(s *Scanner) {
+		s.signer = signer
+	}
+}
+
+// HMACSigner adds an expiry time and an HMAC-SHA256 signature of the url
+// path and the expiry time to the query, as in
+// /segment.ts?expires=1700000000&signature=<hex>. The signature is
+// HMAC(key, path + expires) for edge servers that check secure links.
+type HMACSigner struct {
+	Key []byte
+	// Expires is how long a signature is valid. Defaults to 5 minutes.
+	Expires time.Duration
+	// ExpiresParameter and SignatureParameter are the names of the query
+	// parameters. They default to expires and signature.
+	ExpiresParameter   string
+	SignatureParameter string
+}
+
+func (hs *HMACSigner) Sign(req *http.Request) error {
+	return hs.sign(req, time.Now())
+}
+
+func (hs *HMACSigner) sign(req *http.Request, now time.Time) error {
+	if len(hs.Key) == 0 {
+		return errors.New("hmac signer needs a key")
+	}
+	expires := fmt.Sprint(now.Add(orDefault(hs.Expires, 5*time.Minute)).Unix())
+	mac := hmac.New(sha256.New, hs.Key)
+	mac.Write([]byte(req.URL.Path + expires))
+	query := req.URL.Query()
+	query.Set(orDefaultString(hs.ExpiresParameter, "expires"), expires)
+	query.Set(orDefaultString(hs.SignatureParameter, "signature"), hex.EncodeToString(mac.Sum(nil)))
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// CloudFrontSigner signs requests for Amazon CloudFront with the private
+// key of a key pair or public key. Urls are signed with a canned policy,
+// or with Cookies a custom policy for every url of Resource is sent as
+// the CloudFront-Policy, CloudFront-Signature and CloudFront-Key-Pair-Id
+// cookies.
+type CloudFrontSigner struct {
+	KeyPairID  string
+	PrivateKey *rsa.PrivateKey
+	// Expires is how long a signature is valid. Defaults to 5 minutes.
+	Expires time.Duration
+	Cookies bool
+	// Resource is the url pattern of the cookie policy. Defaults to every
+	// url of the host of the request, as in https://host/*.
+	Resource string
+}
+
+// NewCloudFrontSigner returns a signer of signed urls with the PEM
+// encoded PKCS #1 or PKCS #8 RSA private key of the key pair.
+func NewCloudFrontSigner(keyPairID string, privateKeyPEM []byte, expires time.Duration) (*CloudFrontSigner, error) {
+	key, err := parseRSAPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, newScannerError(err, "cloudfront private key")
+	}
+	return &CloudFrontSigner{KeyPairID: keyPairID, PrivateKey: key, Expires: expires}, nil
+}
+
+func (cs *CloudFrontSigner) Sign(req *http.Request) error {
+	return cs.sign(req, time.Now())
+}
+
+func (cs *CloudFrontSigner) sign(req *http.Request, now time.Time) error {
+	if cs.PrivateKey == nil || cs.KeyPairID == "" {
+		return errors.New("cloudfront signer needs a key pair id and a private key")
+	}
+	expires := now.Add(orDefault(cs.Expires, 5*time.Minute)).Unix()
+	resource := req.URL.String()
+	if cs.Cookies {
+		resource = orDefaultString(cs.Resource, fmt.Sprintf("%s://%s/*", req.URL.Scheme, req.URL.Host))
+	}
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":%d}}}]}`, resource, expires)
+	digest := sha1.Sum([]byte(policy))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, cs.PrivateKey, crypto.SHA1, digest[:])
+	if err != nil {
+		return err
+	}
+	if cs.Cookies {
+		req.AddCookie(&http.Cookie{Name: "CloudFront-Policy", Value: cloudFrontEncode([]byte(policy))})
+		req.AddCookie(&http.Cookie{Name: "CloudFront-Signature", Value: cloudFrontEncode(signature)})
+		req.AddCookie(&http.Cookie{Name: "CloudFront-Key-Pair-Id", Value: cs.KeyPairID})
+		return nil
+	}
+	query := req.URL.Query()
+	query.Set("Expires", fmt.Sprint(expires))
+	query.Set("Signature", cloudFrontEncode(signature))
+	query.Set("Key-Pair-Id", cs.KeyPairID)
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// cloudFrontEncode is base64 with the characters that are invalid in
+// urls replaced the way CloudFront expects
+func cloudFrontEncode(data []byte) string {
+	return strings.NewReplacer("+", "-", "=", "_", "/", "~").Replace(base64.StdEncoding.EncodeToString(data))
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+	return rsaKey, nil
+}
+
+// AkamaiSigner adds an Akamai EdgeAuth token 2.0 to the query, or as a
+// cookie with Cookie. The token is st=<start>~exp=<end>~hmac=<hex> signed
+// with HMAC-SHA256 for the path of each url, or acl=<ACL> for every url
+// the ACL matches, such as /live/*.
+type AkamaiSigner struct {
+	// Key is the hex encoded token auth key of the property.
+	Key string
+	// TokenName defaults to __token__.
+	TokenName string
+	// Window is how long a token is valid. Defaults to 5 minutes.
+	Window time.Duration
+	ACL    string
+	Cookie bool
+}
+
+func (as *AkamaiSigner) Sign(req *http.Request) error {
+	return as.sign(req, time.Now())
+}
+
+func (as *AkamaiSigner) sign(req *http.Request, now time.Time) error {
+	key, err := hex.DecodeString(as.Key)
+	if err != nil || len(key) == 0 {
+		return errors.New("akamai signer needs a hex encoded key")
+	}
+	fields := []string{
+		fmt.Sprintf("st=%d", now.Unix()),
+		fmt.Sprintf("exp=%d", now.Add(orDefault(as.Window, 5*time.Minute)).Unix()),
+	}
+	// the url is signed but not part of the token
+	signed := append([]string(nil), fields...)
+	if as.ACL != "" {
+		fields = append(fields, "acl="+as.ACL)
+		signed = fields
+	} else {
+		signed = append(signed, "url="+req.URL.EscapedPath())
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(signed, "~")))
+	token := strings.Join(fields, "~") + "~hmac=" + hex.EncodeToString(mac.Sum(nil))
+
+	name := orDefaultString(as.TokenName, "__token__")
+	if as.Cookie {
+		req.AddCookie(&http.Cookie{Name: name, Value: token})
+		return nil
+	}
+	// the token is not escaped so the edge sees the ~ and = it signed
+	parameter := name + "=" + token
+	if req.URL.RawQuery == "" {
+		req.URL.RawQuery = parameter
+	} else {
+		req.URL.RawQuery += "&" + parameter
+	}
+	return nil
+}
+
+func orDefault(value, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func orDefaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,186 @@
+package ottscanner
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var signingTime = time.Unix(1700000000, 0)
+
+func hmacHex(key []byte, message string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHMACSigner(t *testing.T) {
+	signer := &HMACSigner{Key: []byte("secret"), Expires: time.Minute}
+	req := httptest.NewRequest(http.MethodGet, "http://edge/live/seg_1.ts?a=1", nil)
+	if err := signer.sign(req, signingTime); err != nil {
+		t.Fatal(err)
+	}
+	query := req.URL.Query()
+	if query.Get("a") != "1" || query.Get("expires") != "1700000060" {
+		t.Errorf("unexpected query: %s", req.URL.RawQuery)
+	}
+	if expected := hmacHex([]byte("secret"), "/live/seg_1.ts1700000060"); query.Get("signature") != expected {
+		t.Errorf("expected signature %s, got: %s", expected, query.Get("signature"))
+	}
+	if err := (&HMACSigner{}).sign(req, signingTime); err == nil {
+		t.Error("expected an error without a key")
+	}
+}
+
+func TestAkamaiSigner(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	signer := &AkamaiSigner{Key: hex.EncodeToString(key)}
+	req := httptest.NewRequest(http.MethodGet, "http://edge/live/seg_1.ts", nil)
+	if err := signer.sign(req, signingTime); err != nil {
+		t.Fatal(err)
+	}
+	fields := "st=1700000000~exp=1700000300"
+	expected := "__token__=" + fields + "~hmac=" + hmacHex(key, fields+"~url=/live/seg_1.ts")
+	if req.URL.RawQuery != expected {
+		t.Errorf("expected query %s, got: %s", expected, req.URL.RawQuery)
+	}
+
+	signer = &AkamaiSigner{Key: hex.EncodeToString(key), TokenName: "hdnts", ACL: "/live/*", Cookie: true}
+	req = httptest.NewRequest(http.MethodGet, "http://edge/live/seg_1.ts", nil)
+	if err := signer.sign(req, signingTime); err != nil {
+		t.Fatal(err)
+	}
+	fields += "~acl=/live/*"
+	cookie, err := req.Cookie("hdnts")
+	if err != nil || cookie.Value != fields+"~hmac="+hmacHex(key, fields) {
+		t.Errorf("unexpected token cookie: %v %v", cookie, err)
+	}
+	if err := (&AkamaiSigner{Key: "not hex"}).sign(req, signingTime); err == nil {
+		t.Error("expected an error with a key that is not hex")
+	}
+}
+
+func TestCloudFrontSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func(policy, signature string) {
+		t.Helper()
+		decoded, err := base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(signature))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha1.Sum([]byte(policy))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], decoded); err != nil {
+			t.Errorf("invalid signature of %s: %v", policy, err)
+		}
+	}
+
+	signer := &CloudFrontSigner{KeyPairID: "K2JCJMDEHXQW5F", PrivateKey: key}
+	req := httptest.NewRequest(http.MethodGet, "https://d111111abcdef8.cloudfront.net/live/seg_1.ts", nil)
+	if err := signer.sign(req, signingTime); err != nil {
+		t.Fatal(err)
+	}
+	query := req.URL.Query()
+	if query.Get("Expires") != "1700000300" || query.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" {
+		t.Errorf("unexpected query: %s", req.URL.RawQuery)
+	}
+	verify(`{"Statement":[{"Resource":"https://d111111abcdef8.cloudfront.net/live/seg_1.ts","Condition":{"DateLessThan":{"AWS:EpochTime":1700000300}}}]}`,
+		query.Get("Signature"))
+
+	signer.Cookies = true
+	req = httptest.NewRequest(http.MethodGet, "https://d111111abcdef8.cloudfront.net/live/seg_1.ts", nil)
+	if err := signer.sign(req, signingTime); err != nil {
+		t.Fatal(err)
+	}
+	cookies := make(map[string]string)
+	for _, cookie := range req.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	policy := `{"Statement":[{"Resource":"https://d111111abcdef8.cloudfront.net/*","Condition":{"DateLessThan":{"AWS:EpochTime":1700000300}}}]}`
+	if cookies["CloudFront-Policy"] != cloudFrontEncode([]byte(policy)) || cookies["CloudFront-Key-Pair-Id"] != "K2JCJMDEHXQW5F" {
+		t.Errorf("unexpected cookies: %v", cookies)
+	}
+	verify(policy, cookies["CloudFront-Signature"])
+
+	if _, err := NewCloudFrontSigner("K2JCJMDEHXQW5F", []byte("not a key"), time.Minute); err == nil {
+		t.Error("expected an error parsing a bad private key")
+	}
+}
+
+func TestScanner_URLSigner(t *testing.T) {
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("signature") != hmacHex([]byte("secret"), r.URL.Path+query.Get("expires")) {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	scanner, err := New(server.URL+"/master.m3u8", 4, WithURLSigner(&HMACSigner{Key: []byte("secret")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	results := scanner.Report().Results()
+	if len(results) != 2*testOriginSegments {
+		t.Fatalf("expected %d results, got: %d", 2*testOriginSegments, len(results))
+	}
+	for _, result := range results {
+		if !result.OK || strings.Contains(result.URL, "signature") {
+			t.Errorf("expected a signed request and an unsigned url, got: %+v", result)
+		}
+	}
+
+	scanner, _ = New(server.URL+"/master.m3u8", 4, WithURLSigner(&HMACSigner{}))
+	if _, err := scanner.Streams(); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("signing %s/master.m3u8", server.URL)) {
+		t.Errorf("expected a signing error, got: %v", err)
+	}
+}
+
+// signerFunc signs requests with a function
+type signerFunc func(req *http.Request) error
+
+func (f signerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+func TestScanner_URLSignerRateLimit(t *testing.T) {
+	origin := newTestOriginHandler()
+	// signatures are only valid for 50ms
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signed, _ := time.Parse(time.RFC3339Nano, r.Header.Get("X-Signed"))
+		if time.Since(signed) > 50*time.Millisecond {
+			http.Error(w, "signature expired", http.StatusForbidden)
+			return
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	signer := signerFunc(func(req *http.Request) error {
+		req.Header.Set("X-Signed", time.Now().Format(time.RFC3339Nano))
+		return nil
+	})
+	scanner, _ := New(server.URL+"/master.m3u8", 1, WithURLSigner(signer), WithRateLimiter(NewRateLimiter(10, 1)))
+	if _, err := scanner.Streams(); err != nil {
+		t.Errorf("expected requests to be signed after waiting for the rate limiter, got: %v", err)
+	}
+}
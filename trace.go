@@ -0,0 +1,138 @@
+package ottscanner
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings break a request down into its phases. DNS, Connect and TLS
+// are 0 when a kept-alive connection was reused. FirstByte is the time
+// from sending the request to the first byte of the response including
+// the other phases, so FirstByte - DNS - Connect - TLS is the time the
+// origin took. Transfer is the time reading the body.
+type Timings struct {
+	DNS       time.Duration `json:"dns"`
+	Connect   time.Duration `json:"connect"`
+	TLS       time.Duration `json:"tls"`
+	FirstByte time.Duration `json:"first_byte"`
+	Transfer  time.Duration `json:"transfer"`
+	Reused    bool          `json:"reused,omitempty"`
+}
+
+// TimingSummary holds the percentiles of each timing of the segment
+// requests of a stream.
+type TimingSummary struct {
+	DNS       LatencySummary `json:"dns"`
+	Connect   LatencySummary `json:"connect"`
+	TLS       LatencySummary `json:"tls"`
+	FirstByte LatencySummary `json:"first_byte"`
+	Transfer  LatencySummary `json:"transfer"`
+}
+
+// summarizeTimings returns the percentiles of the timings of the results
+// or nil when no result has timings
+func summarizeTimings(results []SegmentResult) *TimingSummary {
+	var dns, connect, tls, firstByte, transfer []time.Duration
+	for _, result := range results {
+		if result.Timings == nil {
+			continue
+		}
+		dns = append(dns, result.Timings.DNS)
+		connect = append(connect, result.Timings.Connect)
+		tls = append(tls, result.Timings.TLS)
+		firstByte = append(firstByte, result.Timings.FirstByte)
+		transfer = append(transfer, result.Timings.Transfer)
+	}
+	if len(firstByte) == 0 {
+		return nil
+	}
+	return &TimingSummary{
+		DNS:       summarizeLatency(dns),
+		Connect:   summarizeLatency(connect),
+		TLS:       summarizeLatency(tls),
+		FirstByte: summarizeLatency(firstByte),
+		Transfer:  summarizeLatency(transfer),
+	}
+}
+
+// requestTrace records the timings of the last attempt of a request
+// with httptrace
+type requestTrace struct {
+	mutex        sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	firstByte    time.Time
+	timings      Timings
+}
+
+// reset starts the timings of an attempt
+func (t *requestTrace) reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.start = time.Now()
+	t.dnsStart, t.connectStart, t.tlsStart, t.firstByte = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	t.timings = Timings{}
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	record := func(fn func(now time.Time)) {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		fn(time.Now())
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func(now time.Time) { t.dnsStart = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func(now time.Time) { t.timings.DNS = now.Sub(t.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			record(func(now time.Time) {
+				// only the first address tried is timed
+				if t.connectStart.IsZero() {
+					t.connectStart = now
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			record(func(now time.Time) {
+				if err == nil && t.timings.Connect == 0 {
+					t.timings.Connect = now.Sub(t.connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			record(func(now time.Time) { t.tlsStart = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func(now time.Time) { t.timings.TLS = now.Sub(t.tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func(time.Time) { t.timings.Reused = info.Reused })
+		},
+		GotFirstResponseByte: func() {
+			record(func(now time.Time) {
+				t.firstByte = now
+				t.timings.FirstByte = now.Sub(t.start)
+			})
+		},
+	}
+}
+
+// result returns the timings once the body has been read or nil when
+// no response was received
+func (t *requestTrace) result() *Timings {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.firstByte.IsZero() {
+		return nil
+	}
+	timings := t.timings
+	timings.Transfer = time.Since(t.firstByte)
+	return &timings
+}
@@ -0,0 +1,100 @@
+package ottscanner
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanner_Timings(t *testing.T) {
+	origin := newTestOriginHandler()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/high_") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	scanner, _ := New(server.URL+"/master.m3u8", 1, WithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	if _, err := scanner.requestPlaylist(server.URL + "/master.m3u8"); err != nil {
+		t.Fatal(err)
+	}
+	if fetch := scanner.fetches[0]; fetch.Timings == nil || fetch.Timings.Connect <= 0 || fetch.Timings.TLS <= 0 ||
+		fetch.Timings.FirstByte < fetch.Timings.Connect+fetch.Timings.TLS {
+		t.Errorf("expected the connect and tls timings of the first fetch, got: %+v", fetch.Timings)
+	}
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	report := scanner.Report()
+	for _, stream := range report.Streams {
+		if stream.Timings == nil {
+			t.Fatalf("expected a timing summary of %s", stream.Name)
+		}
+		for _, result := range stream.Segments {
+			if result.Timings == nil || !result.Timings.Reused {
+				t.Errorf("expected the timings of a reused connection, got: %+v", result)
+			}
+		}
+		slow := stream.Timings.FirstByte.P50 >= 20*time.Millisecond
+		if slow != (stream.Name == "high.m3u8") {
+			t.Errorf("expected only the high stream to have a slow first byte, got %s: %+v", stream.Name, stream.Timings.FirstByte)
+		}
+	}
+
+	server.Close()
+	scanner.requestPlaylist(server.URL + "/master.m3u8")
+	if fetch := scanner.fetches[len(scanner.fetches)-1]; fetch.Error == "" || fetch.Timings != nil {
+		t.Errorf("expected no timings of a failed fetch, got: %+v", fetch)
+	}
+}
+
+func TestSummarizeTimings(t *testing.T) {
+	var results []SegmentResult
+	for i := 1; i <= 10; i++ {
+		d := time.Duration(i) * time.Millisecond
+		results = append(results, SegmentResult{Timings: &Timings{FirstByte: d, Transfer: 2 * d}})
+	}
+	results = append(results, SegmentResult{Error: "no response"})
+	summary := summarizeTimings(results)
+	if summary.FirstByte.P50 != 5*time.Millisecond || summary.FirstByte.P90 != 9*time.Millisecond ||
+		summary.Transfer.Max != 20*time.Millisecond {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if summarizeTimings(results[10:]) != nil {
+		t.Error("expected no summary without timings")
+	}
+}
+
+func TestScanner_TimingsPlaybackDownload(t *testing.T) {
+	origin := newTestOrigin(t)
+	scanner, _ := New(origin.URL+"/master.m3u8", 4)
+	playback, err := scanner.EmulatePlayback(PlaybackOptions{Segments: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, segment := range playback.Segments {
+		if segment.Timings == nil || segment.Timings.FirstByte <= 0 {
+			t.Errorf("expected the timings of the playback segment, got: %+v", segment)
+		}
+	}
+	if report := playback.ToReport(); report.Streams[0].Timings == nil {
+		t.Errorf("expected a timing summary of the playback, got: %+v", report.Streams[0])
+	}
+
+	scanner, _ = New(origin.URL+"/master.m3u8", 4)
+	if err := scanner.Download(t.TempDir(), 4); err != nil {
+		t.Fatal(err)
+	}
+	for stream, downloads := range scanner.Files() {
+		for _, download := range downloads {
+			if download.Timings() == nil || download.Timings().FirstByte <= 0 {
+				t.Errorf("expected the timings of a download of %s, got: %+v", stream, download.Timings())
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package ottscanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/jkittell/toolbox"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// WithDeepValidation makes Scan and Random download every segment and
+// check that its body is valid media instead of only sending HEAD. The
+// length must match the Content-Length and the byte range of the segment,
+// MPEG-TS segments must have a sync byte at the start of every packet,
+// fMP4 and CMAF segments must be a sequence of ISO-BMFF boxes and HTML
+// pages are never valid. Invalid segments fail with a *ContentError.
+func WithDeepValidation() Option {
+	return func(s *Scanner) {
+		s.deepValidation = true
+	}
+}
+
+// checkSegment requests a segment with HEAD, or with a GET of its first
+// byte when the HEAD is rejected, or downloads and validates it with deep
+// validation. It returns the status of the response.
+func (s *Scanner) checkSegment(trace *requestTrace, segment Segment) (int, error) {
+	if s.deepValidation {
+		resp, err := s.do(trace, RequestSegment, toolbox.GET, segment.url, rangeHeader(segment))
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return resp.StatusCode, err
+		}
+		return resp.StatusCode, validateSegment(segment, resp.Header, resp.ContentLength, body)
+	}
+	resp, err := s.do(trace, RequestSegment, toolbox.HEAD, segment.url, rangeHeader(segment))
+	if err != nil && headFallback(err) {
+		s.logger.Debug("HEAD failed, falling back to GET", "url", segment.url, "error", err)
+		resp, err = s.do(trace, RequestSegment, toolbox.GET, segment.url, fallbackHeader(segment))
+	}
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// fallbackHeader returns the Range header of a GET of the first byte of
+// a segment, sent when HEAD is rejected
+func fallbackHeader(segment Segment) map[string]string {
+	start := 0
+	if segment.byteRangeStart > 0 {
+		start = segment.byteRangeStart
+	}
+	return map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", start, start)}
+}
+
+// headFallback returns true when a HEAD that failed with err should be
+// sent again as a GET. Origins that reject HEAD answer with an error
+// status or close the connection.
+func headFallback(err error) bool {
+	switch Category(err) {
+	case FailureClient, FailureServer, FailureConnect:
+		return true
+	}
+	return false
+}
+
+// mpegTSPacketSize is the size of an MPEG-TS packet, which starts with
+// the sync byte 0x47
+const mpegTSPacketSize = 188
+
+// validateSegment checks the body of a segment response
+func validateSegment(segment Segment, header http.Header, contentLength int64, body []byte) error {
+	invalid := func(format string, args ...any) error {
+		return &ContentError{URL: segment.url, Reason: fmt.Sprintf(format, args...)}
+	}
+	if len(body) == 0 {
+		return invalid("empty body")
+	}
+	if contentLength >= 0 && int64(len(body)) != contentLength {
+		return invalid("read %d bytes of a Content-Length of %d", len(body), contentLength)
+	}
+	if segment.byteRangeSize > 0 && len(body) != segment.byteRangeSize {
+		return invalid("read %d bytes of a byte range of %d", len(body), segment.byteRangeSize)
+	}
+	contentType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if contentType == "text/html" || isHTML(body) {
+		return invalid("html page")
+	}
+	switch {
+	case contentType == "video/mp2t" || strings.EqualFold(path.Ext(segment.name), ".ts"):
+		return validateMPEGTS(body, invalid)
+	case isISOBMFF(contentType, segment.name):
+		return validateISOBMFF(body, invalid)
+	}
+	return nil
+}
+
+func isHTML(body []byte) bool {
+	start := bytes.ToLower(bytes.TrimSpace(body[:min(len(body), 512)]))
+	return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.HasPrefix(start, []byte("<html"))
+}
+
+func isISOBMFF(contentType, name string) bool {
+	switch contentType {
+	case "video/mp4", "audio/mp4", "video/iso.segment", "audio/iso.segment":
+		return true
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mp4", ".m4s", ".m4v", ".m4a", ".cmfv", ".cmfa", ".cmft":
+		return true
+	}
+	return false
+}
+
+func validateMPEGTS(body []byte, invalid func(string, ...any) error) error {
+	if len(body) < mpegTSPacketSize {
+		return invalid("%d bytes is shorter than an MPEG-TS packet", len(body))
+	}
+	for offset := 0; offset < len(body); offset += mpegTSPacketSize {
+		if body[offset] != 0x47 {
+			return invalid("no MPEG-TS sync byte at offset %d", offset)
+		}
+	}
+	if len(body)%mpegTSPacketSize != 0 {
+		return invalid("%d bytes is not a whole number of MPEG-TS packets", len(body))
+	}
+	return nil
+}
+
+// validateISOBMFF checks that the body is a sequence of top level boxes
+// with printable types that ends at the end of the last box
+func validateISOBMFF(body []byte, invalid func(string, ...any) error) error {
+	for offset := 0; offset < len(body); {
+		if len(body)-offset < 8 {
+			return invalid("truncated box header at offset %d", offset)
+		}
+		size := uint64(binary.BigEndian.Uint32(body[offset:]))
+		boxType := body[offset+4 : offset+8]
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			// the box extends to the end of the body
+			size = uint64(len(body) - offset)
+		case 1:
+			if len(body)-offset < 16 {
+				return invalid("truncated box header at offset %d", offset)
+			}
+			size = binary.BigEndian.Uint64(body[offset+8:])
+			headerSize = 16
+		}
+		for _, c := range boxType {
+			if c < 0x20 || c > 0x7e {
+				return invalid("not an ISO-BMFF box at offset %d", offset)
+			}
+		}
+		if size < headerSize || size > uint64(len(body)-offset) {
+			return invalid("box %q at offset %d has a size of %d past the end of %d bytes", boxType, offset, size, len(body))
+		}
+		offset += int(size)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package ottscanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// box returns an ISO-BMFF box of the type with the payload
+func box(boxType string, payload []byte) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(payload)))
+	copy(header[4:], boxType)
+	return append(header, payload...)
+}
+
+func TestValidateSegment(t *testing.T) {
+	ts := bytes.Repeat(append([]byte{0x47}, make([]byte, mpegTSPacketSize-1)...), 3)
+	fmp4 := append(box("moof", make([]byte, 16)), box("mdat", make([]byte, 32))...)
+	html := []byte("\n<!DOCTYPE html><html><body>Not Found</body></html>")
+	tests := []struct {
+		name          string
+		segment       Segment
+		contentType   string
+		contentLength int64
+		body          []byte
+		ok            bool
+	}{
+		{"ts", Segment{name: "a.ts", byteRangeSize: -1}, "video/mp2t", -1, ts, true},
+		{"ts without sync byte", Segment{name: "a.ts", byteRangeSize: -1}, "", -1, append(append([]byte(nil), ts[:mpegTSPacketSize]...), make([]byte, mpegTSPacketSize)...), false},
+		{"partial ts packet", Segment{name: "a.ts", byteRangeSize: -1}, "", -1, ts[:2*mpegTSPacketSize+10], false},
+		{"short body", Segment{name: "a.ts", byteRangeSize: -1}, "", int64(len(ts) + 1), ts, false},
+		{"byte range", Segment{name: "a.ts", byteRangeSize: 2 * mpegTSPacketSize}, "", -1, ts, false},
+		{"fmp4", Segment{name: "a.m4s", byteRangeSize: -1}, "", int64(len(fmp4)), fmp4, true},
+		{"truncated fmp4", Segment{name: "a.m4s", byteRangeSize: -1}, "", -1, fmp4[:len(fmp4)-1], false},
+		{"fmp4 content type", Segment{name: "segment", byteRangeSize: -1}, "video/mp4", -1, ts, false},
+		{"html", Segment{name: "a.ts", byteRangeSize: -1}, "", -1, html, false},
+		{"html content type", Segment{name: "a.vtt", byteRangeSize: -1}, "text/html; charset=utf-8", -1, []byte("WEBVTT"), false},
+		{"other", Segment{name: "a.vtt", byteRangeSize: -1}, "text/vtt", -1, []byte("WEBVTT"), true},
+		{"empty", Segment{name: "a.vtt", byteRangeSize: -1}, "", -1, nil, false},
+	}
+	for _, test := range tests {
+		header := http.Header{"Content-Type": {test.contentType}}
+		err := validateSegment(test.segment, header, test.contentLength, test.body)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: expected ok %v, got: %v", test.name, test.ok, err)
+		}
+		if err != nil && !errors.Is(err, FailureContent) {
+			t.Errorf("%s: expected a content failure, got: %v", test.name, err)
+		}
+	}
+}
+
+func TestScanner_HEADFallback(t *testing.T) {
+	origin := newTestOriginHandler()
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && r.URL.Path != "/master.m3u8" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == "/low_1.ts" {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	scanner, _ := New(server.URL+"/master.m3u8", 1)
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if failures := scanner.Report().Failures(); failures != 0 {
+		t.Errorf("expected the GET fallback to pass, got %d failures", failures)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=0-0" {
+		t.Errorf("expected a GET of the first byte, got: %v", ranges)
+	}
+}
+
+func TestScanner_DeepValidation(t *testing.T) {
+	origin := newTestOriginHandler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/low_1.ts":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>Service Unavailable</body></html>"))
+		case "/high_2.ts":
+			w.Write(bytes.Repeat([]byte{0x00}, 2*mpegTSPacketSize))
+		default:
+			origin.ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	scanner, _ := New(server.URL+"/master.m3u8", 4)
+	scanner.Scan()
+	if failures := scanner.Report().Failures(); failures != 0 {
+		t.Errorf("expected HEAD to pass every segment, got %d failures", failures)
+	}
+
+	scanner, _ = New(server.URL+"/master.m3u8", 4, WithDeepValidation())
+	if _, err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range scanner.Report().Results() {
+		invalid := result.Name == "low_1.ts" || result.Name == "high_2.ts"
+		if result.OK == invalid {
+			t.Errorf("expected %s ok %v, got: %+v", result.Name, !invalid, result)
+		}
+		if invalid && (result.Status != http.StatusOK || result.Category != FailureContent.String()) {
+			t.Errorf("expected a content failure of a 200 response, got: %+v", result)
+		}
+		if result.OK && (result.Timings == nil || result.Timings.Transfer <= 0) {
+			t.Errorf("expected the transfer of the body to be timed, got: %+v", result.Timings)
+		}
+	}
+}